@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultConfigFiles are looked for in the current directory, in this
+// order, when --config is not given. The first one found is read.
+var defaultConfigFiles = []string{"linklore.yaml", "linklore.toml"}
+
+// loadConfigFile applies the settings of a config file, which is parsed as
+// TOML if its extension is ".toml" and as YAML otherwise. An empty path
+// means the first of defaultConfigFiles, which may all be absent.
+func loadConfigFile(config *Config, path string) error {
+	if path == "" {
+		for _, name := range defaultConfigFiles {
+			_, err := os.Stat(name)
+			if err == nil {
+				path = name
+				break
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	parse := parseYAML
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		parse = parseTOML
+	}
+	values, err := parse(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	err = applyConfigValues(config, values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func applyConfigValues(config *Config, values map[string]any) error {
+	for key, value := range values {
+		var err error
+		switch key {
+		case "inputFile":
+			config.inputFile, err = configString(value)
+		case "outputFile":
+			config.outputFile, err = configString(value)
+		case "baseDir":
+			config.baseDir, err = configString(value)
+		case "prefix":
+			config.prefix, err = configString(value)
+		case "force":
+			config.force, err = configBool(value)
+		case "ignorePatterns":
+			config.ignorePatterns, err = configList(value)
+		default:
+			err = errors.New("unknown key")
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func configString(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case []string:
+		if len(value) == 0 {
+			return "", nil
+		}
+	}
+	return "", errors.New("expect a string")
+}
+
+func configBool(value any) (bool, error) {
+	s, err := configString(value)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("expect true or false, got %q", s)
+	}
+	return b, nil
+}
+
+// configList accepts a list, or a comma-separated string like the
+// LINKLORE_IGNORE environment variable.
+func configList(value any) ([]string, error) {
+	switch value := value.(type) {
+	case []string:
+		return value, nil
+	case string:
+		return strings.Split(value, ","), nil
+	}
+	return nil, errors.New("expect a list")
+}
+
+// parseYAML parses the flat subset of YAML used by config files: top-level
+// "key: value" pairs whose values are scalars, flow lists ("[a, b]") or
+// block lists ("- a" items on the following lines). Scalars are returned as
+// string, lists as []string.
+func parseYAML(content []byte) (map[string]any, error) {
+	values := make(map[string]any)
+	var listKey string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := stripYAMLComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNumber)
+			}
+			item := unquoteYAML(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			values[listKey] = append(values[listKey].([]string), item)
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", lineNumber)
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, fmt.Errorf("line %d: expect \"key: value\"", lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		listKey = ""
+		switch {
+		case value == "":
+			values[key] = []string{}
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			items := []string{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				item = strings.TrimSpace(item)
+				if item != "" {
+					items = append(items, unquoteYAML(item))
+				}
+			}
+			values[key] = items
+		default:
+			values[key] = unquoteYAML(value)
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// stripYAMLComment removes a trailing "# comment" outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteYAML(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+// parseTOML parses the flat subset of TOML used by config files: top-level
+// "key = value" pairs whose values are strings, booleans, numbers or lists
+// of them, which may span several lines. Tables are not supported. Values
+// are returned like those of parseYAML: scalars as string, lists as
+// []string.
+func parseTOML(content []byte) (map[string]any, error) {
+	values := make(map[string]any)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", lineNumber)
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expect \"key = value\"", lineNumber)
+		}
+		key, err := parseTOMLKey(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("line %d: %s: duplicate key", lineNumber, key)
+		}
+
+		start := lineNumber
+		value = strings.TrimSpace(value)
+		for tomlListOpen(value) && scanner.Scan() {
+			lineNumber++
+			value += " " + strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		}
+		values[key], err = parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", start, key, err)
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// parseTOMLKey accepts a bare key or a quoted one. Dotted keys are not
+// supported.
+func parseTOMLKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) || strings.HasPrefix(key, "'") {
+		unquoted, rest, err := readTOMLString(key)
+		if err == nil && rest == "" {
+			return unquoted, nil
+		}
+	}
+	if key == "" || strings.TrimLeft(key, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_-") != "" {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return key, nil
+}
+
+// parseTOMLValue parses a string, a boolean, a number or a list of them.
+func parseTOMLValue(value string) (any, error) {
+	if !strings.HasPrefix(value, "[") {
+		return parseTOMLScalar(value)
+	}
+	if !strings.HasSuffix(value, "]") {
+		return nil, errors.New("unterminated list")
+	}
+
+	items := []string{}
+	rest := strings.TrimSpace(value[1 : len(value)-1])
+	for rest != "" {
+		var item string
+		if rest[0] == '"' || rest[0] == '\'' {
+			var err error
+			item, rest, err = readTOMLString(rest)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			scalar, err := parseTOMLScalar(strings.TrimSpace(rest[:end]))
+			if err != nil {
+				return nil, err
+			}
+			item, rest = scalar, rest[end:]
+		}
+		items = append(items, item)
+
+		// Items are separated by commas, and the last one may be followed
+		// by one.
+		rest = strings.TrimSpace(rest)
+		if rest != "" {
+			if rest[0] != ',' {
+				return nil, fmt.Errorf("expect a comma before %q", rest)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	return items, nil
+}
+
+// parseTOMLScalar parses a string, a boolean or a number, returned as a
+// string.
+func parseTOMLScalar(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+		s, rest, err := readTOMLString(value)
+		if err != nil {
+			return "", err
+		}
+		if rest != "" {
+			return "", fmt.Errorf("unexpected %q after string", rest)
+		}
+		return s, nil
+	}
+	if value == "true" || value == "false" {
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err == nil {
+		return value, nil
+	}
+	return "", fmt.Errorf("expect a string, a boolean, a number or a list, got %q", value)
+}
+
+// readTOMLString reads the basic ("...") or literal ('...') string at the
+// start of s, and returns it unquoted with the rest of s. Multi-line
+// strings are not supported.
+func readTOMLString(s string) (string, string, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return s[1:i], s[i+1:], nil
+			}
+			unquoted, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return unquoted, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+// stripTOMLComment removes a "# comment" outside of strings.
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlListOpen reports whether value starts a list that is not closed yet,
+// so that it continues on the next line.
+func tomlListOpen(value string) bool {
+	if !strings.HasPrefix(value, "[") {
+		return false
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth > 0
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pluveto/linklore/linklore"
+)
+
+func TestParseYAML(t *testing.T) {
+	content := `# linklore config
+---
+inputFile: note.md
+outputFile: "out dir/note.md"  # quoted
+prefix: '/it''s/'
+force: true
+ignorePatterns:
+  - .git
+  - "*.out.md"
+other: [a, 'b', "c d"]
+empty:
+`
+
+	values, err := parseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("parseYAML failed: %v", err)
+	}
+
+	expected := map[string]any{
+		"inputFile":      "note.md",
+		"outputFile":     "out dir/note.md",
+		"prefix":         "/it's/",
+		"force":          "true",
+		"ignorePatterns": []string{".git", "*.out.md"},
+		"other":          []string{"a", "b", "c d"},
+		"empty":          []string{},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("parseYAML failed: got %#v, want %#v", values, expected)
+	}
+
+	for _, invalid := range []string{
+		"- orphan\n",
+		"nested:\n  key: value\n",
+		"no separator\n",
+	} {
+		if _, err := parseYAML([]byte(invalid)); err == nil {
+			t.Errorf("parseYAML failed: expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	content := `# linklore config
+inputFile = "note.md"
+outputFile = "out dir/note.md"  # quoted
+prefix = '/it"s/'
+"force" = true
+maxFiles = 1_000
+ignorePatterns = [
+  ".git",  # comment
+  "*.out.md",
+]
+other = ['a', "b#c", "d\"e"]
+empty = []
+`
+
+	values, err := parseTOML([]byte(content))
+	if err != nil {
+		t.Fatalf("parseTOML failed: %v", err)
+	}
+
+	expected := map[string]any{
+		"inputFile":      "note.md",
+		"outputFile":     "out dir/note.md",
+		"prefix":         `/it"s/`,
+		"force":          "true",
+		"maxFiles":       "1_000",
+		"ignorePatterns": []string{".git", "*.out.md"},
+		"other":          []string{"a", "b#c", `d"e`},
+		"empty":          []string{},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("parseTOML failed: got %#v, want %#v", values, expected)
+	}
+
+	for _, invalid := range []string{
+		"[table]\nkey = 1\n",
+		"no separator\n",
+		"key = bare\n",
+		"key = \"unterminated\n",
+		"key = [\"a\" \"b\"]\n",
+		"key = 1\nkey = 2\n",
+		"a.b = 1\n",
+	} {
+		if _, err := parseTOML([]byte(invalid)); err == nil {
+			t.Errorf("parseTOML failed: expected error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "linklore.yaml", `inputFile: note.md
+outputFile: note.html.md
+baseDir: vault
+prefix: /wiki/
+force: true
+ignorePatterns: [.git, drafts]
+`)
+
+	config := Config{ignorePatterns: []string{}}
+	err := loadConfigFile(&config, filepath.Join(tempDir, "linklore.yaml"))
+	if err != nil {
+		t.Fatalf("loadConfigFile failed: %v", err)
+	}
+	setDefaultValues(&config)
+
+	expected := Config{
+		inputFile:       "note.md",
+		outputFile:      "note.html.md",
+		outSuffix:       defaultOutSuffix,
+		baseDir:         "vault",
+		prefix:          "/wiki/",
+		force:           true,
+		ignorePatterns:  []string{".github", ".vscode", ".idea", ".env", "node_modules", ".obsidian", "*.out.md", ".git", "drafts"},
+		embedMode:       "link",
+		anchorStyle:     "github",
+		blockMode:       linklore.BlockModeKeep,
+		linkFormat:      linklore.LinkFormatShortest,
+		unresolvedMode:  linklore.UnresolvedModeKeep,
+		frontmatterMode: linklore.FrontmatterModeProcess,
+		selfLinkMode:    linklore.SelfLinkModeKeep,
+		pathTransform:   linklore.PathTransformNone,
+		reportFormat:    reportFormatText,
+		extractFormat:   reportFormatText,
+		ignoreStyle:     linklore.IgnoreStyleGlob,
+		template:        linklore.DefaultTemplate,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("loadConfigFile failed: got %+v, want %+v", config, expected)
+	}
+	if err := validateConfig(config); err != nil {
+		t.Errorf("validateConfig failed: %v", err)
+	}
+
+	createTestFile(tempDir, "linklore.toml", `inputFile = "note.md"
+outputFile = "note.html.md"
+baseDir = "vault"
+prefix = "/wiki/"
+force = true
+ignorePatterns = [".git", "drafts"]
+`)
+	tomlConfig := Config{ignorePatterns: []string{}}
+	err = loadConfigFile(&tomlConfig, filepath.Join(tempDir, "linklore.toml"))
+	if err != nil {
+		t.Fatalf("loadConfigFile failed for TOML: %v", err)
+	}
+	setDefaultValues(&tomlConfig)
+	if !reflect.DeepEqual(tomlConfig, expected) {
+		t.Errorf("loadConfigFile failed for TOML: got %+v, want %+v", tomlConfig, expected)
+	}
+
+	createTestFile(tempDir, "bad.yaml", "force: maybe\n")
+	if err := loadConfigFile(&config, filepath.Join(tempDir, "bad.yaml")); err == nil {
+		t.Errorf("loadConfigFile failed: expected error for invalid bool")
+	}
+	createTestFile(tempDir, "unknown.yaml", "colour: blue\n")
+	if err := loadConfigFile(&config, filepath.Join(tempDir, "unknown.yaml")); err == nil {
+		t.Errorf("loadConfigFile failed: expected error for unknown key")
+	}
+	if err := loadConfigFile(&config, filepath.Join(tempDir, "missing.yaml")); err == nil {
+		t.Errorf("loadConfigFile failed: expected error for missing explicit config file")
+	}
+}
+
+func TestFindConfigFlag(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"-i", "note.md"}, expected: ""},
+		{args: []string{"-i", "note.md", "--config", "a.yaml"}, expected: "a.yaml"},
+		{args: []string{"-config=b.yaml"}, expected: "b.yaml"},
+		{args: []string{"--", "--config", "c.yaml"}, expected: ""},
+	}
+
+	for _, test := range tests {
+		output := findConfigFlag(test.args)
+		if output != test.expected {
+			t.Errorf("Args: %v, Expected: %s, Got: %s", test.args, test.expected, output)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		old, new string
+		expected string
+	}{
+		{old: "a\nb\n", new: "a\nb\n", expected: ""},
+		{old: "", new: "x\n", expected: "--- old\n+++ new\n@@ -0,0 +1 @@\n+x\n"},
+		{
+			old: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n",
+			new: "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nK\nl\nm",
+			expected: "--- old\n+++ new\n" +
+				"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -8,6 +8,6 @@\n h\n i\n j\n-k\n+K\n l\n-m\n+m\n\\ No newline at end of file\n",
+		},
+		{
+			// Changes separated by up to twice the context share a hunk.
+			old:      "a\n1\n2\n3\n4\n5\n6\nb\n",
+			new:      "A\n1\n2\n3\n4\n5\n6\nB\n",
+			expected: "--- old\n+++ new\n@@ -1,8 +1,8 @@\n-a\n+A\n 1\n 2\n 3\n 4\n 5\n 6\n-b\n+B\n",
+		},
+	}
+	for _, test := range tests {
+		output := unifiedDiff("old", "new", test.old, test.new)
+		if output != test.expected {
+			t.Errorf("unifiedDiff(%q, %q) = %q, want %q", test.old, test.new, output, test.expected)
+		}
+	}
+}
+
+func TestProcessFileDiff(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "input.txt", "# Title\n\nSee [[a]].\n")
+	stdout, err := os.Create(filepath.Join(tempDir, "stdout"))
+	if err != nil {
+		t.Fatalf("unable to create stdout file: %v", err)
+	}
+	defer stdout.Close()
+	oldStdout := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = oldStdout }()
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "input.txt"),
+		outputFile:     filepath.Join(tempDir, "output.txt"),
+		prefix:         "/",
+		diff:           true,
+		ignorePatterns: []string{"*.txt", "stdout"},
+	}
+	setDefaultValues(&config)
+	if !config.dryRun {
+		t.Errorf("setDefaultValues failed: --diff should imply -n")
+	}
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	output, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatalf("unable to read stdout: %v", err)
+	}
+	expected := "--- " + config.inputFile + "\n+++ " + config.outputFile + "\n" +
+		"@@ -1,3 +1,3 @@\n # Title\n \n-See [[a]].\n+See [a](/a).\n"
+	if string(output) != expected {
+		t.Errorf("processFile failed: got diff %q, want %q", output, expected)
+	}
+	if _, err := os.Stat(config.outputFile); err == nil {
+		t.Errorf("processFile failed: --diff wrote an output file")
+	}
+}
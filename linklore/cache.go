@@ -0,0 +1,215 @@
+package linklore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrStaleCache is returned by ReadCache when a cached index no longer
+// matches the files on disk or the options it is read with.
+var ErrStaleCache = errors.New("index cache is stale")
+
+// indexCache is the JSON form of an index written by WriteCache.
+type indexCache struct {
+	BaseDirs []string `json:"baseDirs"`
+	// AbsDirs are the absolute paths of BaseDirs, so that a cache of
+	// relative base directories is not used from another directory.
+	AbsDirs []string     `json:"absDirs"`
+	Ignore  []string     `json:"ignore"`
+	Options IndexOptions `json:"options"`
+	Built   time.Time    `json:"built"`
+	Dirs    []walkedDir  `json:"dirs"`
+	Files   []FileInfo   `json:"files"`
+}
+
+// WriteCache writes idx to w as JSON, so that ReadCache can restore it
+// without walking the base directories again.
+func (idx Index) WriteCache(w io.Writer) error {
+	absDirs, err := absPaths(idx.baseDirs)
+	if err != nil {
+		return err
+	}
+	cache := indexCache{
+		AbsDirs:  absDirs,
+		BaseDirs: idx.baseDirs,
+		Ignore:   idx.ignore,
+		Options:  cacheOptions(idx.opts),
+		Built:    idx.built,
+		Files:    idx.Files(),
+	}
+	for _, dir := range idx.dirs {
+		cache.Dirs = append(cache.Dirs, dir)
+	}
+	sort.Slice(cache.Dirs, func(i, j int) bool {
+		return cache.Dirs[i].Path < cache.Dirs[j].Path
+	})
+	// Files are added back in walk order, so that duplicates are listed in
+	// the same order as in the original index.
+	sort.SliceStable(cache.Files, func(i, j int) bool {
+		a, b := cache.Files[i], cache.Files[j]
+		if a.Dir != b.Dir {
+			return slices.Index(idx.baseDirs, a.Dir) < slices.Index(idx.baseDirs, b.Dir)
+		}
+		return walkOrderLess(a.Path, b.Path)
+	})
+	return json.NewEncoder(w).Encode(cache)
+}
+
+// ReadCache restores an index written by WriteCache. It returns an error
+// wrapping ErrStaleCache if the index was built with other base
+// directories, ignore patterns or options, or if a file was added, removed
+// or modified since it was built.
+func ReadCache(r io.Reader, baseDirs []string, ignore []string, opts IndexOptions) (Index, error) {
+	var cache indexCache
+	if err := json.NewDecoder(r).Decode(&cache); err != nil {
+		return Index{}, fmt.Errorf("failed to read index cache: %w", err)
+	}
+
+	cachedOpts, err := json.Marshal(cache.Options)
+	if err != nil {
+		return Index{}, err
+	}
+	currentOpts, err := json.Marshal(cacheOptions(opts))
+	if err != nil {
+		return Index{}, err
+	}
+	absDirs, err := absPaths(baseDirs)
+	if err != nil {
+		return Index{}, err
+	}
+	if !slices.Equal(cache.BaseDirs, baseDirs) || !slices.Equal(cache.AbsDirs, absDirs) ||
+		!slices.Equal(cache.Ignore, ignore) || string(cachedOpts) != string(currentOpts) {
+		return Index{}, fmt.Errorf("%w: built with other options", ErrStaleCache)
+	}
+
+	matcher, err := NewMatcher(ignore, opts.IgnoreStyle)
+	if err != nil {
+		return Index{}, err
+	}
+	changed, err := cache.changed(matcher, opts)
+	if err != nil {
+		return Index{}, err
+	}
+	if changed != "" {
+		return Index{}, fmt.Errorf("%w: %s changed", ErrStaleCache, changed)
+	}
+
+	idx := newIndex(baseDirs, opts)
+	idx.ignore = ignore
+	idx.built = cache.Built
+	for _, dir := range cache.Dirs {
+		idx.dirs[dir.Path] = dir
+	}
+	for _, fileInfo := range cache.Files {
+		// An empty list of headings is not written, but tells that the
+		// headings were read.
+		if opts.Headings && fileInfo.Ext == ".md" && fileInfo.Headings == nil && fileInfo.Unparsed == "" {
+			fileInfo.Headings = []string{}
+		}
+		idx.Add(fileInfo)
+	}
+	return idx, nil
+}
+
+func absPaths(paths []string) ([]string, error) {
+	absPaths := make([]string, len(paths))
+	for i, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		absPaths[i] = absPath
+	}
+	return absPaths, nil
+}
+
+// cacheOptions returns the options that affect the content of an index.
+func cacheOptions(opts IndexOptions) IndexOptions {
+	opts.Workers = 0
+	return opts
+}
+
+// changed returns the path of a file or directory that was modified since
+// the index was built, or "" if there is none. A directory modified since
+// is read again, since adding or removing an ignored file, such as an
+// output file, modifies it too.
+func (c indexCache) changed(matcher Matcher, opts IndexOptions) (string, error) {
+	files := make(map[string]bool, len(c.Files))
+	for _, fileInfo := range c.Files {
+		path := filepath.Join(fileInfo.Dir, filepath.FromSlash(fileInfo.Path))
+		if !c.unchanged(path) {
+			return path, nil
+		}
+		files[fileInfo.Dir+"\x00"+fileInfo.Path] = true
+	}
+
+	dirs := make(map[string]bool, len(c.Dirs))
+	for _, dir := range c.Dirs {
+		dirs[dir.Path] = true
+	}
+	for _, dir := range c.Dirs {
+		if c.unchanged(dir.Path) {
+			continue
+		}
+		entries, err := os.ReadDir(dir.Path)
+		if err != nil {
+			return dir.Path, nil
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir.Path, entry.Name())
+			relativePath := filepath.Join(filepath.FromSlash(dir.Prefix), entry.Name())
+			ignored, err := matcher.Match(relativePath, entry.IsDir())
+			if err != nil {
+				return "", err
+			}
+			if ignored {
+				continue
+			}
+
+			isDir := entry.IsDir()
+			if entry.Type()&fs.ModeSymlink != 0 && opts.FollowSymlinks {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					if path, err = filepath.EvalSymlinks(path); err != nil {
+						return "", err
+					}
+					isDir = true
+				}
+			}
+			if isDir {
+				if !dirs[path] {
+					return path, nil
+				}
+				continue
+			}
+
+			included, err := isIncluded(entry.Name(), opts.Include)
+			if err != nil {
+				return "", err
+			}
+			if included && !files[dir.BaseDir+"\x00"+filepath.ToSlash(relativePath)] {
+				return path, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// mtimeSlack is how long before an index was built a modification may have
+// happened and still be missed: some file systems, such as FAT, store
+// modification times with a granularity of up to two seconds.
+const mtimeSlack = 2 * time.Second
+
+// unchanged reports whether path still exists and was not modified since
+// the index was built.
+func (c indexCache) unchanged(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.ModTime().Before(c.Built.Add(-mtimeSlack))
+}
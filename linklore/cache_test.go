@@ -0,0 +1,126 @@
+package linklore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndexCache(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	os.Mkdir(subDir, 0755)
+	createTestFile(tempDir, "note.md", "# Title\n")
+	createTestFile(subDir, "note.md", "")
+	createTestFile(subDir, "image.png", "")
+	createTestFile(tempDir, "draft.md", "")
+
+	ignore := []string{"draft.md", "*.out.md"}
+	opts := IndexOptions{Headings: true, PriorityDirs: []string{"sub"}}
+
+	// setup backdates every file, so that the changes made by a test case
+	// are newer than the index however coarse the file system times are.
+	past := time.Now().Add(-time.Hour)
+	setup := func() {
+		filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				os.Chtimes(path, past, past)
+			}
+			return err
+		})
+	}
+	setup()
+
+	tests := []struct {
+		name   string
+		change func()
+		stale  bool
+	}{
+		{name: "unchanged", change: func() {}},
+		{name: "ignored file added", change: func() { createTestFile(tempDir, "note.out.md", "") }},
+		{name: "file modified", change: func() { createTestFile(tempDir, "note.md", "# Other\n") }, stale: true},
+		{name: "file added", change: func() { createTestFile(subDir, "new.md", "") }, stale: true},
+		{name: "file removed", change: func() { os.Remove(filepath.Join(subDir, "image.png")) }, stale: true},
+		{name: "directory added", change: func() { os.Mkdir(filepath.Join(subDir, "new"), 0755) }, stale: true},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			opts.Workers = workers
+			idx, err := BuildIndexWithOptions(tempDir, ignore, opts)
+			if err != nil {
+				t.Fatalf("BuildIndexWithOptions failed: %v", err)
+			}
+			idx.built = time.Now()
+			var cache bytes.Buffer
+			if err := idx.WriteCache(&cache); err != nil {
+				t.Fatalf("WriteCache failed: %v", err)
+			}
+
+			test.change()
+			cached, err := ReadCache(&cache, []string{tempDir}, ignore, IndexOptions{Headings: true, PriorityDirs: []string{"sub"}})
+			if test.stale {
+				if !errors.Is(err, ErrStaleCache) {
+					t.Errorf("ReadCache failed for %s with %d workers: expected stale cache, got %v", test.name, workers, err)
+				}
+			} else if err != nil {
+				t.Errorf("ReadCache failed for %s with %d workers: %v", test.name, workers, err)
+			} else {
+				if !reflect.DeepEqual(cached.Files(), idx.Files()) {
+					t.Errorf("ReadCache failed for %s: got files %v, want %v", test.name, cached.Files(), idx.Files())
+				}
+				if fileInfo, err := cached.Resolve("note"); err != nil || fileInfo.Path != "sub/note.md" {
+					t.Errorf("ReadCache failed for %s: note resolved to %v, %v", test.name, fileInfo.Path, err)
+				}
+			}
+
+			// Undo the change for the next case.
+			os.Remove(filepath.Join(tempDir, "note.out.md"))
+			os.Remove(filepath.Join(subDir, "new.md"))
+			os.Remove(filepath.Join(subDir, "new"))
+			createTestFile(subDir, "image.png", "")
+			setup()
+		}
+	}
+}
+
+func TestIndexCacheOptions(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "")
+	idx, err := BuildIndexWithOptions(tempDir, []string{"*.out.md"}, IndexOptions{})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	var cache bytes.Buffer
+	if err := idx.WriteCache(&cache); err != nil {
+		t.Fatalf("WriteCache failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		baseDirs []string
+		ignore   []string
+		opts     IndexOptions
+	}{
+		{name: "base directories", baseDirs: []string{tempDir, tempDir}, ignore: []string{"*.out.md"}},
+		{name: "ignore patterns", baseDirs: []string{tempDir}, ignore: nil},
+		{name: "options", baseDirs: []string{tempDir}, ignore: []string{"*.out.md"}, opts: IndexOptions{CaseInsensitive: true}},
+	}
+	for _, test := range tests {
+		_, err := ReadCache(bytes.NewReader(cache.Bytes()), test.baseDirs, test.ignore, test.opts)
+		if !errors.Is(err, ErrStaleCache) {
+			t.Errorf("ReadCache failed for other %s: expected stale cache, got %v", test.name, err)
+		}
+	}
+
+	if _, err := ReadCache(bytes.NewReader([]byte("{")), []string{tempDir}, nil, IndexOptions{}); err == nil || errors.Is(err, ErrStaleCache) {
+		t.Errorf("ReadCache failed: expected a decoding error, got %v", err)
+	}
+}
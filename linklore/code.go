@@ -0,0 +1,101 @@
+package linklore
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FindLinks returns the location of each match of pattern in content, like
+// FindAllStringIndex, leaving out the matches inside fenced code blocks and
+// inline code spans: a wikilink in code is an example, not a link.
+func FindLinks(pattern *regexp.Regexp, content string) [][]int {
+	matches := pattern.FindAllStringIndex(content, -1)
+	code := codeRanges(content)
+	if len(code) == 0 {
+		return matches
+	}
+
+	links := matches[:0]
+	i := 0
+	for _, match := range matches {
+		for i < len(code) && code[i][1] <= match[0] {
+			i++
+		}
+		if i < len(code) && code[i][0] < match[1] {
+			continue
+		}
+		links = append(links, match)
+	}
+	return links
+}
+
+// codeRanges returns the byte ranges [start, end) of the fenced code blocks
+// and inline code spans of content, in order. An unclosed fence runs to the
+// end of content, while an unmatched backtick run is literal text.
+func codeRanges(content string) [][2]int {
+	var ranges [][2]int
+	fence, fenceStart := "", 0
+	textStart := 0
+	for lineStart := 0; lineStart < len(content); {
+		lineEnd := len(content)
+		if i := strings.IndexByte(content[lineStart:], '\n'); i >= 0 {
+			lineEnd = lineStart + i + 1
+		}
+		if submatches := codeFencePattern.FindStringSubmatch(content[lineStart:lineEnd]); submatches != nil {
+			switch fence {
+			case "":
+				ranges = append(ranges, codeSpans(content, textStart, lineStart)...)
+				fence, fenceStart = submatches[1], lineStart
+			case submatches[1]:
+				ranges = append(ranges, [2]int{fenceStart, lineEnd})
+				fence, textStart = "", lineEnd
+			}
+		}
+		lineStart = lineEnd
+	}
+	if fence != "" {
+		return append(ranges, [2]int{fenceStart, len(content)})
+	}
+	return append(ranges, codeSpans(content, textStart, len(content))...)
+}
+
+// codeSpans returns the ranges of the inline code spans in content[start:end].
+// A span opens with a run of backticks and closes with the next run of the
+// same length.
+func codeSpans(content string, start, end int) [][2]int {
+	var spans [][2]int
+	for i := start; i < end; {
+		if content[i] != '`' {
+			i++
+			continue
+		}
+		open := backtickRun(content, i, end)
+		closed := false
+		for j := i + open; j < end; {
+			if content[j] != '`' {
+				j++
+				continue
+			}
+			run := backtickRun(content, j, end)
+			if run == open {
+				spans = append(spans, [2]int{i, j + run})
+				i, closed = j+run, true
+				break
+			}
+			j += run
+		}
+		if !closed {
+			i += open
+		}
+	}
+	return spans
+}
+
+// backtickRun returns the number of backticks starting at content[i].
+func backtickRun(content string, i, end int) int {
+	n := 0
+	for i+n < end && content[i+n] == '`' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package linklore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindLinks(t *testing.T) {
+	pattern := Options{}.pattern()
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{name: "no code", content: "[[a]] [[b]]", expected: []string{"[[a]]", "[[b]]"}},
+		{name: "inline code", content: "[[a]] `[[b]]` [[c]]", expected: []string{"[[a]]", "[[c]]"}},
+		{name: "double backticks", content: "``x ` [[a]]`` [[b]]", expected: []string{"[[b]]"}},
+		{name: "unmatched backtick", content: "` [[a]]", expected: []string{"[[a]]"}},
+		{name: "fenced block", content: "[[a]]\n```md\n[[b]]\n```\n[[c]]\n", expected: []string{"[[a]]", "[[c]]"}},
+		{name: "tilde fence", content: "~~~\n[[a]]\n```\n[[b]]\n~~~\n[[c]]", expected: []string{"[[c]]"}},
+		{name: "unclosed fence", content: "[[a]]\n```\n[[b]]\n", expected: []string{"[[a]]"}},
+		{name: "backtick in fence", content: "```\n`\n```\n[[a]] `b`", expected: []string{"[[a]]"}},
+	}
+	for _, test := range tests {
+		var links []string
+		for _, loc := range FindLinks(pattern, test.content) {
+			links = append(links, test.content[loc[0]:loc[1]])
+		}
+		if !reflect.DeepEqual(links, test.expected) {
+			t.Errorf("FindLinks failed for %s: got %q, want %q", test.name, links, test.expected)
+		}
+	}
+}
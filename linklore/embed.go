@@ -0,0 +1,134 @@
+package linklore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxEmbedDepth is the default for Options.MaxEmbedDepth.
+const DefaultMaxEmbedDepth = 5
+
+// EmbedError is returned by ReplaceLink, wrapped in a *LinkError, for an
+// embed inlined with EmbedModeInline whose content has links that could not
+// be rewritten. The embed is still inlined, with those links handled as
+// Rewrite does, and Errs holds their errors, which Rewrite reports in place
+// of the embed's.
+type EmbedError struct {
+	Errs []error
+}
+
+func (e *EmbedError) Error() string {
+	return fmt.Sprintf("%d link(s) of the embedded content not rewritten", len(e.Errs))
+}
+
+// embedContext describes the content being rewritten when it is inlined by
+// embeds. The zero value describes the file being rewritten itself.
+type embedContext struct {
+	// depth is the number of embeds the content is inlined in.
+	depth int
+	// source is the Source of the file the content is inlined in, which
+	// relative links are written from. Empty means Options.Source.
+	source string
+}
+
+// linkSource returns the path relative links are written from.
+func (embed embedContext) linkSource(opts Options) string {
+	if embed.source != "" {
+		return embed.source
+	}
+	return opts.Source
+}
+
+// embeddedContent returns the content of the Markdown file fileInfo that an
+// embed inlines: the section under the heading anchor, the block block, or
+// the whole file. It reports false if the heading or the block is not found.
+func embeddedContent(fileInfo FileInfo, anchor, block string, idx Index, opts Options) (string, bool, error) {
+	dir := fileInfo.Dir
+	if dir == "" {
+		dir = idx.BaseDir()
+	}
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(fileInfo.Path)))
+	if err != nil {
+		return "", false, err
+	}
+	// The frontmatter holds metadata of the note, not its content, and its
+	// lines are neither headings nor blocks.
+	content := string(data)
+	content = content[FrontmatterEnd(content):]
+	found := true
+	switch {
+	case block != "":
+		content, found = extractBlock(content, block)
+	case anchor != "":
+		content, found = extractSection(content, anchor, opts)
+	}
+	return content, found, nil
+}
+
+// extractSection returns the section of content under the ATX heading
+// anchor refers to, compared by their slugs in the anchor style of opts, so
+// that the embed and a link to the same heading agree: the heading line and
+// the lines up to the next heading of the same or a higher level. Headings
+// inside fenced code blocks are not headings.
+func extractSection(content, anchor string, opts Options) (string, bool) {
+	slug := slugifyAnchor(anchor, opts)
+	lines := strings.SplitAfter(content, "\n")
+	start, level := -1, 0
+	var fence fenceState
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r\n")
+		if fence.skip(line) {
+			continue
+		}
+		submatches := atxHeadingPattern.FindStringSubmatch(line)
+		if submatches == nil {
+			continue
+		}
+		// The level is the number of # after the indentation.
+		hashes := strings.TrimLeft(line, " ")
+		headingLevel := len(hashes) - len(strings.TrimLeft(hashes, "#"))
+		switch {
+		case start >= 0 && headingLevel <= level:
+			return strings.Join(lines[start:i], ""), true
+		case start < 0 && slugifyAnchor(strings.TrimSpace(submatches[1]), opts) == slug:
+			start, level = i, headingLevel
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.Join(lines[start:], ""), true
+}
+
+// extractBlock returns the paragraph or list of content marked with the
+// block ID block, either at the end of its last line, as in "Text ^abc123",
+// or on a line of its own after it. The ID itself is removed.
+func extractBlock(content, block string) (string, bool) {
+	marker := "^" + block
+	lines := strings.Split(content, "\n")
+	var fence fenceState
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if fence.skip(line) || line != marker && !strings.HasSuffix(line, " "+marker) {
+			continue
+		}
+		end := i
+		if line != marker {
+			lines[i] = strings.TrimRight(strings.TrimSuffix(line, marker), " \t")
+			end = i + 1
+		}
+		// An ID on its own line may be separated from its block, such as a
+		// list, by a blank line.
+		for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		start := end
+		for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+			start--
+		}
+		return strings.Join(lines[start:end], "\n"), true
+	}
+	return "", false
+}
@@ -0,0 +1,175 @@
+package linklore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractSection(t *testing.T) {
+	content := "# Title\n\nIntro\n\n## Setup\n\nInstall it.\n\n### Linux\n\napt install\n\n```sh\n# not a heading\n```\n\n## Usage\n\nRun it.\n"
+
+	tests := []struct {
+		anchor   string
+		expected string
+		found    bool
+	}{
+		{anchor: "Setup", expected: "## Setup\n\nInstall it.\n\n### Linux\n\napt install\n\n```sh\n# not a heading\n```\n\n", found: true},
+		{anchor: "linux", expected: "### Linux\n\napt install\n\n```sh\n# not a heading\n```\n\n", found: true},
+		{anchor: "Usage", expected: "## Usage\n\nRun it.\n", found: true},
+		{anchor: "Title", expected: content, found: true},
+		{anchor: "not a heading", found: false},
+		{anchor: "Missing", found: false},
+	}
+	for _, test := range tests {
+		section, found := extractSection(content, test.anchor, Options{SlugifyAnchors: true})
+		if found != test.found || section != test.expected {
+			t.Errorf("Anchor: %s, Expected: %q (%v), Got: %q (%v)", test.anchor, test.expected, test.found, section, found)
+		}
+	}
+}
+
+func TestExtractSectionAnchorStyle(t *testing.T) {
+	content := "# Notes\n\n## What's new?\n\nNews\n\n## Whats new\n\nOther news\n"
+
+	tests := []struct {
+		opts     Options
+		anchor   string
+		expected string
+		found    bool
+	}{
+		{opts: Options{SlugifyAnchors: true}, anchor: "whats-new", expected: "## What's new?\n\nNews\n\n", found: true},
+		{opts: Options{}, anchor: "What's new?", expected: "## What's new?\n\nNews\n\n", found: true},
+		{opts: Options{}, anchor: "Whats new", expected: "## Whats new\n\nOther news\n", found: true},
+		{opts: Options{}, anchor: "whats-new", found: false},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleObsidian}, anchor: "What's  new?", expected: "## What's new?\n\nNews\n\n", found: true},
+	}
+	for _, test := range tests {
+		section, found := extractSection(content, test.anchor, test.opts)
+		if found != test.found || section != test.expected {
+			t.Errorf("Options: %+v, Anchor: %s, Expected: %q (%v), Got: %q (%v)", test.opts, test.anchor, test.expected, test.found, section, found)
+		}
+	}
+}
+
+func TestExtractBlock(t *testing.T) {
+	content := "First paragraph\ncontinues here ^first\n\n- item one\n- item two\n\n^list\n\n```\nCode ^code\n```\n"
+
+	tests := []struct {
+		block    string
+		expected string
+		found    bool
+	}{
+		{block: "first", expected: "First paragraph\ncontinues here", found: true},
+		{block: "list", expected: "- item one\n- item two", found: true},
+		{block: "code", found: false},
+		{block: "missing", found: false},
+	}
+	for _, test := range tests {
+		text, found := extractBlock(content, test.block)
+		if found != test.found || text != test.expected {
+			t.Errorf("Block: %s, Expected: %q (%v), Got: %q (%v)", test.block, test.expected, test.found, text, found)
+		}
+	}
+}
+
+func TestReplaceLinkInlineSection(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "# Note\n\n## Setup\n\nSee [[other]].\n\n## Usage\n\nRun it. ^run\n")
+	createTestFile(tempDir, "other.md", "Other")
+	createTestFile(tempDir, "outer.md", "Outer\n\n![[note#Usage]]\n")
+	createTestFile(tempDir, "a.md", "A ![[b]]")
+	createTestFile(tempDir, "b.md", "B ![[a]]")
+	createTestFile(tempDir, "meta.md", "---\nsummary: |\n  # Usage\n  Not a heading.\n---\n# Meta\n\n## Usage\n\nRun it.\n")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	opts := Options{Prefix: "/", EmbedMode: EmbedModeInline}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "![[note#Setup]]", expected: "## Setup\n\nSee [other](/other)."},
+		{input: "![[note#Usage]]", expected: "## Usage\n\nRun it. ^run"},
+		{input: "![[note^run]]", expected: "Run it."},
+		{input: "![[outer]]", expected: "Outer\n\n## Usage\n\nRun it. ^run"},
+		{input: "![[meta#Usage]]", expected: "## Usage\n\nRun it."},
+	}
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %q, Got: %q", test.input, test.expected, output)
+		}
+	}
+
+	output, err := ReplaceLink("![[note#Missing]]", idx, opts)
+	if !errors.Is(err, ErrAnchorNotFound) || output != "[note](/note#Missing)" {
+		t.Errorf("ReplaceLink failed for a missing section: got %q, %v", output, err)
+	}
+
+	// a and b embed each other: the embed at the depth limit is kept and
+	// reported.
+	opts.MaxEmbedDepth = 3
+	output, err = ReplaceLink("![[a]]", idx, opts)
+	var embedErr *EmbedError
+	if !errors.As(err, &embedErr) || len(embedErr.Errs) != 1 || !errors.Is(embedErr.Errs[0], ErrEmbedTooDeep) {
+		t.Errorf("ReplaceLink failed for embeds nested in a cycle: expected ErrEmbedTooDeep, got %v", err)
+	}
+	if expected := "A B A ![[b]]"; output != expected {
+		t.Errorf("ReplaceLink failed for embeds nested in a cycle: Expected: %q, Got: %q", expected, output)
+	}
+	opts.MaxEmbedDepth = 0
+	if _, err := replaceLink("![[a]]", idx, opts, embedContext{depth: DefaultMaxEmbedDepth}); !errors.Is(err, ErrEmbedTooDeep) {
+		t.Errorf("ReplaceLink failed: expected ErrEmbedTooDeep at the depth limit, got %v", err)
+	}
+}
+
+func TestRewriteInlineNested(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0755)
+	createTestFile(tempDir, "other.md", "")
+	createTestFile(tempDir, "sub/other.md", "")
+	createTestFile(tempDir, "sub/note.md", "See [[other]] and [[note#Top]].\n")
+	createTestFile(tempDir, "sub/broken.md", "See [[missing]] and [[other]].\n")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	// The links of the embedded note are resolved from sub/note.md, where
+	// [[note]] is a self-link, but written from outer.md.
+	opts := Options{EmbedMode: EmbedModeInline, LinkFormat: LinkFormatRelative, RelativeLinks: true, SelfLinkMode: SelfLinkModeWarn, Source: "outer.md"}
+	output, errs := Rewrite("![[sub/note]]", idx, opts)
+	if expected := "See [other](sub/other) and [note](sub/note#Top)."; output != expected {
+		t.Errorf("Rewrite failed: Expected: %q, Got: %q", expected, output)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrSelfLink) {
+		t.Errorf("Rewrite failed: expected the self-link of the embedded note, got %v", errs)
+	}
+
+	// The links of the embedded note that are not rewritten are reported.
+	opts = Options{Prefix: "/", EmbedMode: EmbedModeInline, Source: "outer.md"}
+	output, errs = Rewrite("![[broken]]", idx, opts)
+	if expected := "See [[missing]] and [[other]]."; output != expected {
+		t.Errorf("Rewrite failed: Expected: %q, Got: %q", expected, output)
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrLinkNotFound) || !errors.Is(errs[1], ErrAmbiguousLink) {
+		t.Errorf("Rewrite failed: expected the errors of the embedded links, got %v", errs)
+	}
+	var embedErr *EmbedError
+	if _, err := ReplaceLink("![[broken]]", idx, opts); !errors.As(err, &embedErr) || len(embedErr.Errs) != 2 {
+		t.Errorf("ReplaceLink failed: expected an *EmbedError with 2 errors, got %v", err)
+	}
+}
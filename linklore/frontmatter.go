@@ -0,0 +1,154 @@
+package linklore
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Frontmatter modes select whether links inside the YAML frontmatter of a
+// file are rewritten.
+const (
+	// FrontmatterModeProcess rewrites the links of the frontmatter like those
+	// of the body.
+	FrontmatterModeProcess = "process"
+	// FrontmatterModeSkip passes the frontmatter through verbatim.
+	FrontmatterModeSkip = "skip"
+)
+
+// FrontmatterEnd returns the length of the YAML frontmatter content starts
+// with, including its closing line, or 0 if it has none. Frontmatter opens
+// with a "---" line and closes with the next "---" or "..." line.
+func FrontmatterEnd(content string) int {
+	start := len(content) - len(strings.TrimPrefix(content, "\uFEFF"))
+	line, rest, found := strings.Cut(content[start:], "\n")
+	if !found || strings.TrimRight(line, " \t\r") != "---" {
+		return 0
+	}
+
+	end := len(content) - len(rest)
+	for end < len(content) {
+		line, _, found := strings.Cut(content[end:], "\n")
+		end += len(line)
+		if found {
+			end++
+		}
+		switch strings.TrimRight(line, " \t\r") {
+		case "---", "...":
+			return end
+		}
+	}
+	return 0
+}
+
+// readFrontmatter returns the fields of the frontmatter of the file at path,
+// or nil if it has none.
+func readFrontmatter(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseFrontmatter(file)
+}
+
+// parseFrontmatter parses the flat subset of YAML used by note frontmatter:
+// top-level "key: value" pairs whose values are scalars, flow lists
+// ("[a, b]") or block lists ("- a" items on the following lines). A scalar
+// is returned as a list of one value. Nested mappings are skipped. It
+// returns nil if r does not start with a frontmatter block.
+func parseFrontmatter(r io.Reader) (map[string][]string, error) {
+	scanner := newLineScanner(r)
+	if !scanner.Scan() || strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\uFEFF"), " \t") != "---" {
+		return nil, scanner.Err()
+	}
+
+	fields := make(map[string][]string)
+	var listKey string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		switch line {
+		case "---", "...":
+			return fields, nil
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			if listKey != "" {
+				item := unquoteYAML(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+				fields[listKey] = append(fields[listKey], item)
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+
+		listKey = ""
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "":
+			fields[key] = nil
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			var items []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, unquoteYAML(item))
+				}
+			}
+			fields[key] = items
+		default:
+			fields[key] = []string{unquoteYAML(value)}
+		}
+	}
+	// A frontmatter block that is never closed is not frontmatter.
+	return nil, scanner.Err()
+}
+
+func unquoteYAML(value string) string {
+	if len(value) < 2 {
+		return value
+	}
+	switch {
+	case value[0] == '"' && value[len(value)-1] == '"':
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+	case value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	return value
+}
+
+// addFrontmatter reads the title and the aliases of fileInfo, found at
+// path, from its frontmatter if opts asks for them and it is a Markdown file.
+func addFrontmatter(fileInfo FileInfo, path string, opts IndexOptions) (FileInfo, error) {
+	if !opts.Titles && !opts.Aliases || fileInfo.Ext != ".md" {
+		return fileInfo, nil
+	}
+	fields, err := readFrontmatter(path)
+	if err != nil {
+		return fileInfo, err
+	}
+	if title := fields["title"]; opts.Titles && len(title) == 1 {
+		fileInfo.Title = title[0]
+	}
+	if opts.Aliases {
+		for _, alias := range fields["aliases"] {
+			if alias != "" {
+				fileInfo.Aliases = append(fileInfo.Aliases, alias)
+			}
+		}
+	}
+	return fileInfo, nil
+}
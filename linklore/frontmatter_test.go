@@ -0,0 +1,93 @@
+package linklore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrontmatterEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected int
+	}{
+		{name: "frontmatter", content: "---\ntitle: Note\n---\nbody", expected: 20},
+		{name: "dots", content: "---\ntitle: Note\n...\nbody", expected: 20},
+		{name: "crlf", content: "---\r\ntitle: Note\r\n---\r\nbody", expected: 23},
+		{name: "end of content", content: "---\ntitle: Note\n---", expected: 19},
+		{name: "bom", content: "\uFEFF---\n---\nbody", expected: 11},
+		{name: "unclosed", content: "---\ntitle: Note\n", expected: 0},
+		{name: "not at start", content: "\n---\ntitle: Note\n---\n", expected: 0},
+		{name: "thematic break", content: "----\ntext\n---\n", expected: 0},
+		{name: "none", content: "body", expected: 0},
+	}
+	for _, test := range tests {
+		if end := FrontmatterEnd(test.content); end != test.expected {
+			t.Errorf("FrontmatterEnd failed for %s: got %d, want %d", test.name, end, test.expected)
+		}
+	}
+}
+
+func TestRewriteFrontmatterMode(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+	input := "---\nrelated: \"[[note]]\"\n---\n\nSee [[note]].\n"
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{mode: "", expected: "---\nrelated: \"[note](/note)\"\n---\n\nSee [note](/note).\n"},
+		{mode: FrontmatterModeProcess, expected: "---\nrelated: \"[note](/note)\"\n---\n\nSee [note](/note).\n"},
+		{mode: FrontmatterModeSkip, expected: "---\nrelated: \"[[note]]\"\n---\n\nSee [note](/note).\n"},
+	}
+	for _, test := range tests {
+		output, errs := Rewrite(input, idx, Options{Prefix: "/", FrontmatterMode: test.mode})
+		if len(errs) > 0 {
+			t.Errorf("Mode: %s, unexpected errors: %v", test.mode, errs)
+		}
+		if output != test.expected {
+			t.Errorf("Mode: %s, Expected: %q, Got: %q", test.mode, test.expected, output)
+		}
+	}
+}
+
+func TestParseFrontmatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string][]string
+	}{
+		{
+			name:     "scalars",
+			content:  "---\ntitle: My Note\nquoted: \"a: b\"\nsingle: 'it''s'\n---\nbody",
+			expected: map[string][]string{"title": {"My Note"}, "quoted": {"a: b"}, "single": {"it's"}},
+		},
+		{
+			name:     "lists",
+			content:  "---\naliases: [foo, \"bar, baz\"]\ntags:\n  - one\n  - two\nempty: []\n...\n",
+			expected: map[string][]string{"aliases": {"foo", "\"bar", "baz\""}, "tags": {"one", "two"}, "empty": nil},
+		},
+		{
+			name:     "nested mapping and comments",
+			content:  "---\n# comment\nmeta:\n  author: me\ntitle: Note\n---\n",
+			expected: map[string][]string{"meta": nil, "title": {"Note"}},
+		},
+		{
+			name:     "long line",
+			content:  "---\ndescription: " + strings.Repeat("x", 100<<10) + "\ntitle: Note\n---\n",
+			expected: map[string][]string{"description": {strings.Repeat("x", 100<<10)}, "title": {"Note"}},
+		},
+		{name: "unclosed", content: "---\ntitle: Note\n", expected: nil},
+		{name: "none", content: "title: Note\n", expected: nil},
+	}
+	for _, test := range tests {
+		fields, err := parseFrontmatter(strings.NewReader(test.content))
+		if err != nil {
+			t.Errorf("parseFrontmatter failed for %s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("parseFrontmatter failed for %s: got %q, want %q", test.name, fields, test.expected)
+		}
+	}
+}
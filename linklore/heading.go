@@ -0,0 +1,100 @@
+package linklore
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Match up to three spaces of indentation, one to six #, and the heading
+	// text separated by whitespace, without the optional closing #s.
+	atxHeadingPattern = regexp.MustCompile(`^ {0,3}#{1,6}(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	// Match the opening or closing line of a fenced code block.
+	codeFencePattern = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// HasHeading reports whether anchor names one of the headings of the file.
+// Anchors and headings are compared by their GitHub-style slugs, so
+// "My Heading!" matches "# My heading".
+func (fi FileInfo) HasHeading(anchor string) bool {
+	slug := slugifyGitHub(anchor)
+	for _, heading := range fi.Headings {
+		if heading == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// readHeadings returns the slugs of the ATX headings of the Markdown file at
+// path, in order. Lines inside fenced code blocks are skipped.
+func readHeadings(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseHeadings(file)
+}
+
+func parseHeadings(r io.Reader) ([]string, error) {
+	headings := []string{}
+	var fence fenceState
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fence.skip(line) {
+			continue
+		}
+		if submatches := atxHeadingPattern.FindStringSubmatch(line); submatches != nil {
+			headings = append(headings, slugifyGitHub(strings.TrimSpace(submatches[1])))
+		}
+	}
+	return headings, scanner.Err()
+}
+
+// newLineScanner returns a scanner of the lines of r, however long they
+// are: the size of the files parsed is already bounded by
+// IndexOptions.MaxParseSize.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, math.MaxInt)
+	return scanner
+}
+
+// fenceState is the fence of the fenced code block the lines read so far
+// are in, or "" outside of one.
+type fenceState string
+
+// skip reports whether line opens, closes or is inside a fenced code block,
+// updating the state.
+func (f *fenceState) skip(line string) bool {
+	if submatches := codeFencePattern.FindStringSubmatch(line); submatches != nil {
+		switch *f {
+		case "":
+			*f = fenceState(submatches[1])
+		case fenceState(submatches[1]):
+			*f = ""
+		}
+		return true
+	}
+	return *f != ""
+}
+
+// addHeadings reads the headings of fileInfo, found at path, if opts asks
+// for them and it is a Markdown file.
+func addHeadings(fileInfo FileInfo, path string, opts IndexOptions) (FileInfo, error) {
+	if !opts.Headings || fileInfo.Ext != ".md" {
+		return fileInfo, nil
+	}
+	headings, err := readHeadings(path)
+	if err != nil {
+		return fileInfo, err
+	}
+	fileInfo.Headings = headings
+	return fileInfo, nil
+}
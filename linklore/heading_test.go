@@ -0,0 +1,62 @@
+package linklore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeadings(t *testing.T) {
+	content := `# Title
+Some text.
+## Second Heading ##
+   ### Indented!
+#NotAHeading
+####### Too deep
+` + "```" + `
+# Inside code
+` + "```" + `
+#### C++ & Go
+`
+
+	headings, err := parseHeadings(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseHeadings failed: %v", err)
+	}
+	expected := []string{"title", "second-heading", "indented", "c--go"}
+	if !reflect.DeepEqual(headings, expected) {
+		t.Errorf("parseHeadings failed: got %v, want %v", headings, expected)
+	}
+}
+
+func TestParseHeadingsLongLine(t *testing.T) {
+	// The line is longer than the default limit of bufio.Scanner.
+	content := "# Title\n" + strings.Repeat("x", 100<<10) + "\n## After\n"
+	headings, err := parseHeadings(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseHeadings failed: %v", err)
+	}
+	expected := []string{"title", "after"}
+	if !reflect.DeepEqual(headings, expected) {
+		t.Errorf("parseHeadings failed: got %v, want %v", headings, expected)
+	}
+}
+
+func TestFileInfoHasHeading(t *testing.T) {
+	fileInfo := FileInfo{Headings: []string{"title", "second-heading"}}
+	tests := []struct {
+		anchor   string
+		expected bool
+	}{
+		{anchor: "Title", expected: true},
+		{anchor: "Second Heading", expected: true},
+		{anchor: "second heading!", expected: true},
+		{anchor: "Missing Heading", expected: false},
+	}
+
+	for _, test := range tests {
+		if fileInfo.HasHeading(test.anchor) != test.expected {
+			t.Errorf("Anchor: %q, Expected: %v", test.anchor, test.expected)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package linklore
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ignore styles select how ignore patterns are matched.
+const (
+	// IgnoreStyleGlob matches the name of each file or directory with
+	// filepath.Match. A pattern containing a "/", such as
+	// "docs/node_modules", is matched against the path relative to the
+	// walked directory too.
+	IgnoreStyleGlob = "glob"
+	// IgnoreStyleGitignore matches the path relative to the walked directory
+	// like a .gitignore file: "**" spans directories, a pattern containing a
+	// "/" is anchored to the walked directory, a trailing "/" matches
+	// directories only and a leading "!" re-includes a path.
+	IgnoreStyleGitignore = "gitignore"
+)
+
+// Matcher matches files and directories against ignore patterns.
+type Matcher struct {
+	patterns  []string
+	gitignore []gitignorePattern
+}
+
+type gitignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewMatcher compiles patterns for the given style, one of the IgnoreStyle
+// constants. Empty means IgnoreStyleGlob.
+func NewMatcher(patterns []string, style string) (Matcher, error) {
+	switch style {
+	case "", IgnoreStyleGlob:
+		return Matcher{patterns: patterns}, nil
+	case IgnoreStyleGitignore:
+		m := Matcher{gitignore: make([]gitignorePattern, 0, len(patterns))}
+		for _, pattern := range patterns {
+			compiled, err := compileGitignore(pattern)
+			if err != nil {
+				return Matcher{}, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			}
+			m.gitignore = append(m.gitignore, compiled)
+		}
+		return m, nil
+	}
+	return Matcher{}, fmt.Errorf("unknown ignore style: %s", style)
+}
+
+// Match reports whether the file or directory at relativePath, relative to
+// the walked directory, is matched. The walked directory itself, ".", is
+// only matched by name in the glob style.
+func (m Matcher) Match(relativePath string, isDir bool) (bool, error) {
+	relativePath = filepath.ToSlash(relativePath)
+	if m.gitignore == nil {
+		return matchGlob(relativePath, m.patterns)
+	}
+	if relativePath == "." {
+		return false, nil
+	}
+
+	// As in .gitignore files, the last matching pattern wins.
+	matched := false
+	for _, pattern := range m.gitignore {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.re.MatchString(relativePath) {
+			matched = !pattern.negate
+		}
+	}
+	return matched, nil
+}
+
+// matchGlob matches the name of the file at relativePath against patterns,
+// then its whole path against the patterns containing a "/", which no name
+// matches. A leading "/" or "./" of such a pattern is ignored.
+func matchGlob(relativePath string, patterns []string) (bool, error) {
+	ignored, err := IsIgnored(path.Base(relativePath), patterns)
+	if ignored || err != nil {
+		return ignored, err
+	}
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if !strings.Contains(pattern, "/") {
+			continue
+		}
+		pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "./"), "/")
+		matched, err := path.Match(pattern, relativePath)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compileGitignore translates a gitignore pattern into a regular expression
+// matching slash separated relative paths.
+func compileGitignore(pattern string) (gitignorePattern, error) {
+	var compiled gitignorePattern
+	if strings.HasPrefix(pattern, "!") {
+		compiled.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		compiled.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	// A pattern without a "/" matches at any depth.
+	if !strings.Contains(pattern, "/") {
+		expr.WriteString("(?:.*/)?")
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return gitignorePattern{}, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return gitignorePattern{}, err
+	}
+	compiled.re = re
+	return compiled, nil
+}
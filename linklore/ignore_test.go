@@ -0,0 +1,103 @@
+package linklore
+
+import "testing"
+
+func TestMatcherGitignore(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{pattern: "temp", path: "temp", isDir: true, expected: true},
+		{pattern: "temp", path: "a/b/temp", isDir: true, expected: true},
+		{pattern: "temp", path: "a/temporary", expected: false},
+		{pattern: "*.log", path: "a/b/debug.log", expected: true},
+		{pattern: "/temp", path: "temp", isDir: true, expected: true},
+		{pattern: "/temp", path: "a/temp", isDir: true, expected: false},
+		{pattern: "drafts/**", path: "drafts/a/b.md", expected: true},
+		{pattern: "drafts/**", path: "notes/drafts/b.md", expected: false},
+		{pattern: "**/temp", path: "temp", isDir: true, expected: true},
+		{pattern: "**/temp", path: "a/b/temp", isDir: true, expected: true},
+		{pattern: "a/**/b", path: "a/b", isDir: true, expected: true},
+		{pattern: "a/**/b", path: "a/x/y/b", isDir: true, expected: true},
+		{pattern: "a/*.md", path: "a/b/c.md", expected: false},
+		{pattern: "build/", path: "build", isDir: true, expected: true},
+		{pattern: "build/", path: "build", expected: false},
+		{pattern: "note[0-9].md", path: "x/note1.md", expected: true},
+		{pattern: "note[!0-9].md", path: "x/note1.md", expected: false},
+		{pattern: "*", path: ".", isDir: true, expected: false},
+	}
+
+	for _, test := range tests {
+		m, err := NewMatcher([]string{test.pattern}, IgnoreStyleGitignore)
+		if err != nil {
+			t.Fatalf("NewMatcher failed for %s: %v", test.pattern, err)
+		}
+		matched, err := m.Match(test.path, test.isDir)
+		if err != nil {
+			t.Errorf("Match failed for %s, %s: %v", test.pattern, test.path, err)
+		}
+		if matched != test.expected {
+			t.Errorf("Pattern: %s, Path: %s, Expected: %v, Got: %v", test.pattern, test.path, test.expected, matched)
+		}
+	}
+}
+
+func TestMatcherGitignoreNegate(t *testing.T) {
+	m, err := NewMatcher([]string{"*.md", "!keep.md"}, IgnoreStyleGitignore)
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+	for path, expected := range map[string]bool{"a.md": true, "sub/keep.md": false, "a.png": false} {
+		matched, _ := m.Match(path, false)
+		if matched != expected {
+			t.Errorf("Path: %s, Expected: %v, Got: %v", path, expected, matched)
+		}
+	}
+
+	if _, err := NewMatcher([]string{"note[0-9"}, IgnoreStyleGitignore); err == nil {
+		t.Errorf("NewMatcher failed: expected error for unterminated character class")
+	}
+	if _, err := NewMatcher(nil, "regex"); err == nil {
+		t.Errorf("NewMatcher failed: expected error for unknown style")
+	}
+}
+
+func TestMatcherGlob(t *testing.T) {
+	m, err := NewMatcher([]string{".git", "*.out.md"}, IgnoreStyleGlob)
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+	for path, expected := range map[string]bool{".git": true, "sub/.git": true, "sub/a.out.md": true, "sub/a.md": false} {
+		matched, _ := m.Match(path, false)
+		if matched != expected {
+			t.Errorf("Path: %s, Expected: %v, Got: %v", path, expected, matched)
+		}
+	}
+
+	m, err = NewMatcher([]string{"docs/node_modules", "/notes/*.tmp", "./drafts/*"}, IgnoreStyleGlob)
+	if err != nil {
+		t.Fatalf("NewMatcher failed: %v", err)
+	}
+	for path, expected := range map[string]bool{
+		"docs/node_modules":     true,
+		"node_modules":          false,
+		"src/node_modules":      false,
+		"docs/sub/node_modules": false,
+		"notes/a.tmp":           true,
+		"notes/sub/a.tmp":       false,
+		"a.tmp":                 false,
+		"drafts/a.md":           true,
+		"drafts/sub":            true,
+		"notes/drafts/a.md":     false,
+	} {
+		matched, err := m.Match(path, false)
+		if err != nil {
+			t.Errorf("Path: %s, unexpected error: %v", path, err)
+		}
+		if matched != expected {
+			t.Errorf("Path: %s, Expected: %v, Got: %v", path, expected, matched)
+		}
+	}
+}
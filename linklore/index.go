@@ -0,0 +1,561 @@
+// Package linklore rewrites Obsidian-style wikilinks into Markdown links,
+// resolving each link against an index of the files in a vault.
+package linklore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileInfo describes an indexed file.
+type FileInfo struct {
+	Name     string `json:"name"`
+	Basename string `json:"basename"`
+	Ext      string `json:"ext"`
+	// Dir is the base directory the file was found in.
+	Dir string `json:"dir"`
+	// Path is relative to Dir and uses "/" as separator on every platform.
+	Path string `json:"path"`
+	// Headings holds the slugs of the headings of a Markdown file, when the
+	// index was built with IndexOptions.Headings. It is nil for other files.
+	Headings []string `json:"headings,omitempty"`
+	// Title is the title set in the frontmatter of a Markdown file, when the
+	// index was built with IndexOptions.Titles.
+	Title string `json:"title,omitempty"`
+	// Aliases are the aliases listed in the frontmatter of a Markdown file,
+	// when the index was built with IndexOptions.Aliases.
+	Aliases []string `json:"aliases,omitempty"`
+	// Unparsed tells why the headings and frontmatter of a Markdown file
+	// were not read although IndexOptions asked for them, e.g. because it
+	// is larger than IndexOptions.MaxParseSize or binary. The file is still
+	// indexed.
+	Unparsed string `json:"unparsed,omitempty"`
+}
+
+// IndexOptions configures how an Index is built.
+type IndexOptions struct {
+	// CaseInsensitive lets lookups fall back to a case-insensitive match on
+	// the basename. A link matching several files only case-insensitively
+	// is ambiguous, but such keys are not reported as duplicates.
+	CaseInsensitive bool
+	// FollowSymlinks walks into symlinked directories. Each directory is
+	// walked once, so symlink cycles are not followed.
+	FollowSymlinks bool
+	// Workers is the number of directories read concurrently while building
+	// the index. Zero means runtime.NumCPU(); 1 walks the tree serially.
+	Workers int
+	// MaxFiles is the maximum number of files indexed before building the
+	// index fails with a *TooManyFilesError. Zero means no limit.
+	MaxFiles int
+	// Include restricts the index to files whose name matches one of the
+	// patterns, using filepath.Match. Empty means every file. Ignore
+	// patterns still apply.
+	Include []string
+	// IgnoreStyle is one of the IgnoreStyle constants, selecting how ignore
+	// patterns are matched. Empty means IgnoreStyleGlob.
+	IgnoreStyle string
+	// ExactMatch disables retrying a link without its extension when it does
+	// not match any key, so that a typo such as "note.bak" is reported
+	// instead of resolving to "note".
+	ExactMatch bool
+	// Headings reads the headings of every Markdown file into
+	// FileInfo.Headings, so that anchors can be validated.
+	Headings bool
+	// Titles reads the title of every Markdown file from its frontmatter
+	// into FileInfo.Title and keys the file by it, like a basename. A title
+	// shared with the basename of another file is a duplicate.
+	Titles bool
+	// Aliases reads the aliases of every Markdown file from the "aliases"
+	// field of its frontmatter into FileInfo.Aliases and keys the file by
+	// each of them, like Obsidian. An alias shared with another file is a
+	// duplicate.
+	Aliases bool
+	// MaxParseSize is the size in bytes above which the headings and
+	// frontmatter of a Markdown file are not read, see FileInfo.Unparsed.
+	// Zero means no limit. Files containing a NUL byte near their start are
+	// never read, since they are binary whatever their extension.
+	MaxParseSize int64
+	// PriorityDirs lists directories, relative to the base directory, from
+	// the highest to the lowest priority. When files share a key, the one in
+	// the directory listed first wins instead of being reported as a
+	// duplicate. Files outside every directory have the lowest priority.
+	PriorityDirs []string
+	// OnDuplicate, if set, is called when added shares key with existing
+	// and neither has a higher priority. Files are added in the order they
+	// are walked, base directory by base directory, so existing is the file
+	// found first. Returning a file and true registers it under key, e.g.
+	// existing to keep the first writer or added to keep the last one.
+	// Returning false records key as a duplicate, which is also what happens
+	// without OnDuplicate: neither file wins, and links using key fail with
+	// ErrAmbiguousLink. Once key is a duplicate, OnDuplicate is not called
+	// for the files added later under it. It is also called when reading a
+	// cached index, which is not invalidated when it changes.
+	OnDuplicate func(key string, existing, added FileInfo) (FileInfo, bool) `json:"-"`
+}
+
+// Index maps link keys to files. Every file is keyed by its basename, by its
+// name with extension, and by its path relative to the base directory with
+// and without extension, e.g. "foo/bar.png" and "foo/bar", and optionally by
+// its title and aliases. A key shared by several files cannot be resolved
+// and is recorded as a duplicate instead.
+type Index struct {
+	baseDirs   []string
+	opts       IndexOptions
+	files      map[string]FileInfo
+	basenames  map[string]FileInfo
+	names      map[string]FileInfo
+	lowerNames map[string]FileInfo
+	paths      map[string]FileInfo
+	duplicates map[string][]string
+	// extDuplicates holds the duplicate keys that include an extension.
+	// They are not reported, since the same files also share the key
+	// without extension.
+	extDuplicates map[string][]string
+	// pathDuplicates and pathExtDuplicates hold the duplicate path keys,
+	// without and with extension. They are kept apart from the other keys
+	// because the path of a file at the top of the base directory is also
+	// a basename or a name, which files in subdirectories may share without
+	// making the path ambiguous. Like extDuplicates, pathExtDuplicates are
+	// not reported.
+	pathDuplicates    map[string][]string
+	pathExtDuplicates map[string][]string
+	// lowerDuplicates holds the lowercase keys shared by several files. It
+	// is only consulted by the case-insensitive fallback, so that files
+	// whose keys differ by case do not make each other ambiguous, and it
+	// is not reported.
+	lowerDuplicates map[string][]string
+	// ignore, built and dirs record the ignore patterns, the time building
+	// the index started and the directories read, so that ReadCache can
+	// tell whether a cached index is still up to date.
+	ignore []string
+	built  time.Time
+	dirs   map[string]walkedDir
+}
+
+// walkedDir is a directory read while building an index. Prefix is its
+// slash-separated path relative to BaseDir, which differs from Path when
+// the directory is the target of a symlink.
+type walkedDir struct {
+	BaseDir string `json:"baseDir"`
+	Path    string `json:"path"`
+	Prefix  string `json:"prefix"`
+}
+
+var (
+	ErrLinkNotFound   = errors.New("file not found for link")
+	ErrAmbiguousLink  = errors.New("ambiguous link")
+	ErrAnchorNotFound = errors.New("heading not found for anchor")
+	ErrSelfLink       = errors.New("link to the file itself")
+	ErrLinkTooLong    = errors.New("link component too long")
+	ErrEmbedTooDeep   = errors.New("embeds nested too deeply")
+)
+
+// DefaultMaxFiles is the maximum number of files BuildIndex indexes.
+const DefaultMaxFiles = 10000
+
+// TooManyFilesError is returned when building an index finds more files
+// than IndexOptions.MaxFiles. The walk goes on counting past the limit, so
+// Count is the number of files that would have been indexed.
+type TooManyFilesError struct {
+	Limit int
+	Count int
+}
+
+func (e *TooManyFilesError) Error() string {
+	return fmt.Sprintf("too many files: found %d, limit is %d", e.Count, e.Limit)
+}
+
+// checkMaxFiles returns a *TooManyFilesError if count exceeds maxFiles.
+func checkMaxFiles(count, maxFiles int) error {
+	if maxFiles > 0 && count > maxFiles {
+		return &TooManyFilesError{Limit: maxFiles, Count: count}
+	}
+	return nil
+}
+
+// DefaultMaxParseSize is the default for IndexOptions.MaxParseSize on the
+// command line.
+const DefaultMaxParseSize = 10 << 20
+
+// NewIndex returns an empty index for files under baseDir.
+func NewIndex(baseDir string, opts IndexOptions) Index {
+	return newIndex([]string{baseDir}, opts)
+}
+
+func newIndex(baseDirs []string, opts IndexOptions) Index {
+	return Index{
+		baseDirs:          baseDirs,
+		opts:              opts,
+		files:             make(map[string]FileInfo),
+		basenames:         make(map[string]FileInfo),
+		names:             make(map[string]FileInfo),
+		lowerNames:        make(map[string]FileInfo),
+		paths:             make(map[string]FileInfo),
+		duplicates:        make(map[string][]string),
+		extDuplicates:     make(map[string][]string),
+		pathDuplicates:    make(map[string][]string),
+		pathExtDuplicates: make(map[string][]string),
+		lowerDuplicates:   make(map[string][]string),
+		dirs:              make(map[string]walkedDir),
+	}
+}
+
+// BuildIndex indexes every file under baseDir whose name does not match any
+// of the ignore patterns.
+func BuildIndex(baseDir string, ignore []string) (Index, error) {
+	return BuildIndexWithOptions(baseDir, ignore, IndexOptions{MaxFiles: DefaultMaxFiles})
+}
+
+// BuildIndexWithOptions is like BuildIndex but accepts IndexOptions.
+func BuildIndexWithOptions(baseDir string, ignore []string, opts IndexOptions) (Index, error) {
+	return BuildIndexDirs([]string{baseDir}, ignore, opts)
+}
+
+// BuildIndexDirs is like BuildIndexWithOptions but merges the files under
+// several base directories into one index. Files sharing a key across
+// directories are reported as duplicates, and opts.MaxFiles limits the
+// total number of files.
+func BuildIndexDirs(baseDirs []string, ignore []string, opts IndexOptions) (Index, error) {
+	return BuildIndexContext(context.Background(), baseDirs, ignore, opts)
+}
+
+// BuildIndexContext is like BuildIndexDirs but stops walking as soon as ctx
+// is done, returning ctx.Err().
+func BuildIndexContext(ctx context.Context, baseDirs []string, ignore []string, opts IndexOptions) (Index, error) {
+	idx := newIndex(baseDirs, opts)
+	idx.ignore = ignore
+	idx.built = time.Now()
+	matcher, err := NewMatcher(ignore, opts.IgnoreStyle)
+	if err != nil {
+		return idx, err
+	}
+
+	workers := opts.Workers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers == 1 {
+		w := indexWalker{ctx: ctx, idx: idx, ignore: matcher}
+		for _, baseDir := range baseDirs {
+			w.baseDir = baseDir
+			if err := w.walk(baseDir, ""); err != nil {
+				return idx, err
+			}
+		}
+		return idx, checkMaxFiles(w.count, opts.MaxFiles)
+	}
+
+	w := parallelWalker{ctx: ctx, opts: opts, ignore: matcher, sem: make(chan struct{}, workers)}
+	for _, baseDir := range baseDirs {
+		files, dirs, err := w.run(baseDir)
+		for _, fileInfo := range files {
+			idx.Add(fileInfo)
+		}
+		for _, dir := range dirs {
+			idx.dirs[dir.Path] = dir
+		}
+		if err != nil {
+			return idx, err
+		}
+	}
+	return idx, checkMaxFiles(int(w.count.Load()), opts.MaxFiles)
+}
+
+// IsIgnored reports whether name matches any of the patterns, using
+// filepath.Match.
+func IsIgnored(name string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := filepath.Match(pattern, name)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isIncluded reports whether a file name matches one of the include
+// patterns, or whether there are none.
+func isIncluded(name string, include []string) (bool, error) {
+	if len(include) == 0 {
+		return true, nil
+	}
+	return IsIgnored(name, include)
+}
+
+// Add registers fileInfo under all of its keys.
+func (idx Index) Add(fileInfo FileInfo) {
+	idx.files[idx.location(fileInfo)] = fileInfo
+	idx.addKey(idx.basenames, idx.duplicates, fileInfo.Basename, fileInfo)
+	path := filepath.ToSlash(fileInfo.Path)
+	idx.addKey(idx.paths, idx.pathDuplicates, strings.TrimSuffix(path, fileInfo.Ext), fileInfo)
+	if fileInfo.Ext != "" {
+		idx.addKey(idx.names, idx.extDuplicates, fileInfo.Name, fileInfo)
+		idx.addKey(idx.paths, idx.pathExtDuplicates, path, fileInfo)
+	}
+	if idx.opts.CaseInsensitive {
+		idx.addKey(idx.lowerNames, idx.lowerDuplicates, strings.ToLower(fileInfo.Basename), fileInfo)
+	}
+	if fileInfo.Title != "" {
+		idx.addNameKey(fileInfo.Title, fileInfo)
+	}
+	for _, alias := range fileInfo.Aliases {
+		idx.addNameKey(alias, fileInfo)
+	}
+}
+
+// addNameKey registers fileInfo under key, which is looked up like its
+// basename.
+func (idx Index) addNameKey(key string, fileInfo FileInfo) {
+	idx.addKey(idx.basenames, idx.duplicates, key, fileInfo)
+	if idx.opts.CaseInsensitive {
+		idx.addKey(idx.lowerNames, idx.lowerDuplicates, strings.ToLower(key), fileInfo)
+	}
+}
+
+// addKey registers fileInfo under key. A key shared by several files is
+// removed from keys and recorded in duplicates instead, so those files can
+// only be resolved through a more specific key, unless one of them has a
+// higher priority than the others or OnDuplicate picks one.
+func (idx Index) addKey(keys map[string]FileInfo, duplicates map[string][]string, key string, fileInfo FileInfo) {
+	location := idx.location(fileInfo)
+	priority := idx.priority(fileInfo)
+	if paths, exists := duplicates[key]; exists {
+		switch other := idx.priority(idx.files[paths[0]]); {
+		case priority > other:
+			return
+		case priority < other:
+			delete(duplicates, key)
+			keys[key] = fileInfo
+			return
+		}
+		delete(keys, key)
+		for _, path := range paths {
+			if path == location {
+				return
+			}
+		}
+		duplicates[key] = append(paths, location)
+		return
+	}
+
+	if entry, exists := keys[key]; exists {
+		if idx.location(entry) == location {
+			// The file is already registered under key, e.g. its title is
+			// its basename.
+			return
+		}
+		switch other := idx.priority(entry); {
+		case priority > other:
+			return
+		case priority < other:
+			keys[key] = fileInfo
+			return
+		}
+		if idx.opts.OnDuplicate != nil {
+			if winner, ok := idx.opts.OnDuplicate(key, entry, fileInfo); ok {
+				keys[key] = winner
+				return
+			}
+		}
+		delete(keys, key)
+		duplicates[key] = []string{idx.location(entry), location}
+		return
+	}
+
+	keys[key] = fileInfo
+}
+
+// priority returns the index of the first priority directory containing
+// fileInfo, or len(PriorityDirs) if there is none. Lower is better.
+func (idx Index) priority(fileInfo FileInfo) int {
+	path := filepath.ToSlash(fileInfo.Path)
+	for i, dir := range idx.opts.PriorityDirs {
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if dir != "" && strings.HasPrefix(path, dir+"/") {
+			return i
+		}
+	}
+	return len(idx.opts.PriorityDirs)
+}
+
+// location returns the path recorded for fileInfo in duplicates. It is
+// prefixed with the base directory of the file when the index has several.
+func (idx Index) location(fileInfo FileInfo) string {
+	if len(idx.baseDirs) > 1 {
+		return filepath.ToSlash(filepath.Join(fileInfo.Dir, fileInfo.Path))
+	}
+	return fileInfo.Path
+}
+
+// Lookup finds the file for key, falling back to a case-insensitive match
+// when enabled. Keys containing a "/" are matched against the relative path
+// instead of the basename. Keys containing a "." are first matched against
+// the name with extension, so "diagram.png" finds the image even if there
+// is also a "diagram.md".
+func (idx Index) Lookup(key string) (FileInfo, bool) {
+	if strings.Contains(key, "/") {
+		fileInfo, exists := idx.paths[key]
+		return fileInfo, exists
+	}
+	if strings.Contains(key, ".") {
+		if fileInfo, exists := idx.names[key]; exists {
+			return fileInfo, true
+		}
+	}
+	if fileInfo, exists := idx.basenames[key]; exists {
+		return fileInfo, true
+	}
+	if idx.opts.CaseInsensitive {
+		fileInfo, exists := idx.lowerNames[strings.ToLower(key)]
+		return fileInfo, exists
+	}
+	return FileInfo{}, false
+}
+
+// Resolve finds the file a link base refers to. If base is not a key, it is
+// retried without its extension unless ExactMatch is set. A base starting
+// with "/", as in [[/folder/note]], is a path from the base directory. The
+// returned error wraps ErrLinkNotFound or ErrAmbiguousLink.
+func (idx Index) Resolve(base string) (FileInfo, error) {
+	if path, found := strings.CutPrefix(base, "/"); found {
+		if fileInfo, exists := idx.LookupPath(path); exists {
+			return fileInfo, nil
+		}
+		return FileInfo{}, ErrLinkNotFound
+	}
+
+	keys := idx.resolveKeys(base)
+	for _, key := range keys {
+		if fileInfo, exists := idx.Lookup(key); exists {
+			return fileInfo, nil
+		}
+	}
+
+	if candidates := idx.findDuplicates(keys...); candidates != nil {
+		return FileInfo{}, fmt.Errorf("%w (candidates: %s)", ErrAmbiguousLink, strings.Join(candidates, ", "))
+	}
+	return FileInfo{}, ErrLinkNotFound
+}
+
+// Candidates returns the files sharing the first ambiguous key Resolve looks
+// up for base, in the order they were added, or nil if base is not
+// ambiguous.
+func (idx Index) Candidates(base string) []FileInfo {
+	var candidates []FileInfo
+	for _, location := range idx.findDuplicates(idx.resolveKeys(base)...) {
+		candidates = append(candidates, idx.files[location])
+	}
+	return candidates
+}
+
+// LookupPath finds the file at path, relative to the base directory and
+// slash separated, with or without its extension as Resolve.
+func (idx Index) LookupPath(path string) (FileInfo, bool) {
+	for _, key := range idx.resolveKeys(path) {
+		if fileInfo, exists := idx.paths[key]; exists {
+			return fileInfo, true
+		}
+	}
+	return FileInfo{}, false
+}
+
+// resolveKeys returns the keys Resolve looks up for base, in order: base
+// itself, then base without its extension unless ExactMatch is set.
+func (idx Index) resolveKeys(base string) []string {
+	if idx.opts.ExactMatch {
+		return []string{base}
+	}
+	return []string{base, strings.TrimSuffix(base, filepath.Ext(base))}
+}
+
+// findDuplicates returns the paths of the files sharing the first ambiguous
+// key among keys, or nil if none of them is ambiguous.
+func (idx Index) findDuplicates(keys ...string) []string {
+	for _, key := range keys {
+		if strings.Contains(key, "/") {
+			if paths, exists := idx.pathDuplicates[key]; exists {
+				return paths
+			}
+			if paths, exists := idx.pathExtDuplicates[key]; exists {
+				return paths
+			}
+			continue
+		}
+		if paths, exists := idx.duplicates[key]; exists {
+			return paths
+		}
+		if paths, exists := idx.extDuplicates[key]; exists {
+			return paths
+		}
+		if idx.opts.CaseInsensitive {
+			if paths, exists := idx.lowerDuplicates[strings.ToLower(key)]; exists {
+				return paths
+			}
+		}
+	}
+	return nil
+}
+
+// BaseDir returns the directory the index was built from, or the first one
+// if it was built from several.
+func (idx Index) BaseDir() string {
+	return idx.baseDirs[0]
+}
+
+// BaseDirs returns the directories the index was built from.
+func (idx Index) BaseDirs() []string {
+	return idx.baseDirs
+}
+
+// Len returns the number of indexed files.
+func (idx Index) Len() int {
+	return len(idx.files)
+}
+
+// Files returns every indexed file, including those only reachable through
+// a more specific key, sorted by path.
+func (idx Index) Files() []FileInfo {
+	locations := make([]string, 0, len(idx.files))
+	for location := range idx.files {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+
+	files := make([]FileInfo, 0, len(locations))
+	for _, location := range locations {
+		files = append(files, idx.files[location])
+	}
+	return files
+}
+
+// DuplicateKeys returns the keys shared by several files, sorted.
+func (idx Index) DuplicateKeys() []string {
+	keys := make([]string, 0, len(idx.duplicates))
+	for key := range idx.duplicates {
+		keys = append(keys, key)
+	}
+	for key := range idx.pathDuplicates {
+		if _, exists := idx.duplicates[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Duplicates returns the paths of the files sharing key.
+func (idx Index) Duplicates(key string) []string {
+	if paths, exists := idx.duplicates[key]; exists {
+		return paths
+	}
+	return idx.pathDuplicates[key]
+}
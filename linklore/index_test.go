@@ -0,0 +1,939 @@
+package linklore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildIndex(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	// 创建测试文件
+	createTestFile(tempDir, "file1.txt", "")
+	createTestFile(tempDir, "file2.txt", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Errorf("BuildIndex failed: %v", err)
+	}
+
+	expectedIndex := map[string]FileInfo{
+		"file1": {
+			Name:     "file1.txt",
+			Basename: "file1",
+			Ext:      ".txt",
+			Dir:      tempDir,
+			Path:     "file1.txt",
+		},
+		"file2": {
+			Name:     "file2.txt",
+			Basename: "file2",
+			Ext:      ".txt",
+			Dir:      tempDir,
+			Path:     "file2.txt",
+		},
+	}
+
+	if len(idx.basenames) != len(expectedIndex) {
+		t.Errorf("BuildIndex failed: incorrect index size, got %d, want %d", len(idx.basenames), len(expectedIndex))
+	}
+
+	for key, expectedFileInfo := range expectedIndex {
+		fileInfo, exists := idx.Lookup(key)
+		if !exists {
+			t.Errorf("BuildIndex failed: missing key %s in index", key)
+			continue
+		}
+
+		if !reflect.DeepEqual(fileInfo, expectedFileInfo) {
+			t.Errorf("BuildIndex failed: incorrect FileInfo for key %s, got %+v, want %+v", key, fileInfo, expectedFileInfo)
+		}
+	}
+}
+
+func TestBuildIndexFullName(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0755)
+	createTestFile(tempDir, "diagram.png", "")
+	createTestFile(tempDir, "diagram.md", "")
+	createTestFile(filepath.Join(tempDir, "sub"), "paper.pdf", "")
+	createTestFile(filepath.Join(tempDir, "sub"), "paper.md", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		base     string
+		expected string
+		err      error
+	}{
+		{base: "diagram.png", expected: "diagram.png"},
+		{base: "diagram.md", expected: "diagram.md"},
+		{base: "diagram", err: ErrAmbiguousLink},
+		{base: "paper.pdf", expected: "sub/paper.pdf"},
+		{base: "sub/paper.pdf", expected: "sub/paper.pdf"},
+		{base: "sub/paper", err: ErrAmbiguousLink},
+	}
+	for _, test := range tests {
+		fileInfo, err := idx.Resolve(test.base)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve(%q) failed: expected error %v, got %v", test.base, test.err, err)
+		}
+		if fileInfo.Path != test.expected {
+			t.Errorf("Resolve(%q) failed: got %s, want %s", test.base, fileInfo.Path, test.expected)
+		}
+	}
+
+	expectedKeys := []string{"diagram", "paper", "sub/paper"}
+	if keys := idx.DuplicateKeys(); !reflect.DeepEqual(keys, expectedKeys) {
+		t.Errorf("BuildIndex failed: incorrect duplicate keys, got %v, want %v", keys, expectedKeys)
+	}
+}
+
+func TestBuildIndexTopLevelPath(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	// a/b.md is walked before b.md and shares its basename and name, which
+	// are also the path keys of b.md.
+	os.Mkdir(filepath.Join(tempDir, "a"), 0755)
+	createTestFile(filepath.Join(tempDir, "a"), "b.md", "")
+	createTestFile(tempDir, "b.md", "")
+
+	tests := []struct {
+		base     string
+		expected string
+		err      error
+	}{
+		{base: "/b", expected: "b.md"},
+		{base: "/b.md", expected: "b.md"},
+		{base: "/a/b", expected: "a/b.md"},
+		{base: "a/b.md", expected: "a/b.md"},
+		{base: "b", err: ErrAmbiguousLink},
+		{base: "b.md", err: ErrAmbiguousLink},
+	}
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		for _, test := range tests {
+			fileInfo, err := idx.Resolve(test.base)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Resolve(%q) failed for Workers %d: expected error %v, got %v", test.base, workers, test.err, err)
+			}
+			if fileInfo.Path != test.expected {
+				t.Errorf("Resolve(%q) failed for Workers %d: got %s, want %s", test.base, workers, fileInfo.Path, test.expected)
+			}
+		}
+		if keys := idx.DuplicateKeys(); !reflect.DeepEqual(keys, []string{"b"}) {
+			t.Errorf("BuildIndexWithOptions failed for Workers %d: incorrect duplicate keys, got %v", workers, keys)
+		}
+	}
+}
+
+func TestBuildIndexExactMatch(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(tempDir, "diagram.png", "")
+
+	tests := []struct {
+		exactMatch bool
+		base       string
+		expected   string
+		err        error
+	}{
+		{exactMatch: false, base: "note.bak", expected: "note.md"},
+		{exactMatch: false, base: "note", expected: "note.md"},
+		{exactMatch: true, base: "note.bak", err: ErrLinkNotFound},
+		{exactMatch: true, base: "note", expected: "note.md"},
+		{exactMatch: true, base: "note.md", expected: "note.md"},
+		{exactMatch: true, base: "diagram.png", expected: "diagram.png"},
+	}
+	for _, test := range tests {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{ExactMatch: test.exactMatch})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		fileInfo, err := idx.Resolve(test.base)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve(%q) with ExactMatch %v failed: expected error %v, got %v", test.base, test.exactMatch, test.err, err)
+		}
+		if fileInfo.Path != test.expected {
+			t.Errorf("Resolve(%q) with ExactMatch %v failed: got %s, want %s", test.base, test.exactMatch, fileInfo.Path, test.expected)
+		}
+	}
+}
+
+func TestBuildIndexCaseInsensitive(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "README.md", "")
+
+	idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{CaseInsensitive: true})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+
+	for _, base := range []string{"readme", "ReadMe.md"} {
+		fileInfo, err := idx.Resolve(base)
+		if err != nil {
+			t.Errorf("Resolve failed for %s: %v", base, err)
+			continue
+		}
+		if fileInfo.Path != "README.md" {
+			t.Errorf("Resolve failed for %s: got %s, want README.md", base, fileInfo.Path)
+		}
+	}
+
+	createTestFile(tempDir, "readme.txt", "")
+	idx, err = BuildIndexWithOptions(tempDir, nil, IndexOptions{CaseInsensitive: true})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	if idx.Duplicates("readme") != nil {
+		t.Errorf("BuildIndexWithOptions failed: keys differing only by case should not be reported as duplicates")
+	}
+
+	tests := []struct {
+		base     string
+		expected string
+		err      error
+	}{
+		{base: "readme", expected: "readme.txt"},
+		{base: "README", expected: "README.md"},
+		{base: "ReadMe", err: ErrAmbiguousLink},
+		// The lowercase key is already shared when note.md is added.
+		{base: "note", expected: "c/note.md"},
+		{base: "Note", expected: "a/Note.md"},
+		{base: "nOTE", err: ErrAmbiguousLink},
+	}
+	for _, dir := range []string{"a", "b", "c"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+	}
+	createTestFile(filepath.Join(tempDir, "a"), "Note.md", "")
+	createTestFile(filepath.Join(tempDir, "b"), "NOTE.md", "")
+	createTestFile(filepath.Join(tempDir, "c"), "note.md", "")
+	idx, err = BuildIndexWithOptions(tempDir, nil, IndexOptions{CaseInsensitive: true, Workers: 1})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	for _, test := range tests {
+		fileInfo, err := idx.Resolve(test.base)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve failed for %s: expected error %v, got %v", test.base, test.err, err)
+		}
+		if fileInfo.Path != test.expected {
+			t.Errorf("Resolve failed for %s: got %s, want %s", test.base, fileInfo.Path, test.expected)
+		}
+	}
+}
+
+func TestBuildIndexDuplicate(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	os.Mkdir(subDir, 0755)
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(subDir, "note.md", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	if _, exists := idx.Lookup("note"); exists {
+		t.Errorf("BuildIndex failed: ambiguous key note should not be in index")
+	}
+	expectedDuplicates := []string{"note.md", "sub/note.md"}
+	if !reflect.DeepEqual(idx.Duplicates("note"), expectedDuplicates) {
+		t.Errorf("BuildIndex failed: incorrect duplicates for key note, got %v, want %v", idx.Duplicates("note"), expectedDuplicates)
+	}
+	if keys := idx.DuplicateKeys(); !reflect.DeepEqual(keys, []string{"note"}) {
+		t.Errorf("BuildIndex failed: incorrect duplicate keys, got %v, want [note]", keys)
+	}
+	var paths []string
+	for _, fileInfo := range idx.Files() {
+		paths = append(paths, fileInfo.Path)
+	}
+	if !reflect.DeepEqual(paths, expectedDuplicates) {
+		t.Errorf("BuildIndex failed: incorrect files, got %v, want %v", paths, expectedDuplicates)
+	}
+
+	tests := []struct {
+		base     string
+		expected string
+		err      error
+	}{
+		{base: "note", err: ErrAmbiguousLink},
+		{base: "sub/note", expected: "sub/note.md"},
+		{base: "sub/note.md", expected: "sub/note.md"},
+		{base: "other/note", err: ErrLinkNotFound},
+	}
+	for _, test := range tests {
+		fileInfo, err := idx.Resolve(test.base)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve failed for %s: expected error %v, got %v", test.base, test.err, err)
+		}
+		if fileInfo.Path != test.expected {
+			t.Errorf("Resolve failed for %s: got %s, want %s", test.base, fileInfo.Path, test.expected)
+		}
+	}
+}
+
+func TestBuildIndexOnDuplicate(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"a", "b"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+		createTestFile(filepath.Join(tempDir, dir), "note.md", "")
+		createTestFile(filepath.Join(tempDir, dir), "todo.md", "")
+	}
+
+	var calls []string
+	opts := IndexOptions{
+		Workers: 1,
+		OnDuplicate: func(key string, existing, added FileInfo) (FileInfo, bool) {
+			calls = append(calls, key+": "+existing.Path+", "+added.Path)
+			switch key {
+			case "note":
+				return existing, true
+			case "todo":
+				return added, true
+			}
+			return FileInfo{}, false
+		},
+	}
+	idx, err := BuildIndexWithOptions(tempDir, nil, opts)
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+
+	expectedCalls := []string{
+		"note: a/note.md, b/note.md",
+		"note.md: a/note.md, b/note.md",
+		"todo: a/todo.md, b/todo.md",
+		"todo.md: a/todo.md, b/todo.md",
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("OnDuplicate calls: got %v, want %v", calls, expectedCalls)
+	}
+	if keys := idx.DuplicateKeys(); len(keys) != 0 {
+		t.Errorf("BuildIndexWithOptions failed: unexpected duplicate keys %v", keys)
+	}
+	for key, expected := range map[string]string{"note": "a/note.md", "todo": "b/todo.md"} {
+		fileInfo, err := idx.Resolve(key)
+		if err != nil {
+			t.Errorf("Resolve failed for %s: %v", key, err)
+		}
+		if fileInfo.Path != expected {
+			t.Errorf("Resolve failed for %s: got %s, want %s", key, fileInfo.Path, expected)
+		}
+	}
+}
+
+func TestBuildIndexPriorityDirs(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"published", "drafts", "archive"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+		createTestFile(filepath.Join(tempDir, dir), "note.md", "")
+	}
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(filepath.Join(tempDir, "drafts"), "todo.md", "")
+	createTestFile(filepath.Join(tempDir, "archive"), "todo.md", "")
+
+	tests := []struct {
+		priorityDirs []string
+		base         string
+		expected     string
+		err          error
+	}{
+		{priorityDirs: nil, base: "note", err: ErrAmbiguousLink},
+		{priorityDirs: []string{"published", "drafts"}, base: "note", expected: "published/note.md"},
+		{priorityDirs: []string{"drafts", "published"}, base: "note", expected: "drafts/note.md"},
+		{priorityDirs: []string{"drafts/"}, base: "note", expected: "drafts/note.md"},
+		{priorityDirs: []string{"published"}, base: "todo", err: ErrAmbiguousLink},
+		{priorityDirs: []string{"published", "archive"}, base: "todo", expected: "archive/todo.md"},
+		{priorityDirs: []string{"published"}, base: "drafts/note", expected: "drafts/note.md"},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{PriorityDirs: test.priorityDirs, Workers: workers})
+			if err != nil {
+				t.Fatalf("BuildIndexWithOptions failed: %v", err)
+			}
+			fileInfo, err := idx.Resolve(test.base)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Resolve failed for %s with priority dirs %v: expected error %v, got %v", test.base, test.priorityDirs, test.err, err)
+			}
+			if fileInfo.Path != test.expected {
+				t.Errorf("Resolve failed for %s with priority dirs %v: got %s, want %s", test.base, test.priorityDirs, fileInfo.Path, test.expected)
+			}
+		}
+	}
+
+	idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{PriorityDirs: []string{"published"}})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	if keys := idx.DuplicateKeys(); !reflect.DeepEqual(keys, []string{"todo"}) {
+		t.Errorf("BuildIndexWithOptions failed: incorrect duplicate keys, got %v, want [todo]", keys)
+	}
+}
+
+func TestBuildIndexFollowSymlinks(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	vaultDir := filepath.Join(tempDir, "vault")
+	sharedDir := filepath.Join(tempDir, "shared")
+	os.Mkdir(vaultDir, 0755)
+	os.Mkdir(sharedDir, 0755)
+	createTestFile(vaultDir, "note.md", "")
+	createTestFile(sharedDir, "common.md", "")
+
+	if err := os.Symlink(sharedDir, filepath.Join(vaultDir, "shared")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	// A cycle back to the vault must not be walked forever.
+	if err := os.Symlink(vaultDir, filepath.Join(sharedDir, "vault")); err != nil {
+		t.Fatalf("unable to create symlink: %v", err)
+	}
+
+	idx, err := BuildIndex(vaultDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	if _, exists := idx.Lookup("common"); exists {
+		t.Errorf("BuildIndex failed: symlinked directories should not be followed by default")
+	}
+
+	idx, err = BuildIndexWithOptions(vaultDir, nil, IndexOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	fileInfo, exists := idx.Lookup("common")
+	if !exists {
+		t.Fatalf("BuildIndexWithOptions failed: missing key common in index")
+	}
+	if expected := "shared/common.md"; fileInfo.Path != expected {
+		t.Errorf("BuildIndexWithOptions failed: got path %s, want %s", fileInfo.Path, expected)
+	}
+	if keys := idx.DuplicateKeys(); len(keys) != 0 {
+		t.Errorf("BuildIndexWithOptions failed: files reached through a cycle should be indexed once, got duplicates %v", keys)
+	}
+
+	idx, err = BuildIndexWithOptions(vaultDir, []string{"shared"}, IndexOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	if _, exists := idx.Lookup("common"); exists {
+		t.Errorf("BuildIndexWithOptions failed: ignored symlink should not be followed")
+	}
+}
+
+func TestBuildIndexWorkers(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"a", "a/b", "c", ".git"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+	}
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(filepath.Join(tempDir, "a"), "note.md", "")
+	createTestFile(filepath.Join(tempDir, "a", "b"), "note.md", "")
+	createTestFile(filepath.Join(tempDir, "c"), "a.md", "")
+	createTestFile(filepath.Join(tempDir, ".git"), "HEAD", "")
+
+	ignore := []string{".git"}
+	serial, err := BuildIndexWithOptions(tempDir, ignore, IndexOptions{Workers: 1})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	parallel, err := BuildIndexWithOptions(tempDir, ignore, IndexOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(serial.basenames, parallel.basenames) {
+		t.Errorf("BuildIndexWithOptions failed: basenames differ, serial %v, parallel %v", serial.basenames, parallel.basenames)
+	}
+	if !reflect.DeepEqual(serial.paths, parallel.paths) {
+		t.Errorf("BuildIndexWithOptions failed: paths differ, serial %v, parallel %v", serial.paths, parallel.paths)
+	}
+	if !reflect.DeepEqual(serial.duplicates, parallel.duplicates) {
+		t.Errorf("BuildIndexWithOptions failed: duplicates differ, serial %v, parallel %v", serial.duplicates, parallel.duplicates)
+	}
+	expectedDuplicates := []string{"a/b/note.md", "a/note.md", "note.md"}
+	if !reflect.DeepEqual(parallel.Duplicates("note"), expectedDuplicates) {
+		t.Errorf("BuildIndexWithOptions failed: incorrect duplicates for key note, got %v, want %v", parallel.Duplicates("note"), expectedDuplicates)
+	}
+}
+
+func TestBuildIndexDirs(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	notesDir := filepath.Join(tempDir, "notes")
+	attachmentsDir := filepath.Join(tempDir, "attachments")
+	os.Mkdir(notesDir, 0755)
+	os.Mkdir(attachmentsDir, 0755)
+	createTestFile(notesDir, "note.md", "")
+	createTestFile(notesDir, "index.md", "")
+	createTestFile(attachmentsDir, "image.png", "")
+	createTestFile(attachmentsDir, "index.md", "")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexDirs([]string{notesDir, attachmentsDir}, nil, IndexOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexDirs failed: %v", err)
+		}
+
+		expected := map[string]FileInfo{
+			"note":  {Name: "note.md", Basename: "note", Ext: ".md", Dir: notesDir, Path: "note.md"},
+			"image": {Name: "image.png", Basename: "image", Ext: ".png", Dir: attachmentsDir, Path: "image.png"},
+		}
+		for key, expectedFileInfo := range expected {
+			fileInfo, exists := idx.Lookup(key)
+			if !exists {
+				t.Errorf("BuildIndexDirs failed: missing key %s in index", key)
+				continue
+			}
+			if !reflect.DeepEqual(fileInfo, expectedFileInfo) {
+				t.Errorf("BuildIndexDirs failed: incorrect FileInfo for key %s, got %+v, want %+v", key, fileInfo, expectedFileInfo)
+			}
+		}
+
+		expectedDuplicates := []string{filepath.ToSlash(filepath.Join(notesDir, "index.md")), filepath.ToSlash(filepath.Join(attachmentsDir, "index.md"))}
+		if !reflect.DeepEqual(idx.Duplicates("index"), expectedDuplicates) {
+			t.Errorf("BuildIndexDirs failed: incorrect duplicates for key index, got %v, want %v", idx.Duplicates("index"), expectedDuplicates)
+		}
+	}
+}
+
+func TestBuildIndexInclude(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	os.Mkdir(subDir, 0755)
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(tempDir, "image.png", "")
+	createTestFile(subDir, "other.md", "")
+	createTestFile(subDir, "draft.md", "")
+
+	tests := []struct {
+		include  []string
+		expected []string
+	}{
+		{include: nil, expected: []string{"image.png", "note.md", "sub/other.md"}},
+		{include: []string{"*.md"}, expected: []string{"note.md", "sub/other.md"}},
+		{include: []string{"*.md", "*.png"}, expected: []string{"image.png", "note.md", "sub/other.md"}},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			idx, err := BuildIndexWithOptions(tempDir, []string{"draft.md"}, IndexOptions{Include: test.include, Workers: workers})
+			if err != nil {
+				t.Fatalf("BuildIndexWithOptions failed: %v", err)
+			}
+			var paths []string
+			for _, fileInfo := range idx.Files() {
+				paths = append(paths, fileInfo.Path)
+			}
+			if !reflect.DeepEqual(paths, test.expected) {
+				t.Errorf("BuildIndexWithOptions failed for include %v, workers %d: got %v, want %v", test.include, workers, paths, test.expected)
+			}
+		}
+	}
+}
+
+func TestBuildIndexIgnoreStyle(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"notes", "notes/drafts", "drafts"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+	}
+	createTestFile(filepath.Join(tempDir, "notes"), "a.md", "")
+	createTestFile(filepath.Join(tempDir, "notes", "drafts"), "b.md", "")
+	createTestFile(filepath.Join(tempDir, "drafts"), "c.md", "")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, []string{"/drafts/"}, IndexOptions{IgnoreStyle: IgnoreStyleGitignore, Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		var paths []string
+		for _, fileInfo := range idx.Files() {
+			paths = append(paths, fileInfo.Path)
+		}
+		expected := []string{"notes/a.md", "notes/drafts/b.md"}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("BuildIndexWithOptions failed for workers %d: got %v, want %v", workers, paths, expected)
+		}
+	}
+}
+
+func TestBuildIndexIgnorePath(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for _, dir := range []string{"docs", "docs/node_modules", "node_modules"} {
+		os.Mkdir(filepath.Join(tempDir, dir), 0755)
+	}
+	createTestFile(filepath.Join(tempDir, "docs"), "a.md", "")
+	createTestFile(filepath.Join(tempDir, "docs", "node_modules"), "b.md", "")
+	createTestFile(filepath.Join(tempDir, "node_modules"), "c.md", "")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, []string{"docs/node_modules"}, IndexOptions{Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		var paths []string
+		for _, fileInfo := range idx.Files() {
+			paths = append(paths, fileInfo.Path)
+		}
+		expected := []string{"docs/a.md", "node_modules/c.md"}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("BuildIndexWithOptions failed for workers %d: got %v, want %v", workers, paths, expected)
+		}
+	}
+}
+
+func TestBuildIndexHeadings(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "# Title\n## Section One\n")
+	createTestFile(tempDir, "empty.md", "no headings\n")
+	createTestFile(tempDir, "image.png", "# not markdown\n")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Headings: true, Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		expected := map[string][]string{
+			"note":  {"title", "section-one"},
+			"empty": {},
+			"image": nil,
+		}
+		for key, headings := range expected {
+			fileInfo, _ := idx.Lookup(key)
+			if !reflect.DeepEqual(fileInfo.Headings, headings) {
+				t.Errorf("BuildIndexWithOptions failed for workers %d: headings of %s: got %#v, want %#v", workers, key, fileInfo.Headings, headings)
+			}
+		}
+	}
+}
+
+func TestBuildIndexMaxParseSize(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "---\ntitle: Note\n---\n# Title\n")
+	createTestFile(tempDir, "big.md", "---\ntitle: Big\n---\n# Title\n"+strings.Repeat("text\n", 100))
+	createTestFile(tempDir, "binary.md", "# Title\n\x00\x01")
+	createTestFile(tempDir, "zero.md", "")
+	createTestFile(tempDir, "image.png", "\x89PNG\x00")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Headings: true, Titles: true, MaxParseSize: 100, Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+		expected := map[string]FileInfo{
+			"note":   {Headings: []string{"title"}, Title: "Note"},
+			"big":    {Unparsed: "larger than 100 bytes"},
+			"binary": {Unparsed: "binary"},
+			"zero":   {Headings: []string{}},
+			"image":  {},
+		}
+		for key, want := range expected {
+			fileInfo, exists := idx.Lookup(key)
+			if !exists {
+				t.Errorf("BuildIndexWithOptions failed for workers %d: %s should be indexed", workers, key)
+				continue
+			}
+			if !reflect.DeepEqual(fileInfo.Headings, want.Headings) || fileInfo.Title != want.Title || fileInfo.Unparsed != want.Unparsed {
+				t.Errorf("BuildIndexWithOptions failed for workers %d: %s: got headings %#v, title %q, unparsed %q, want %#v, %q, %q", workers, key,
+					fileInfo.Headings, fileInfo.Title, fileInfo.Unparsed, want.Headings, want.Title, want.Unparsed)
+			}
+		}
+		if _, exists := idx.Lookup("Big"); exists {
+			t.Errorf("BuildIndexWithOptions failed for workers %d: title of an unparsed file should not be a key", workers)
+		}
+	}
+}
+
+func TestBuildIndexContext(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "file1.txt", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, workers := range []int{1, 4} {
+		_, err := BuildIndexContext(ctx, []string{tempDir}, nil, IndexOptions{Workers: workers})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("BuildIndexContext failed for workers %d: expected context.Canceled, got %v", workers, err)
+		}
+	}
+}
+
+func TestBuildIndexMaxFiles(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	for i := 0; i < 3; i++ {
+		createTestFile(tempDir, fmt.Sprintf("file%d.md", i), "")
+	}
+
+	tests := []struct {
+		maxFiles int
+		fail     bool
+	}{
+		{maxFiles: 1, fail: true},
+		{maxFiles: 2, fail: true},
+		{maxFiles: 3},
+		{maxFiles: 4},
+		{maxFiles: 0},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 4} {
+			_, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{MaxFiles: test.maxFiles, Workers: workers})
+			if (err != nil) != test.fail {
+				t.Errorf("BuildIndexWithOptions failed for MaxFiles %d, Workers %d: expected failure %v, got %v", test.maxFiles, workers, test.fail, err)
+			}
+			if !test.fail {
+				continue
+			}
+			var tooMany *TooManyFilesError
+			if !errors.As(err, &tooMany) || tooMany.Limit != test.maxFiles || tooMany.Count != 3 {
+				t.Errorf("BuildIndexWithOptions failed for MaxFiles %d, Workers %d: expected 3 files found, got %v", test.maxFiles, workers, err)
+			}
+		}
+	}
+}
+
+func TestBuildIndexDirsMaxFiles(t *testing.T) {
+	dirs := []string{createTempDir(t), createTempDir(t)}
+	for _, dir := range dirs {
+		defer os.RemoveAll(dir)
+		createTestFile(dir, "a.md", "")
+		createTestFile(dir, "b.md", "")
+	}
+
+	for _, workers := range []int{1, 4} {
+		_, err := BuildIndexDirs(dirs, nil, IndexOptions{MaxFiles: 3, Workers: workers})
+		want := "too many files: found 4, limit is 3"
+		if err == nil || err.Error() != want {
+			t.Errorf("BuildIndexDirs failed for Workers %d: expected %q, got %v", workers, want, err)
+		}
+		if _, err := BuildIndexDirs(dirs, nil, IndexOptions{MaxFiles: 4, Workers: workers}); err != nil {
+			t.Errorf("BuildIndexDirs failed for Workers %d: unexpected error at the limit: %v", workers, err)
+		}
+	}
+}
+
+func BenchmarkBuildIndexSerial(b *testing.B) {
+	benchmarkBuildIndex(b, 1)
+}
+
+func BenchmarkBuildIndexParallel(b *testing.B) {
+	benchmarkBuildIndex(b, 8)
+}
+
+// benchmarkBuildIndex indexes a vault of 8000 files spread over 200
+// directories.
+func benchmarkBuildIndex(b *testing.B, workers int) {
+	tempDir, err := os.MkdirTemp("", "linklore_bench")
+	if err != nil {
+		b.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(tempDir, fmt.Sprintf("dir%03d", i))
+		os.Mkdir(dir, 0755)
+		for j := 0; j < 40; j++ {
+			createTestFile(dir, fmt.Sprintf("note%03d-%02d.md", i, j), "")
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Workers: workers}); err != nil {
+			b.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+	}
+}
+
+func createTempDir(t *testing.T) string {
+	tempDir, err := os.MkdirTemp("", "linklore_test")
+	if err != nil {
+		t.Fatalf("createTempDir failed: %v", err)
+	}
+	return tempDir
+}
+
+func createTestFile(dir, filename, content string) {
+	filePath := filepath.Join(dir, filename)
+	err := os.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestBuildIndexTitles(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "2024-01-my-great-note.md", "---\ntitle: My Great Note\ntags: [a]\n---\n# Heading\n")
+	createTestFile(tempDir, "self.md", "---\ntitle: self\n---\n")
+	createTestFile(tempDir, "quoted.md", "---\ntitle: \"Other: Note\"\n---\n")
+	createTestFile(tempDir, "clash.md", "---\ntitle: target\n---\n")
+	createTestFile(tempDir, "target.md", "")
+	createTestFile(tempDir, "plain.txt", "---\ntitle: Plain\n---\n")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Titles: true, Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+
+		tests := []struct {
+			base     string
+			expected string
+			err      error
+		}{
+			{base: "My Great Note", expected: "2024-01-my-great-note.md"},
+			{base: "2024-01-my-great-note", expected: "2024-01-my-great-note.md"},
+			{base: "self", expected: "self.md"},
+			{base: "Other: Note", expected: "quoted.md"},
+			{base: "target", err: ErrAmbiguousLink},
+			{base: "Plain", err: ErrLinkNotFound},
+		}
+		for _, test := range tests {
+			fileInfo, err := idx.Resolve(test.base)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Resolve failed for %s with %d workers: expected error %v, got %v", test.base, workers, test.err, err)
+			}
+			if fileInfo.Path != test.expected {
+				t.Errorf("Resolve failed for %s with %d workers: got %s, want %s", test.base, workers, fileInfo.Path, test.expected)
+			}
+		}
+		if keys := idx.DuplicateKeys(); !reflect.DeepEqual(keys, []string{"target"}) {
+			t.Errorf("BuildIndexWithOptions failed: incorrect duplicate keys, got %v, want [target]", keys)
+		}
+	}
+
+	idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{})
+	if err != nil {
+		t.Fatalf("BuildIndexWithOptions failed: %v", err)
+	}
+	if _, err := idx.Resolve("My Great Note"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("Resolve failed: titles are not keys by default, got %v", err)
+	}
+}
+
+func TestBuildIndexAliases(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "---\naliases: [foo, bar, note]\n---\n")
+	createTestFile(tempDir, "list.md", "---\naliases:\n  - \"Block Alias\"\n  - shared\n---\n")
+	createTestFile(tempDir, "other.md", "---\naliases: shared\ntitle: Other Title\n---\n")
+	createTestFile(tempDir, "image.png", "")
+
+	for _, workers := range []int{1, 4} {
+		idx, err := BuildIndexWithOptions(tempDir, nil, IndexOptions{Aliases: true, Workers: workers})
+		if err != nil {
+			t.Fatalf("BuildIndexWithOptions failed: %v", err)
+		}
+
+		tests := []struct {
+			base     string
+			expected string
+			err      error
+		}{
+			{base: "foo", expected: "note.md"},
+			{base: "bar", expected: "note.md"},
+			{base: "note", expected: "note.md"},
+			{base: "Block Alias", expected: "list.md"},
+			{base: "shared", err: ErrAmbiguousLink},
+			{base: "Other Title", err: ErrLinkNotFound},
+		}
+		for _, test := range tests {
+			fileInfo, err := idx.Resolve(test.base)
+			if !errors.Is(err, test.err) {
+				t.Errorf("Resolve failed for %s with %d workers: expected error %v, got %v", test.base, workers, test.err, err)
+			}
+			if fileInfo.Path != test.expected {
+				t.Errorf("Resolve failed for %s with %d workers: got %s, want %s", test.base, workers, fileInfo.Path, test.expected)
+			}
+		}
+		expectedDuplicates := []string{"list.md", "other.md"}
+		if paths := idx.Duplicates("shared"); !reflect.DeepEqual(paths, expectedDuplicates) {
+			t.Errorf("BuildIndexWithOptions failed: incorrect duplicates for shared, got %v, want %v", paths, expectedDuplicates)
+		}
+	}
+}
+
+func TestResolveLeadingSlash(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	os.Mkdir(filepath.Join(tempDir, "sub"), 0755)
+	createTestFile(filepath.Join(tempDir, "sub"), "note.md", "")
+	createTestFile(filepath.Join(tempDir, "sub"), "image.png", "")
+	createTestFile(tempDir, "top.md", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		base     string
+		expected string
+		err      error
+	}{
+		{base: "/sub/note", expected: "sub/note.md"},
+		{base: "/sub/note.md", expected: "sub/note.md"},
+		{base: "/sub/image.png", expected: "sub/image.png"},
+		{base: "/top", expected: "top.md"},
+		{base: "/note", err: ErrLinkNotFound},
+		{base: "/other/note", err: ErrLinkNotFound},
+	}
+	for _, test := range tests {
+		fileInfo, err := idx.Resolve(test.base)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Resolve failed for %s: expected error %v, got %v", test.base, test.err, err)
+		}
+		if fileInfo.Path != test.expected {
+			t.Errorf("Resolve failed for %s: got %s, want %s", test.base, fileInfo.Path, test.expected)
+		}
+	}
+}
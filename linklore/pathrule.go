@@ -0,0 +1,39 @@
+package linklore
+
+import (
+	"path"
+	"regexp"
+)
+
+// PathRewriter returns the link to fileInfo, used in place of Prefix joined
+// with its path. The link is used as is, so it must be escaped. An empty
+// link falls back to the default one.
+type PathRewriter func(fileInfo FileInfo) string
+
+// datedNamePattern matches names starting with a date, e.g.
+// "2024-01-15-hello.md".
+var datedNamePattern = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2})-(.+)$`)
+
+// DatePathRewriter returns a PathRewriter that moves files named after a
+// date into one directory per year, month and day under opts.Prefix, like
+// Jekyll permalinks: "posts/2024-01-15-hello.md" links to
+// "/2024/01/15/hello". Other files keep the default link. StripExt and
+// ExtMap still apply.
+func DatePathRewriter(opts Options) PathRewriter {
+	return func(fileInfo FileInfo) string {
+		submatches := datedNamePattern.FindStringSubmatch(fileInfo.Name)
+		if submatches == nil {
+			return ""
+		}
+		return joinPrefix(opts.Prefix, linkPath(path.Join(submatches[1:]...), fileInfo, opts))
+	}
+}
+
+// FlatPathRewriter returns a PathRewriter that links every file directly
+// under opts.Prefix, dropping its directories, e.g. "notes/go/tools.md"
+// links to "/tools". StripExt and ExtMap still apply.
+func FlatPathRewriter(opts Options) PathRewriter {
+	return func(fileInfo FileInfo) string {
+		return joinPrefix(opts.Prefix, linkPath(fileInfo.Name, fileInfo, opts))
+	}
+}
@@ -0,0 +1,44 @@
+package linklore
+
+import "testing"
+
+func TestPathRewriter(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "2024-01-15-hello world.md", Basename: "2024-01-15-hello world", Ext: ".md", Path: "posts/2024-01-15-hello world.md"},
+		FileInfo{Name: "tools.md", Basename: "tools", Ext: ".md", Path: "notes/go/tools.md"},
+		FileInfo{Name: "diagram.png", Basename: "diagram", Ext: ".png", Path: "assets/diagram.png"},
+	)
+
+	custom := func(fileInfo FileInfo) string {
+		if fileInfo.Ext == ".png" {
+			return "https://cdn.example.com/" + fileInfo.Name
+		}
+		return ""
+	}
+	tests := []struct {
+		name     string
+		rewriter func(Options) PathRewriter
+		opts     Options
+		input    string
+		expected string
+	}{
+		{name: "date", rewriter: DatePathRewriter, opts: Options{Prefix: "/blog"}, input: "[[2024-01-15-hello world#Intro]]", expected: "[2024-01-15-hello world](/blog/2024/01/15/hello-world#Intro)"},
+		{name: "date", rewriter: DatePathRewriter, opts: Options{Prefix: "/", ExtMap: map[string]string{".md": ".html"}}, input: "[[2024-01-15-hello world]]", expected: "[2024-01-15-hello world](/2024/01/15/hello-world.html)"},
+		{name: "date", rewriter: DatePathRewriter, opts: Options{Prefix: "/"}, input: "[[tools]]", expected: "[tools](/notes/go/tools)"},
+		{name: "flat", rewriter: FlatPathRewriter, opts: Options{Prefix: "/wiki/"}, input: "[[tools]] ![[diagram.png]]", expected: "[tools](/wiki/tools) ![diagram.png](/wiki/diagram.png)"},
+		{name: "flat", rewriter: FlatPathRewriter, opts: Options{Prefix: "/", StripExt: true}, input: "![[diagram.png]]", expected: "![diagram.png](/diagram)"},
+		{name: "custom", rewriter: func(Options) PathRewriter { return custom }, opts: Options{Prefix: "/"}, input: "![[diagram.png]] [[tools]]", expected: "![diagram.png](https://cdn.example.com/diagram.png) [tools](/notes/go/tools)"},
+	}
+
+	for _, test := range tests {
+		opts := test.opts
+		opts.PathRewriter = test.rewriter(opts)
+		output, errs := Rewrite(test.input, idx, opts)
+		if len(errs) > 0 {
+			t.Errorf("Rewriter: %s, Input: %s, unexpected errors: %v", test.name, test.input, errs)
+		}
+		if output != test.expected {
+			t.Errorf("Rewriter: %s, Input: %s, Expected: %s, Got: %s", test.name, test.input, test.expected, output)
+		}
+	}
+}
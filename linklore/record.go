@@ -0,0 +1,53 @@
+package linklore
+
+import "path/filepath"
+
+// LinkRecord describes how a wikilink was handled, e.g. for an audit report.
+// Its JSON form is stable, so that reports of different runs can be
+// compared.
+type LinkRecord struct {
+	// Source is the file the link was found in, and Line and Column its
+	// position, starting at 1. The column counts characters, not bytes.
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// Text is the wikilink as written, e.g. "[[note#Heading|alias]]".
+	Text   string `json:"text"`
+	Embed  bool   `json:"embed"`
+	Base   string `json:"base"`
+	Alias  string `json:"alias"`
+	Anchor string `json:"anchor"`
+	Block  string `json:"block"`
+	// Path is the slash-separated path of the file the link resolved to,
+	// relative to its base directory, or nil if it did not resolve. A link
+	// to a heading of the current file, such as "[[#Heading]]", resolves
+	// to Options.Source.
+	Path *string `json:"path"`
+	// Replacement is what the link was replaced with, and Error why it could
+	// not be rewritten, if it could not.
+	Replacement string `json:"replacement"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DescribeLink returns the record of match, a single match of opts.Pattern,
+// with its components and the path it resolves to in idx. The caller sets
+// the position, the replacement and the error.
+func DescribeLink(match string, idx Index, opts Options) LinkRecord {
+	link := parseWikiLink(match, opts)
+	record := LinkRecord{
+		Text:   match,
+		Embed:  link.Embed,
+		Base:   link.Base,
+		Alias:  link.Alias,
+		Anchor: link.Anchor,
+		Block:  link.Block,
+	}
+	switch fileInfo, err := resolve(idx, link.Base, opts); {
+	case link.Base == "" && link.Anchor != "":
+		record.Path = &opts.Source
+	case err == nil:
+		path := filepath.ToSlash(fileInfo.Path)
+		record.Path = &path
+	}
+	return record
+}
@@ -0,0 +1,42 @@
+package linklore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDescribeLink(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "sub/note.md"})
+	opts := Options{Source: "input.md"}
+
+	tests := []struct {
+		match    string
+		expected string
+	}{
+		{
+			match:    "[[note]]",
+			expected: `{"source":"","line":0,"column":0,"text":"[[note]]","embed":false,"base":"note","alias":"","anchor":"","block":"","path":"sub/note.md","replacement":""}`,
+		},
+		{
+			match:    "![[note#Heading^abc|Alias]]",
+			expected: `{"source":"","line":0,"column":0,"text":"![[note#Heading^abc|Alias]]","embed":true,"base":"note","alias":"Alias","anchor":"Heading","block":"abc","path":"sub/note.md","replacement":""}`,
+		},
+		{
+			match:    "[[missing|Alias]]",
+			expected: `{"source":"","line":0,"column":0,"text":"[[missing|Alias]]","embed":false,"base":"missing","alias":"Alias","anchor":"","block":"","path":null,"replacement":""}`,
+		},
+		{
+			match:    "[[#Heading]]",
+			expected: `{"source":"","line":0,"column":0,"text":"[[#Heading]]","embed":false,"base":"","alias":"","anchor":"Heading","block":"","path":"input.md","replacement":""}`,
+		},
+	}
+	for _, test := range tests {
+		record, err := json.Marshal(DescribeLink(test.match, idx, opts))
+		if err != nil {
+			t.Fatalf("json.Marshal failed: %v", err)
+		}
+		if string(record) != test.expected {
+			t.Errorf("DescribeLink failed for %s: got %s, want %s", test.match, record, test.expected)
+		}
+	}
+}
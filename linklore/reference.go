@@ -0,0 +1,44 @@
+package linklore
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// RefTemplate renders reference-style Markdown links, used instead of
+// DefaultTemplate when Options.References is set.
+const RefTemplate = `{{if .Image}}!{{end}}[{{.Alias}}][{{.Ref}}]`
+
+var refTemplate = template.Must(template.New("ref").Parse(RefTemplate))
+
+// References numbers the targets of reference-style links in the order they
+// are first used, so that identical targets share a number. The zero value
+// is ready to use.
+type References struct {
+	links   []string
+	numbers map[string]int
+}
+
+// Add returns the number of link, adding it if it is new.
+func (r *References) Add(link string) int {
+	if number, exists := r.numbers[link]; exists {
+		return number
+	}
+	if r.numbers == nil {
+		r.numbers = make(map[string]int)
+	}
+	r.links = append(r.links, link)
+	r.numbers[link] = len(r.links)
+	return len(r.links)
+}
+
+// Definitions returns the link reference definitions, one per line, e.g.
+// "[1]: /note", or "" if no link was added.
+func (r *References) Definitions() string {
+	var definitions strings.Builder
+	for i, link := range r.links {
+		fmt.Fprintf(&definitions, "[%d]: %s\n", i+1, link)
+	}
+	return definitions.String()
+}
@@ -0,0 +1,48 @@
+package linklore
+
+import "testing"
+
+func TestReferences(t *testing.T) {
+	var refs References
+	if refs.Definitions() != "" {
+		t.Errorf("Definitions failed: expected no definitions, got %q", refs.Definitions())
+	}
+	for _, test := range []struct {
+		link     string
+		expected int
+	}{
+		{link: "/a", expected: 1},
+		{link: "/b", expected: 2},
+		{link: "/a", expected: 1},
+		{link: "/a#heading", expected: 3},
+	} {
+		if number := refs.Add(test.link); number != test.expected {
+			t.Errorf("Add failed for %s: got %d, want %d", test.link, number, test.expected)
+		}
+	}
+	expected := "[1]: /a\n[2]: /b\n[3]: /a#heading\n"
+	if refs.Definitions() != expected {
+		t.Errorf("Definitions failed: got %q, want %q", refs.Definitions(), expected)
+	}
+}
+
+func TestRewriteReferences(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"},
+		FileInfo{Name: "image.png", Basename: "image", Ext: ".png", Path: "image.png"},
+	)
+
+	refs := &References{}
+	output, errs := Rewrite("[[note]], ![[image.png]], [[note|again]] and [[#Intro]]", idx, Options{Prefix: "/", References: refs})
+	if len(errs) > 0 {
+		t.Fatalf("Rewrite failed: %v", errs)
+	}
+	expected := "[note][1], ![image.png][2], [again][1] and [Intro][3]"
+	if output != expected {
+		t.Errorf("Rewrite failed: got %q, want %q", output, expected)
+	}
+	expectedDefinitions := "[1]: /note\n[2]: /image.png\n[3]: #Intro\n"
+	if refs.Definitions() != expectedDefinitions {
+		t.Errorf("Definitions failed: got %q, want %q", refs.Definitions(), expectedDefinitions)
+	}
+}
@@ -0,0 +1,710 @@
+package linklore
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+var (
+	// Match an optional ! at the beginning.
+	// Then [[ optionally followed by a series of characters that are not |, [, ], #, or ^ (the base link).
+	// Optionally match a | followed by a series of characters that are not [, ], #, or ^ (the alias),
+	// which may contain further |, as in [[base|Display | Subtitle]].
+	// Optionally match a # followed by a series of characters that are not |, [, ], #, or ^ (the anchor).
+	// Optionally match a ^ followed by a series of characters that are not |, [, ], #, or ^ (the block).
+	// Optionally match a | followed by the alias, as in Obsidian's [[base#anchor|alias]].
+	// Finally match the closing ]].
+	// Components may contain brackets escaped with a backslash, as in [[Note \[v2\]]].
+	linkComponentPattern = `((?:\\[\[\]]|[^|\[\]#^])+)`
+	linkAliasPattern     = `((?:\\[\[\]]|[^\[\]#^])+)`
+	LinkPattern          = regexp.MustCompile(`!?` +
+		`\[\[` + linkComponentPattern + `?` +
+		`(?:\|` + linkAliasPattern + `)?` +
+		`(?:#` + linkComponentPattern + `)?` +
+		`(?:\^` + linkComponentPattern + `)?` +
+		`(?:\|` + linkAliasPattern + `)?` +
+		`\]\]`)
+)
+
+// Embed modes control how ![[...]] embeds of non-image files are rendered.
+// Embeds of image files are always rendered as Markdown images.
+const (
+	EmbedModeLink   = "link"
+	EmbedModeImage  = "image"
+	EmbedModeInline = "inline"
+)
+
+// Block modes control how ^block references are rendered.
+const (
+	// BlockModeKeep appends the reference as "#^block", like Obsidian Publish.
+	BlockModeKeep = "keep"
+	// BlockModeSlug appends the block ID without the caret, "#block".
+	BlockModeSlug = "slug"
+	// BlockModeDrop omits block references.
+	BlockModeDrop = "drop"
+)
+
+// Unresolved modes control what replaces a link to a file that is not found.
+const (
+	// UnresolvedModeKeep leaves the wikilink unchanged.
+	UnresolvedModeKeep = "keep"
+	// UnresolvedModePlain replaces the wikilink with its alias, or its base.
+	UnresolvedModePlain = "plain"
+	// UnresolvedModeRemove removes the wikilink.
+	UnresolvedModeRemove = "remove"
+)
+
+// Self-link modes control links from a file to itself, such as [[note]] in
+// note.md, which are usually meant as links to a heading of the same page.
+const (
+	// SelfLinkModeKeep rewrites them as any other link.
+	SelfLinkModeKeep = "keep"
+	// SelfLinkModeAnchor rewrites them as same-page links: the anchor
+	// prefix followed by the anchor, if any.
+	SelfLinkModeAnchor = "anchor"
+	// SelfLinkModeWarn rewrites them as any other link and reports them
+	// with ErrSelfLink.
+	SelfLinkModeWarn = "warn"
+)
+
+// Link formats select how the base of a link is resolved, like Obsidian's
+// "New link format" setting. Links that cannot be resolved in the selected
+// format fall back to LinkFormatShortest, so vaults mixing formats work.
+const (
+	// LinkFormatShortest resolves the base as a file name, or as a path from
+	// the base directory if it contains a "/".
+	LinkFormatShortest = "shortest"
+	// LinkFormatRelative resolves the base as a path relative to the
+	// directory of Options.Source.
+	LinkFormatRelative = "relative"
+	// LinkFormatAbsolute resolves the base as a path from the base directory.
+	LinkFormatAbsolute = "absolute"
+)
+
+// DefaultImageExtensions are the extensions of the files whose embeds are
+// rendered as images when Options.ImageExtensions is nil.
+var DefaultImageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp"}
+
+// Options configures how wikilinks are rewritten.
+type Options struct {
+	// Prefix is prepended to the path of every link.
+	Prefix string
+	// BaseURL is the scheme and host, and possibly a path, that the prefix
+	// of every link is under, e.g. "https://example.com" with Prefix "/wiki/"
+	// links "note.md" as "https://example.com/wiki/note.md". Prefixes that are
+	// URLs themselves are kept. Empty means the prefix is used alone.
+	BaseURL string
+	// PrefixMap maps directories, relative to the base directory, to the
+	// prefix of the files under them, which replaces both Prefix and the
+	// directory, e.g. {"blog": "/posts/"} links "blog/hello.md" as
+	// "/posts/hello.md". The longest matching directory wins, and Prefix
+	// applies to the files under none of them.
+	PrefixMap map[string]string
+	// StripExt removes the file extension from link paths.
+	StripExt bool
+	// ExtMap replaces the extension of link paths, e.g. {".md": ".html"} for
+	// a site that publishes notes as HTML. Extensions that are not in the
+	// map are kept. StripExt takes precedence.
+	ExtMap map[string]string
+	// EmbedMode is one of the EmbedMode constants. Empty means EmbedModeLink.
+	EmbedMode string
+	// ImageExtensions lists the extensions, such as ".png", of the files
+	// whose embeds are rendered as images whatever EmbedMode is. They are
+	// compared case-insensitively. Nil means DefaultImageExtensions.
+	ImageExtensions []string
+	// MaxEmbedDepth limits how many embeds inlined with EmbedModeInline can
+	// be nested inside each other, so that notes embedding each other do
+	// not recurse forever. Zero means DefaultMaxEmbedDepth.
+	MaxEmbedDepth int
+	// AnchorPrefix separates the path of a link from its anchor, e.g.
+	// "?id=" for a site that addresses headings with a query parameter.
+	// Empty means "#".
+	AnchorPrefix string
+	// SlugifyAnchors converts anchors to the heading IDs generated by the
+	// renderer selected with AnchorStyle.
+	SlugifyAnchors bool
+	// AnchorStyle is one of the AnchorStyle constants. Empty means
+	// AnchorStyleGitHub.
+	AnchorStyle string
+	// BlockMode is one of the BlockMode constants. Empty means
+	// BlockModeKeep.
+	BlockMode string
+	// Template renders each link from a TemplateData. Nil means
+	// DefaultTemplate, or RefTemplate if References is set.
+	Template *template.Template
+	// PathRewriter, if set, returns the link to each file instead of Prefix
+	// joined with its path, e.g. to follow the URL rules of a site. See
+	// DatePathRewriter and FlatPathRewriter.
+	PathRewriter PathRewriter
+	// References collects the target of every rendered link, which is then
+	// available to the template as Ref. The caller appends
+	// References.Definitions to the rewritten content.
+	References *References
+	// LinkFormat is one of the LinkFormat constants. Empty means
+	// LinkFormatShortest.
+	LinkFormat string
+	// Source is the path of the file being rewritten, relative to the base
+	// directory of the index. LinkFormatRelative and RelativeLinks need it.
+	Source string
+	// RelativeLinks writes the path of each link relative to the directory
+	// of Source, e.g. "../other/note", instead of joined with Prefix, which
+	// is ignored. Files in another base directory are linked as if they
+	// were in the base directory of Source.
+	RelativeLinks bool
+	// ResolveNearest resolves a link shared by several files to the one
+	// nearest to Source, counting the directories between them, like the
+	// shortest link format of Obsidian. Links whose nearest files are at the
+	// same distance are still ambiguous. Source must be set.
+	ResolveNearest bool
+	// ValidateAnchors reports anchors that do not name a heading of the
+	// target file. The index must be built with IndexOptions.Headings.
+	ValidateAnchors bool
+	// UnresolvedMode is one of the UnresolvedMode constants. Empty means
+	// UnresolvedModeKeep.
+	UnresolvedMode string
+	// FrontmatterMode is one of the FrontmatterMode constants. Empty means
+	// FrontmatterModeProcess.
+	FrontmatterMode string
+	// SelfLinkMode is one of the SelfLinkMode constants. Empty means
+	// SelfLinkModeKeep. Links are detected as self-links by comparing their
+	// target with Source, so Source must be set. Embeds are left alone.
+	SelfLinkMode string
+	// PathTransform is one of the PathTransform constants. Empty means
+	// PathTransformNone. Only the links are transformed; the files are
+	// still looked up by their real names.
+	PathTransform string
+	// MaxComponentLength is the maximum length in bytes of the base, alias,
+	// anchor and block of a link. Longer links, such as an unclosed "[[" in
+	// a malformed note, are left unchanged and reported with
+	// ErrLinkTooLong. Zero means no limit; the command line uses
+	// DefaultMaxComponentLength.
+	MaxComponentLength int
+	// Pattern matches the wikilinks to rewrite, e.g. one returned by
+	// CompilePattern. Nil means LinkPattern.
+	Pattern *regexp.Regexp
+	// Logger receives a debug record for each link resolution. Nil means
+	// slog.Default().
+	Logger *slog.Logger
+}
+
+// DefaultMaxComponentLength is the default for Options.MaxComponentLength
+// on the command line.
+const DefaultMaxComponentLength = 1024
+
+// shortLinkLength is the number of bytes of a link too long to be rewritten
+// kept in its LinkError.
+const shortLinkLength = 64
+
+// DefaultTemplate renders Markdown links, and Markdown images for embeds
+// rendered as images.
+const DefaultTemplate = `{{if .Image}}!{{end}}[{{.Alias}}]({{.Link}})`
+
+var defaultTemplate = template.Must(template.New("link").Parse(DefaultTemplate))
+
+// TitleTemplate renders Markdown links like DefaultTemplate, with the base
+// of the wikilink as the link title when the alias hides it, e.g.
+// [Shown](/real-note "Real Note") for [[Real Note|Shown]].
+const TitleTemplate = `{{if .Image}}!{{end}}[{{.Alias}}]({{.Link}}{{with .Title}} "{{html .}}"{{end}})`
+
+// TemplateData is the data a link template is executed with. Path and
+// Anchor are escaped for use in a URL.
+type TemplateData struct {
+	// Alias is the link text: the alias of the wikilink, or its base. It is
+	// escaped for use as Markdown link text.
+	Alias string
+	// Title is the base of the wikilink when its alias differs from it,
+	// e.g. "Real Note" for [[Real Note|Shown]], and empty otherwise, for use
+	// as a title attribute. It is not escaped.
+	Title string
+	// Link is Prefix and Path joined, or the link returned by
+	// Options.PathRewriter, followed by Options.AnchorPrefix and Anchor if
+	// any.
+	Link   string
+	Prefix string
+	Path   string
+	// Anchor is the slugified heading, without "#".
+	Anchor string
+	// Block is the block reference as rendered by the block mode, without
+	// "#", e.g. "^abc123". When both are present, Link ends with Anchor
+	// followed by Block, e.g. "#heading^abc123", except in BlockModeSlug
+	// where Block is an element ID of its own and replaces Anchor.
+	Block string
+	// Ext is the extension of the target file, e.g. ".md".
+	Ext string
+	// Image reports whether the link is an embed rendered as an image.
+	Image bool
+	// Ref is the number of Link in Options.References, or 0 if it is nil.
+	Ref int
+}
+
+// LinkError records a wikilink that could not be rewritten.
+type LinkError struct {
+	Link string
+	Err  error
+}
+
+func (e *LinkError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, e.Link)
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+// Rewrite replaces every wikilink in content with a Markdown link, except
+// in code (see FindLinks) and, with FrontmatterModeSkip, in the
+// frontmatter. Links that cannot be rewritten are left unchanged, or
+// replaced according to opts.UnresolvedMode if their file is not found, and
+// reported as *LinkError. Links with an unknown anchor are rewritten and
+// reported too.
+func Rewrite(content string, idx Index, opts Options) (string, []error) {
+	return rewrite(content, idx, opts, embedContext{})
+}
+
+// rewrite is Rewrite for content inlined as described by embed. The errors
+// of the links of the content that embeds inline are reported along with
+// the others.
+func rewrite(content string, idx Index, opts Options, embed embedContext) (string, []error) {
+	var errs []error
+	var rewritten strings.Builder
+	skip := 0
+	if opts.FrontmatterMode == FrontmatterModeSkip {
+		skip = FrontmatterEnd(content)
+	}
+	end := 0
+	for _, loc := range FindLinks(opts.pattern(), content) {
+		if loc[0] < skip {
+			continue
+		}
+		rewritten.WriteString(content[end:loc[0]])
+		end = loc[1]
+
+		match := content[loc[0]:loc[1]]
+		replacement, err := replaceLink(match, idx, opts, embed)
+		var embedErr *EmbedError
+		if errors.As(err, &embedErr) {
+			errs = append(errs, embedErr.Errs...)
+		} else if err != nil {
+			errs = append(errs, err)
+			if !errors.Is(err, ErrLinkNotFound) && !IsWarning(err) {
+				replacement = match
+			}
+		}
+		rewritten.WriteString(replacement)
+	}
+	rewritten.WriteString(content[end:])
+	return rewritten.String(), errs
+}
+
+// ReplaceLink returns the Markdown replacement for match, a single match of
+// opts.Pattern. The returned error is a *LinkError. A replacement is still
+// returned along with an error wrapping ErrLinkNotFound, following
+// opts.UnresolvedMode, and with the errors for which IsWarning is true. An
+// embed inlined with EmbedModeInline is returned along with an *EmbedError
+// if some links of its content could not be rewritten.
+func ReplaceLink(match string, idx Index, opts Options) (string, error) {
+	return replaceLink(match, idx, opts, embedContext{})
+}
+
+// replaceLink is ReplaceLink for a link of content inlined as described by
+// embed.
+func replaceLink(match string, idx Index, opts Options, embed embedContext) (string, error) {
+	base, alias, anchor, block := parseLink(match, opts)
+	if limit := opts.MaxComponentLength; limit > 0 {
+		for _, component := range []string{base, alias, anchor, block} {
+			if len(component) > limit {
+				return "", &LinkError{Link: shortenLink(match), Err: ErrLinkTooLong}
+			}
+		}
+	}
+
+	// [[#Heading]] links to a heading of the current file.
+	if base == "" && anchor != "" {
+		data := TemplateData{Alias: alias, Anchor: url.PathEscape(slugifyAnchor(anchor, opts))}
+		data.Link = opts.anchorPrefix() + data.Anchor
+		if data.Alias == "" {
+			data.Alias = anchor
+		}
+		return render(match, data, opts)
+	}
+
+	fileInfo, err := resolve(idx, base, opts)
+	if err != nil {
+		opts.logger().Debug("link unresolved", "link", match, "keys", idx.resolveKeys(base), "error", err)
+		if errors.Is(err, ErrLinkNotFound) {
+			return unresolvedText(match, base, alias, opts), &LinkError{Link: match, Err: err}
+		}
+		return "", &LinkError{Link: match, Err: err}
+	}
+	opts.logger().Debug("link resolved", "link", match, "path", fileInfo.Path)
+
+	prefix, mappedPath := mapPrefix(filepath.ToSlash(fileInfo.Path), opts)
+	data := TemplateData{
+		Alias:  alias,
+		Prefix: withBaseURL(prefix, opts),
+		Path:   linkPath(mappedPath, fileInfo, opts),
+		Ext:    fileInfo.Ext,
+	}
+	if opts.RelativeLinks {
+		data.Prefix = ""
+		data.Path = linkPath(relativePath(embed.linkSource(opts), fileInfo.Path), fileInfo, opts)
+	}
+	if opts.PathRewriter != nil {
+		data.Link = opts.PathRewriter(fileInfo)
+	}
+	if data.Link == "" {
+		data.Link = joinPrefix(data.Prefix, data.Path)
+	}
+	if anchor != "" {
+		data.Anchor = url.PathEscape(slugifyAnchor(anchor, opts))
+	}
+	if block != "" {
+		data.Block = blockFragment(block, opts)
+	}
+	fragment := linkFragment(data.Anchor, data.Block, opts)
+	if fragment != "" {
+		data.Link += opts.anchorPrefix() + fragment
+	}
+	self := !strings.HasPrefix(match, "!") && isSource(fileInfo, opts)
+	if self && opts.SelfLinkMode == SelfLinkModeAnchor {
+		data.Link = opts.anchorPrefix() + fragment
+	}
+
+	if data.Alias == "" {
+		data.Alias = base
+	} else if data.Alias != base {
+		data.Title = base
+	}
+
+	if strings.HasPrefix(match, "!") {
+		switch {
+		case opts.EmbedMode == EmbedModeInline && fileInfo.Ext == ".md":
+			if embed.depth >= opts.maxEmbedDepth() {
+				return "", &LinkError{Link: match, Err: ErrEmbedTooDeep}
+			}
+			content, found, err := embeddedContent(fileInfo, anchor, block, idx, opts)
+			if err != nil {
+				return "", &LinkError{Link: match, Err: fmt.Errorf("failed to inline embed: %w", err)}
+			}
+			if !found {
+				// Linked instead, like a link to a missing heading.
+				replacement, err := render(match, data, opts)
+				if err == nil {
+					err = &LinkError{Link: match, Err: ErrAnchorNotFound}
+				}
+				return replacement, err
+			}
+			// The links of the embedded content are rewritten too, resolved
+			// from the embedded file but still written from the file the
+			// content ends up in, inlining its own embeds one level deeper.
+			nested := opts
+			nested.Source = fileInfo.Path
+			content, errs := rewrite(content, idx, nested, embedContext{depth: embed.depth + 1, source: embed.linkSource(opts)})
+			content = strings.TrimRight(content, "\n")
+			if len(errs) > 0 {
+				return content, &LinkError{Link: match, Err: &EmbedError{Errs: errs}}
+			}
+			return content, nil
+		case opts.EmbedMode == EmbedModeImage || opts.isImage(fileInfo.Ext):
+			data.Image = true
+		}
+	}
+
+	replacement, err := render(match, data, opts)
+	if err == nil && opts.ValidateAnchors && anchor != "" && fileInfo.Headings != nil && !fileInfo.HasHeading(anchor) {
+		err = &LinkError{Link: match, Err: ErrAnchorNotFound}
+	}
+	if err == nil && self && opts.SelfLinkMode == SelfLinkModeWarn {
+		err = &LinkError{Link: match, Err: ErrSelfLink}
+	}
+	return replacement, err
+}
+
+// shortenLink returns the first shortLinkLength bytes of match followed by
+// "...", cut at a rune boundary, or match if it is short enough.
+func shortenLink(match string) string {
+	if len(match) <= shortLinkLength {
+		return match
+	}
+	end := shortLinkLength
+	for end > 0 && !utf8.RuneStart(match[end]) {
+		end--
+	}
+	return match[:end] + "..."
+}
+
+// IsWarning reports whether err, returned by ReplaceLink, is only a warning:
+// the link was rewritten, but its anchor is not a heading of the target
+// file, or it links to its own file.
+func IsWarning(err error) bool {
+	return errors.Is(err, ErrAnchorNotFound) || errors.Is(err, ErrSelfLink)
+}
+
+// isSource reports whether fileInfo is the file being rewritten.
+func isSource(fileInfo FileInfo, opts Options) bool {
+	return opts.Source != "" && filepath.ToSlash(opts.Source) == filepath.ToSlash(fileInfo.Path)
+}
+
+// parseLink returns the components of match, a single match of
+// opts.Pattern. The alias may come before or after the anchor and block.
+// Backslash escapes, such as "\[" in "[[Note \[v2\]]]", are removed from
+// the base and the alias. A percent-encoded base, such as "My%20Note" pasted
+// from a browser, is decoded, since link paths are encoded on output.
+func parseLink(match string, opts Options) (base, alias, anchor, block string) {
+	submatches := opts.pattern().FindStringSubmatch(match)
+	alias = submatches[2]
+	if alias == "" {
+		alias = submatches[5]
+	}
+	alias = unescapeBackslashes(alias)
+	base = unescapeBackslashes(submatches[1])
+	if decoded, err := url.PathUnescape(base); err == nil {
+		base = decoded
+	}
+	return base, alias, submatches[3], submatches[4]
+}
+
+// unescapeBackslashes removes the backslash before each ASCII punctuation
+// character of s, as Markdown does.
+func unescapeBackslashes(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var unescaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			i++
+		}
+		unescaped.WriteByte(s[i])
+	}
+	return unescaped.String()
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && c > ' ' && c != 0x7f && !isAlnum(rune(c))
+}
+
+// linkPath returns path, the slash-separated path of fileInfo or the one a
+// PathRewriter maps it to, as written in links: with the extension changed
+// according to opts, slugified and escaped.
+func linkPath(path string, fileInfo FileInfo, opts Options) string {
+	// The extension is left out of the transform, so that "v1.2.md" is not
+	// slugified as "v12md".
+	var ext string
+	if opts.StripExt {
+		path = strings.TrimSuffix(path, fileInfo.Ext)
+	} else if mapped, exists := opts.ExtMap[fileInfo.Ext]; exists {
+		path, ext = strings.TrimSuffix(path, fileInfo.Ext), mapped
+	} else if stem, found := strings.CutSuffix(path, fileInfo.Ext); found {
+		path, ext = stem, fileInfo.Ext
+	}
+	if opts.PathTransform != "" && opts.PathTransform != PathTransformNone {
+		path, ext = transformPath(path, opts.PathTransform), strings.ToLower(ext)
+	}
+	return escapePath(slugify(path + ext))
+}
+
+// mapPrefix returns the prefix of the file at path, slash separated and
+// relative to its base directory, and its path relative to the directory
+// of opts.PrefixMap it is in, or opts.Prefix and path if there is none.
+func mapPrefix(path string, opts Options) (string, string) {
+	prefix, mappedPath, longest := opts.Prefix, path, -1
+	for dir, dirPrefix := range opts.PrefixMap {
+		dir = strings.Trim(dir, "/")
+		if rest, found := strings.CutPrefix(path, dir+"/"); found && dir != "" && len(dir) > longest {
+			prefix, mappedPath, longest = dirPrefix, rest, len(dir)
+		}
+	}
+	return prefix, mappedPath
+}
+
+// withBaseURL returns prefix under opts.BaseURL, unless it is a URL itself.
+func withBaseURL(prefix string, opts Options) string {
+	if opts.BaseURL == "" || strings.Contains(prefix, "://") {
+		return prefix
+	}
+	return joinPrefix(opts.BaseURL, prefix)
+}
+
+// relativePath returns the slash-separated path of target relative to the
+// directory of source, both relative to the same base directory.
+func relativePath(source, target string) string {
+	dir := filepath.Dir(filepath.FromSlash(source))
+	relativePath, err := filepath.Rel(dir, filepath.FromSlash(target))
+	if err != nil {
+		// Both paths are relative, so this does not happen.
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(relativePath)
+}
+
+// unresolvedText returns what replaces a link to a file that is not found.
+func unresolvedText(match, base, alias string, opts Options) string {
+	switch opts.UnresolvedMode {
+	case UnresolvedModePlain:
+		if alias != "" {
+			return alias
+		}
+		return base
+	case UnresolvedModeRemove:
+		return ""
+	default:
+		return match
+	}
+}
+
+// resolve finds the file base refers to in the link format of opts.
+func resolve(idx Index, base string, opts Options) (FileInfo, error) {
+	switch opts.LinkFormat {
+	case LinkFormatRelative:
+		if opts.Source != "" {
+			dir := path.Dir(filepath.ToSlash(opts.Source))
+			if fileInfo, exists := idx.LookupPath(path.Join(dir, base)); exists {
+				return fileInfo, nil
+			}
+		}
+	case LinkFormatAbsolute:
+		if fileInfo, exists := idx.LookupPath(path.Clean(strings.TrimPrefix(base, "/"))); exists {
+			return fileInfo, nil
+		}
+	}
+	fileInfo, err := idx.Resolve(base)
+	if errors.Is(err, ErrAmbiguousLink) && opts.ResolveNearest && opts.Source != "" {
+		if nearest, found := nearestFile(idx.Candidates(base), opts.Source); found {
+			return nearest, nil
+		}
+	}
+	return fileInfo, err
+}
+
+// nearestFile returns the candidate with the shortest path from source, in
+// path components, or false if several are at that distance.
+func nearestFile(candidates []FileInfo, source string) (FileInfo, bool) {
+	var nearest FileInfo
+	best, ties := -1, 0
+	for _, candidate := range candidates {
+		distance := strings.Count(relativePath(source, candidate.Path), "/")
+		switch {
+		case best < 0 || distance < best:
+			nearest, best, ties = candidate, distance, 1
+		case distance == best:
+			ties++
+		}
+	}
+	return nearest, ties == 1
+}
+
+// isImage reports whether the embeds of files with extension ext are
+// rendered as images.
+func (opts Options) isImage(ext string) bool {
+	extensions := opts.ImageExtensions
+	if extensions == nil {
+		extensions = DefaultImageExtensions
+	}
+	for _, imageExt := range extensions {
+		if strings.EqualFold(ext, imageExt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts Options) maxEmbedDepth() int {
+	if opts.MaxEmbedDepth <= 0 {
+		return DefaultMaxEmbedDepth
+	}
+	return opts.MaxEmbedDepth
+}
+
+func (opts Options) anchorPrefix() string {
+	if opts.AnchorPrefix == "" {
+		return "#"
+	}
+	return opts.AnchorPrefix
+}
+
+func (opts Options) pattern() *regexp.Regexp {
+	if opts.Pattern == nil {
+		return LinkPattern
+	}
+	return opts.Pattern
+}
+
+func (opts Options) logger() *slog.Logger {
+	if opts.Logger == nil {
+		return slog.Default()
+	}
+	return opts.Logger
+}
+
+// linkFragment returns the fragment of a link to anchor and block, without
+// "#". The block reference follows the heading it is under.
+func linkFragment(anchor, block string, opts Options) string {
+	if block == "" {
+		return anchor
+	}
+	if opts.BlockMode == BlockModeSlug {
+		return block
+	}
+	return anchor + block
+}
+
+// blockFragment returns the fragment for a ^block reference, without "#".
+func blockFragment(block string, opts Options) string {
+	switch opts.BlockMode {
+	case BlockModeDrop:
+		return ""
+	case BlockModeSlug:
+		return url.PathEscape(block)
+	default:
+		return "^" + url.PathEscape(block)
+	}
+}
+
+// aliasEscaper backslash-escapes the characters that would end the text of
+// a Markdown link early, or a table cell when the link is inside a table.
+var aliasEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`, `|`, `\|`)
+
+// render executes the link template of opts for match.
+func render(match string, data TemplateData, opts Options) (string, error) {
+	data.Alias = aliasEscaper.Replace(data.Alias)
+	tmpl := opts.Template
+	if opts.References != nil {
+		data.Ref = opts.References.Add(data.Link)
+		if tmpl == nil {
+			tmpl = refTemplate
+		}
+	}
+	if tmpl == nil {
+		tmpl = defaultTemplate
+	}
+	var replacement strings.Builder
+	err := tmpl.Execute(&replacement, data)
+	if err != nil {
+		return "", &LinkError{Link: match, Err: fmt.Errorf("failed to execute template: %w", err)}
+	}
+	return replacement.String(), nil
+}
+
+// joinPrefix joins prefix and path with exactly one "/", whether or not the
+// prefix ends with one. path must be escaped. A prefix that is an absolute
+// URL, such as "https://example.com/wiki/", is joined with net/url, which
+// also escapes the characters of the prefix that need it.
+func joinPrefix(prefix, path string) string {
+	if prefix == "" {
+		return path
+	}
+	if base, err := url.Parse(prefix); err == nil && base.IsAbs() && base.Host != "" {
+		// The leading "/" keeps the trailing one when path is empty.
+		return base.JoinPath("/" + strings.TrimLeft(path, "/")).String()
+	}
+	return strings.TrimRight(prefix, "/") + "/" + strings.TrimLeft(path, "/")
+}
@@ -0,0 +1,1096 @@
+package linklore
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestLinkPattern(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+		base     string
+		alias    string
+		anchor   string
+		block    string
+	}{
+		{input: "[[Link]]", expected: true, base: "Link"},
+		{input: "![[Link]]", expected: true, base: "Link"},
+		{input: "![[Link#Anchor]]", expected: true, base: "Link", anchor: "Anchor"},
+		{input: "![[Link^Block]]", expected: true, base: "Link", block: "Block"},
+		{input: "[[Link#Anchor^Block]]", expected: true, base: "Link", anchor: "Anchor", block: "Block"},
+		{input: "[[Link#Anchor^Block|Alias]]", expected: true, base: "Link", alias: "Alias", anchor: "Anchor", block: "Block"},
+		{input: "[[Link|Alias]]", expected: true, base: "Link", alias: "Alias"},
+		{input: "[[Link|Alias^Block]]", expected: true, base: "Link", alias: "Alias", block: "Block"},
+		{input: "[[Link|Alias^Block^Extra]]", expected: false, base: "Link", alias: "Alias"},
+		{input: "[[Link|Alias^#Anchor]]", expected: false},
+		{input: "[[Link|Alias^#Anchor^Extra]]", expected: false},
+		{input: "[[Link|Alias^Extra#Anchor]]", expected: false},
+		{input: "[[Link|Alias^Extra#Anchor^Extra]]", expected: false},
+		{input: "[[Link#Anchor|Alias]]", expected: true, base: "Link", alias: "Alias", anchor: "Anchor"},
+		{input: "[[Link|Display | Subtitle]]", expected: true, base: "Link", alias: "Display | Subtitle"},
+		{input: "[[Link|A|B|C]]", expected: true, base: "Link", alias: "A|B|C"},
+		{input: "[[Link#Anchor|Display | Subtitle]]", expected: true, base: "Link", alias: "Display | Subtitle", anchor: "Anchor"},
+		{input: "[[Link#Anchor^Block|A | B]]", expected: true, base: "Link", alias: "A | B", anchor: "Anchor", block: "Block"},
+		{input: "[[Link|A | B^Block]]", expected: true, base: "Link", alias: "A | B", block: "Block"},
+		{input: "[[Link|A | B]] and [[Other]]", expected: true, base: "Link", alias: "A | B"},
+		{input: "[[#Anchor]]", expected: true, anchor: "Anchor"},
+		{input: "[[#Anchor|Alias]]", expected: true, alias: "Alias", anchor: "Anchor"},
+		{input: "[Link]", expected: false},
+		{input: "[[Link", expected: false},
+		{input: "Link]]", expected: false},
+	}
+
+	for _, test := range tests {
+		matched := LinkPattern.MatchString(test.input)
+		if matched != test.expected {
+			t.Errorf("Input: %s, Expected: %v, Got: %v", test.input, test.expected, matched)
+		}
+		match := LinkPattern.FindString(test.input)
+
+		if !matched {
+			continue
+		}
+
+		submatches := LinkPattern.FindStringSubmatch(match)
+
+		base := submatches[1]
+		alias := submatches[2]
+		anchor := submatches[3]
+		block := submatches[4]
+		if alias == "" {
+			alias = submatches[5]
+		}
+
+		if base != test.base {
+			t.Errorf("Input: %s, Expected base: %s, Got: %s", test.input, test.base, base)
+		}
+
+		if alias != test.alias {
+			t.Errorf("Input: %s, Expected alias: %s, Got: %s", test.input, test.alias, alias)
+		}
+
+		if anchor != test.anchor {
+			t.Errorf("Input: %s, Expected anchor: %s, Got: %s", test.input, test.anchor, anchor)
+		}
+
+		if block != test.block {
+			t.Errorf("Input: %s, Expected block: %s, Got: %s", test.input, test.block, block)
+		}
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "file1.txt",
+		Basename: "file1",
+		Ext:      ".txt",
+		Path:     "file1.txt",
+	})
+
+	output, errs := Rewrite("[[file1]] [[missing]] [[file1|One]]", idx, Options{Prefix: "/"})
+
+	expectedOutput := "[file1](/file1.txt) [[missing]] [One](/file1.txt)"
+	if output != expectedOutput {
+		t.Errorf("Rewrite failed: incorrect output, got %s, want %s", output, expectedOutput)
+	}
+
+	if len(errs) != 1 {
+		t.Fatalf("Rewrite failed: expected 1 error, got %v", errs)
+	}
+	var linkErr *LinkError
+	if !errors.As(errs[0], &linkErr) || linkErr.Link != "[[missing]]" {
+		t.Errorf("Rewrite failed: expected *LinkError for [[missing]], got %v", errs[0])
+	}
+	if !errors.Is(errs[0], ErrLinkNotFound) {
+		t.Errorf("Rewrite failed: expected ErrLinkNotFound, got %v", errs[0])
+	}
+}
+
+func TestReplaceLinkEscape(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{
+			Name:     "My Note.md",
+			Basename: "My Note",
+			Ext:      ".md",
+			Path:     "My Note.md",
+		},
+		FileInfo{
+			Name:     "C# Notes.md",
+			Basename: "csharp",
+			Ext:      ".md",
+			Path:     "lang/C# Notes.md",
+		},
+		FileInfo{
+			Name:     "中文笔记.md",
+			Basename: "中文笔记",
+			Ext:      ".md",
+			Path:     "笔记/中文笔记.md",
+		},
+	)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "[[My Note]]", expected: "[My Note](/My-Note)"},
+		{input: "[[My Note#Some Heading]]", expected: "[My Note](/My-Note#Some-Heading)"},
+		{input: "[[csharp]]", expected: "[csharp](/lang/C%23-Notes)"},
+		{input: "[[中文笔记]]", expected: "[中文笔记](/%E7%AC%94%E8%AE%B0/%E4%B8%AD%E6%96%87%E7%AC%94%E8%AE%B0)"},
+		{input: "[[中文笔记#小节]]", expected: "[中文笔记](/%E7%AC%94%E8%AE%B0/%E4%B8%AD%E6%96%87%E7%AC%94%E8%AE%B0#%E5%B0%8F%E8%8A%82)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/"})
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkStripExt(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "file1.txt",
+		Basename: "file1",
+		Ext:      ".txt",
+		Path:     "sub/file1.txt",
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "[[file1]]", expected: "[file1](/sub/file1)"},
+		{input: "[[file1|Alias]]", expected: "[Alias](/sub/file1)"},
+		{input: "[[file1#Anchor]]", expected: "[file1](/sub/file1#Anchor)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", StripExt: true})
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkExtMap(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "sub/note.md"},
+		FileInfo{Name: "post.markdown", Basename: "post", Ext: ".markdown", Path: "post.markdown"},
+		FileInfo{Name: "image.png", Basename: "image", Ext: ".png", Path: "image.png"},
+	)
+	extMap := map[string]string{".md": ".html", ".markdown": ".html"}
+
+	tests := []struct {
+		opts     Options
+		input    string
+		expected string
+	}{
+		{opts: Options{Prefix: "/", ExtMap: extMap}, input: "[[note]]", expected: "[note](/sub/note.html)"},
+		{opts: Options{Prefix: "/", ExtMap: extMap}, input: "[[note#Heading|Alias]]", expected: "[Alias](/sub/note.html#Heading)"},
+		{opts: Options{Prefix: "/", ExtMap: extMap}, input: "[[post]]", expected: "[post](/post.html)"},
+		{opts: Options{Prefix: "/", ExtMap: extMap}, input: "![[image]]", expected: "![image](/image.png)"},
+		{opts: Options{Prefix: "/", ExtMap: extMap, StripExt: true}, input: "[[note]]", expected: "[note](/sub/note)"},
+		{opts: Options{Prefix: "/"}, input: "[[post]]", expected: "[post](/post.markdown)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, test.opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkAnchorPrefix(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+
+	tests := []struct {
+		input    string
+		opts     Options
+		expected string
+	}{
+		{input: "[[note#My Heading]]", opts: Options{}, expected: "[note](/note#My-Heading)"},
+		{input: "[[note#My Heading]]", opts: Options{AnchorPrefix: "?id="}, expected: "[note](/note?id=My-Heading)"},
+		{input: "[[note#My Heading]]", opts: Options{AnchorPrefix: "?id=", SlugifyAnchors: true}, expected: "[note](/note?id=my-heading)"},
+		{input: "[[note^abc123]]", opts: Options{AnchorPrefix: "?id="}, expected: "[note](/note?id=^abc123)"},
+		{input: "[[#My Heading]]", opts: Options{AnchorPrefix: "?id="}, expected: "[My Heading](?id=My-Heading)"},
+		{input: "[[note]]", opts: Options{AnchorPrefix: "?id="}, expected: "[note](/note)"},
+	}
+	for _, test := range tests {
+		test.opts.Prefix = "/"
+		test.opts.StripExt = true
+		output, err := ReplaceLink(test.input, idx, test.opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkSlugifyAnchors(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "note.md",
+		Basename: "note",
+		Ext:      ".md",
+		Path:     "note.md",
+	})
+
+	tests := []struct {
+		anchorStyle string
+		input       string
+		expected    string
+	}{
+		{anchorStyle: AnchorStyleGitHub, input: "[[note#My Heading!]]", expected: "[note](/note#my-heading)"},
+		{anchorStyle: AnchorStyleGitHub, input: "[[note#Übersicht]]", expected: "[note](/note#%C3%BCbersicht)"},
+		{anchorStyle: AnchorStyleObsidian, input: "[[note#My Heading!]]", expected: "[note](/note#My-Heading%21)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", SlugifyAnchors: true, AnchorStyle: test.anchorStyle})
+		if err != nil {
+			t.Errorf("Style: %s, Input: %s, unexpected error: %v", test.anchorStyle, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Style: %s, Input: %s, Expected: %s, Got: %s", test.anchorStyle, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkAnchorPunctuation(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+
+	tests := []struct {
+		opts     Options
+		input    string
+		expected string
+	}{
+		{opts: Options{}, input: "[[note#Section 1.2: Intro]]", expected: "[note](/note#Section-1.2:-Intro)"},
+		{opts: Options{}, input: "[[note#Q&A   (draft) 50%]]", expected: "[note](/note#Q&A-%28draft%29-50%25)"},
+		{opts: Options{}, input: "[[#Step 3. Deploy?]]", expected: "[Step 3. Deploy?](#Step-3.-Deploy%3F)"},
+		{opts: Options{SlugifyAnchors: true}, input: "[[note#Section 1.2: Intro]]", expected: "[note](/note#section-12-intro)"},
+		{opts: Options{SlugifyAnchors: true}, input: "[[note#Q&A   (draft) 50%]]", expected: "[note](/note#qa---draft-50)"},
+	}
+
+	for _, test := range tests {
+		test.opts.Prefix = "/"
+		output, err := ReplaceLink(test.input, idx, test.opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkFormat(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"},
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "sub/note.md"},
+		FileInfo{Name: "other.md", Basename: "other", Ext: ".md", Path: "sub/deep/other.md"},
+	)
+
+	tests := []struct {
+		linkFormat string
+		input      string
+		expected   string
+		err        error
+	}{
+		{linkFormat: LinkFormatShortest, input: "[[note]]", err: ErrAmbiguousLink},
+		{linkFormat: LinkFormatShortest, input: "[[sub/note]]", expected: "[sub/note](/sub/note)"},
+		{linkFormat: LinkFormatShortest, input: "[[other]]", expected: "[other](/sub/deep/other)"},
+		{linkFormat: LinkFormatShortest, input: "[[/sub/note]]", expected: "[/sub/note](/sub/note)"},
+		{linkFormat: LinkFormatShortest, input: "[[/note|Top]]", expected: "[Top](/note)"},
+		{linkFormat: LinkFormatAbsolute, input: "[[note]]", expected: "[note](/note)"},
+		{linkFormat: LinkFormatAbsolute, input: "[[/sub/note.md]]", expected: "[/sub/note.md](/sub/note)"},
+		{linkFormat: LinkFormatAbsolute, input: "[[other]]", expected: "[other](/sub/deep/other)"},
+		{linkFormat: LinkFormatRelative, input: "[[note]]", expected: "[note](/sub/note)"},
+		{linkFormat: LinkFormatRelative, input: "[[../note]]", expected: "[../note](/note)"},
+		{linkFormat: LinkFormatRelative, input: "[[deep/other]]", expected: "[deep/other](/sub/deep/other)"},
+		{linkFormat: LinkFormatRelative, input: "[[sub/note]]", expected: "[sub/note](/sub/note)"},
+	}
+
+	for _, test := range tests {
+		opts := Options{Prefix: "/", LinkFormat: test.linkFormat, Source: "sub/input.md"}
+		output, err := ReplaceLink(test.input, idx, opts)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Format: %s, Input: %s, expected error %v, got %v", test.linkFormat, test.input, test.err, err)
+		}
+		if output != test.expected {
+			t.Errorf("Format: %s, Input: %s, Expected: %s, Got: %s", test.linkFormat, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkRelativeLinks(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "top.md", Basename: "top", Ext: ".md", Path: "top.md"},
+		FileInfo{Name: "sibling.md", Basename: "sibling", Ext: ".md", Path: "sub/sibling.md"},
+		FileInfo{Name: "child.png", Basename: "child", Ext: ".png", Path: "sub/deep/child.png"},
+		FileInfo{Name: "other note.md", Basename: "other note", Ext: ".md", Path: "other/other note.md"},
+	)
+
+	tests := []struct {
+		source   string
+		input    string
+		expected string
+	}{
+		{source: "sub/input.md", input: "[[sibling#Heading]]", expected: "[sibling](sibling#Heading)"},
+		{source: "sub/input.md", input: "[[top]]", expected: "[top](../top)"},
+		{source: "sub/input.md", input: "![[child.png]]", expected: "![child.png](deep/child.png)"},
+		{source: "sub/input.md", input: "[[other note]]", expected: "[other note](../other/other-note)"},
+		{source: "input.md", input: "[[sibling]]", expected: "[sibling](sub/sibling)"},
+		{source: "", input: "[[top]]", expected: "[top](top)"},
+	}
+	for _, test := range tests {
+		opts := Options{Prefix: "/docs", RelativeLinks: true, Source: test.source}
+		output, err := ReplaceLink(test.input, idx, opts)
+		if err != nil {
+			t.Errorf("Source: %s, Input: %s, unexpected error: %v", test.source, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Source: %s, Input: %s, Expected: %s, Got: %s", test.source, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestRewriteUnresolvedMode(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "file1.txt", Basename: "file1", Ext: ".txt", Path: "file1.txt"})
+	input := "[[file1]] [[missing]] [[gone|Gone]] ![[image.png]]"
+
+	tests := []struct {
+		unresolvedMode string
+		expected       string
+	}{
+		{unresolvedMode: "", expected: "[file1](/file1.txt) [[missing]] [[gone|Gone]] ![[image.png]]"},
+		{unresolvedMode: UnresolvedModeKeep, expected: "[file1](/file1.txt) [[missing]] [[gone|Gone]] ![[image.png]]"},
+		{unresolvedMode: UnresolvedModePlain, expected: "[file1](/file1.txt) missing Gone image.png"},
+		{unresolvedMode: UnresolvedModeRemove, expected: "[file1](/file1.txt)   "},
+	}
+
+	for _, test := range tests {
+		output, errs := Rewrite(input, idx, Options{Prefix: "/", UnresolvedMode: test.unresolvedMode})
+		if output != test.expected {
+			t.Errorf("Mode: %q, Expected: %q, Got: %q", test.unresolvedMode, test.expected, output)
+		}
+		if len(errs) != 3 {
+			t.Errorf("Mode: %q, expected 3 errors, got %v", test.unresolvedMode, errs)
+		}
+	}
+}
+
+func TestRewriteValidateAnchors(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md", Headings: []string{"title", "my-heading"}},
+		FileInfo{Name: "file1.txt", Basename: "file1", Ext: ".txt", Path: "file1.txt"},
+	)
+
+	output, errs := Rewrite("[[note#My Heading]] [[note#Missing]] [[file1#Any]]", idx, Options{Prefix: "/", ValidateAnchors: true})
+
+	expectedOutput := "[note](/note#My-Heading) [note](/note#Missing) [file1](/file1.txt#Any)"
+	if output != expectedOutput {
+		t.Errorf("Rewrite failed: incorrect output, got %s, want %s", output, expectedOutput)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrAnchorNotFound) {
+		t.Fatalf("Rewrite failed: expected ErrAnchorNotFound for [[note#Missing]], got %v", errs)
+	}
+
+	_, errs = Rewrite("[[note#Missing]]", idx, Options{Prefix: "/"})
+	if len(errs) != 0 {
+		t.Errorf("Rewrite failed: anchors validated without ValidateAnchors: %v", errs)
+	}
+}
+
+func TestReplaceLinkBlock(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "note.md",
+		Basename: "note",
+		Ext:      ".md",
+		Path:     "note.md",
+	})
+
+	tests := []struct {
+		blockMode string
+		input     string
+		expected  string
+	}{
+		{blockMode: "", input: "[[note^abc123]]", expected: "[note](/note#^abc123)"},
+		{blockMode: BlockModeKeep, input: "[[note|Alias^abc123]]", expected: "[Alias](/note#^abc123)"},
+		{blockMode: BlockModeKeep, input: "[[note#Heading]]", expected: "[note](/note#Heading)"},
+		{blockMode: BlockModeKeep, input: "[[note#Heading^abc123]]", expected: "[note](/note#Heading^abc123)"},
+		{blockMode: BlockModeKeep, input: "[[note#Heading^abc123|Alias]]", expected: "[Alias](/note#Heading^abc123)"},
+		{blockMode: BlockModeSlug, input: "[[note^abc123]]", expected: "[note](/note#abc123)"},
+		{blockMode: BlockModeSlug, input: "[[note#Heading^abc123]]", expected: "[note](/note#abc123)"},
+		{blockMode: BlockModeDrop, input: "[[note^abc123]]", expected: "[note](/note)"},
+		{blockMode: BlockModeDrop, input: "[[note#Heading^abc123]]", expected: "[note](/note#Heading)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", BlockMode: test.blockMode})
+		if err != nil {
+			t.Errorf("Mode: %s, Input: %s, unexpected error: %v", test.blockMode, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Mode: %s, Input: %s, Expected: %s, Got: %s", test.blockMode, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkLogger(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "note.md",
+		Basename: "note",
+		Ext:      ".md",
+		Path:     "note.md",
+	})
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	Rewrite("[[note]] [[missing.md]]", idx, Options{Prefix: "/", Logger: logger})
+
+	for _, expected := range []string{
+		`msg="link resolved" link=[[note]] path=note.md`,
+		`msg="link unresolved" link=[[missing.md]] keys="[missing.md missing]"`,
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("ReplaceLink failed: expected log %q, got %q", expected, logs.String())
+		}
+	}
+}
+
+func TestReplaceLinkSameFile(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "note.md",
+		Basename: "note",
+		Ext:      ".md",
+		Path:     "note.md",
+	})
+
+	tests := []struct {
+		slugifyAnchors bool
+		input          string
+		expected       string
+	}{
+		{input: "[[#Heading]]", expected: "[Heading](#Heading)"},
+		{input: "[[#Some Heading|Alias]]", expected: "[Alias](#Some-Heading)"},
+		{slugifyAnchors: true, input: "[[#Some Heading]]", expected: "[Some Heading](#some-heading)"},
+		{slugifyAnchors: true, input: "[[#Some Heading|Alias]]", expected: "[Alias](#some-heading)"},
+		{input: "[[note#Heading|Alias]]", expected: "[Alias](/note#Heading)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", SlugifyAnchors: test.slugifyAnchors})
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+
+	if _, err := ReplaceLink("[[|Alias]]", idx, Options{Prefix: "/"}); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("ReplaceLink failed: expected ErrLinkNotFound for a link without base or anchor, got %v", err)
+	}
+}
+
+func TestReplaceLinkSelfLinkMode(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "sub/note.md"},
+		FileInfo{Name: "other.md", Basename: "other", Ext: ".md", Path: "other.md"},
+	)
+
+	tests := []struct {
+		selfLinkMode string
+		input        string
+		expected     string
+		err          error
+	}{
+		{selfLinkMode: "", input: "[[note]]", expected: "[note](/sub/note)"},
+		{selfLinkMode: SelfLinkModeKeep, input: "[[note#Heading]]", expected: "[note](/sub/note#Heading)"},
+		{selfLinkMode: SelfLinkModeAnchor, input: "[[note]]", expected: "[note](#)"},
+		{selfLinkMode: SelfLinkModeAnchor, input: "[[note#Some Heading|Alias]]", expected: "[Alias](#Some-Heading)"},
+		{selfLinkMode: SelfLinkModeAnchor, input: "[[other]]", expected: "[other](/other)"},
+		{selfLinkMode: SelfLinkModeAnchor, input: "![[note]]", expected: "[note](/sub/note)"},
+		{selfLinkMode: SelfLinkModeWarn, input: "[[note]]", expected: "[note](/sub/note)", err: ErrSelfLink},
+		{selfLinkMode: SelfLinkModeWarn, input: "[[other]]", expected: "[other](/other)"},
+	}
+	for _, test := range tests {
+		opts := Options{Prefix: "/", Source: filepath.FromSlash("sub/note.md"), SelfLinkMode: test.selfLinkMode}
+		output, err := ReplaceLink(test.input, idx, opts)
+		if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+			t.Errorf("Mode: %s, Input: %s, expected error %v, got %v", test.selfLinkMode, test.input, test.err, err)
+		}
+		if output != test.expected {
+			t.Errorf("Mode: %s, Input: %s, Expected: %s, Got: %s", test.selfLinkMode, test.input, test.expected, output)
+		}
+	}
+
+	output, errs := Rewrite("[[note]] [[other]]", idx, Options{Prefix: "/", Source: "sub/note.md", SelfLinkMode: SelfLinkModeWarn})
+	if output != "[note](/sub/note) [other](/other)" || len(errs) != 1 || !IsWarning(errs[0]) {
+		t.Errorf("Rewrite failed: got %s with errors %v", output, errs)
+	}
+}
+
+func TestReplaceLinkPathTransform(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "My Note.md", Basename: "My Note", Ext: ".md", Path: "Projects/My Note.md"},
+		FileInfo{Name: "Release v1.2 (draft).md", Basename: "Release v1.2 (draft)", Ext: ".md", Path: "Release v1.2 (draft).md"},
+		FileInfo{Name: "Diagram.PNG", Basename: "Diagram", Ext: ".PNG", Path: "Assets/Diagram.PNG"},
+	)
+
+	tests := []struct {
+		transform string
+		opts      Options
+		input     string
+		expected  string
+	}{
+		{transform: "", input: "[[My Note]]", expected: "[My Note](/Projects/My-Note)"},
+		{transform: PathTransformNone, input: "[[My Note]]", expected: "[My Note](/Projects/My-Note)"},
+		{transform: PathTransformLower, input: "[[My Note#Heading]]", expected: "[My Note](/projects/my-note#Heading)"},
+		{transform: PathTransformLower, input: "![[Diagram.PNG]]", expected: "![Diagram.PNG](/assets/diagram.png)"},
+		{transform: PathTransformSlug, input: "[[My Note]]", expected: "[My Note](/projects/my-note)"},
+		{transform: PathTransformSlug, input: "[[Release v1.2 (draft)]]", expected: "[Release v1.2 (draft)](/release-v12-draft)"},
+		{transform: PathTransformSlug, opts: Options{ExtMap: map[string]string{".md": ".html"}}, input: "[[My Note]]", expected: "[My Note](/projects/my-note.html)"},
+		{transform: PathTransformSlug, opts: Options{RelativeLinks: true, Source: "Other/Index.md"}, input: "[[My Note]]", expected: "[My Note](../projects/my-note)"},
+	}
+	for _, test := range tests {
+		opts := test.opts
+		opts.Prefix = "/"
+		opts.PathTransform = test.transform
+		output, err := ReplaceLink(test.input, idx, opts)
+		if err != nil {
+			t.Errorf("Transform: %s, Input: %s, unexpected error: %v", test.transform, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Transform: %s, Input: %s, Expected: %s, Got: %s", test.transform, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkEscapedBrackets(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "Note [v2].md", Basename: "Note [v2]", Ext: ".md", Path: "Note [v2].md"},
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"},
+	)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: `[[Note \[v2\]]]`, expected: `[Note \[v2\]](/Note-%5Bv2%5D)`},
+		{input: `[[Note \[v2\]#Heading|Version 2]]`, expected: `[Version 2](/Note-%5Bv2%5D#Heading)`},
+		{input: `[[note|Alias \[draft\]]]`, expected: `[Alias \[draft\]](/note)`},
+		{input: `[[note#Heading|\[1\]]]`, expected: `[\[1\]](/note#Heading)`},
+	}
+	for _, test := range tests {
+		output, errs := Rewrite("See "+test.input+".", idx, Options{Prefix: "/"})
+		if len(errs) > 0 {
+			t.Errorf("Input: %s, unexpected errors: %v", test.input, errs)
+		}
+		if expected := "See " + test.expected + "."; output != expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, expected, output)
+		}
+	}
+
+	pattern, err := CompilePattern(Syntax{Open: "{{", Close: "}}"})
+	if err != nil {
+		t.Fatalf("CompilePattern failed: %v", err)
+	}
+	idx = newTestIndex(FileInfo{Name: "a{b}.md", Basename: "a{b}", Ext: ".md", Path: "a{b}.md"})
+	output, _ := Rewrite(`{{a\{b\}|x\}}}`, idx, Options{Prefix: "/", Pattern: pattern})
+	if expected := "[x}](/a%7Bb%7D)"; output != expected {
+		t.Errorf("Rewrite failed with custom syntax: got %s, want %s", output, expected)
+	}
+}
+
+func TestReplaceLinkMaxComponentLength(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+	opts := Options{Prefix: "/", MaxComponentLength: DefaultMaxComponentLength}
+
+	long := "[[" + strings.Repeat("a", 1<<20) + "]]"
+	content := "See [[note]] and " + long + "."
+	output, errs := Rewrite(content, idx, opts)
+	if expected := "See [note](/note) and " + long + "."; output != expected {
+		t.Errorf("Rewrite failed: long link should be left unchanged")
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrLinkTooLong) {
+		t.Fatalf("Rewrite failed: expected one ErrLinkTooLong, got %d errors", len(errs))
+	}
+	var linkErr *LinkError
+	if !errors.As(errs[0], &linkErr) || len(linkErr.Link) > 100 {
+		t.Errorf("Rewrite failed: link of the error should be shortened")
+	}
+
+	tests := []struct {
+		input   string
+		tooLong bool
+	}{
+		{input: "[[note|" + strings.Repeat("x", DefaultMaxComponentLength) + "]]"},
+		{input: "[[note|" + strings.Repeat("x", DefaultMaxComponentLength+1) + "]]", tooLong: true},
+		{input: "[[note#" + strings.Repeat("x", DefaultMaxComponentLength+1) + "]]", tooLong: true},
+		{input: "[[note^" + strings.Repeat("x", DefaultMaxComponentLength+1) + "]]", tooLong: true},
+	}
+	for _, test := range tests {
+		_, err := ReplaceLink(test.input, idx, opts)
+		if errors.Is(err, ErrLinkTooLong) != test.tooLong {
+			t.Errorf("ReplaceLink failed for a link of %d bytes: got error %v", len(test.input), err)
+		}
+	}
+
+	if _, err := ReplaceLink(long, idx, Options{Prefix: "/"}); errors.Is(err, ErrLinkTooLong) {
+		t.Errorf("ReplaceLink failed: the length should not be limited by default")
+	}
+}
+
+func TestReplaceLinkResolveNearest(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "a/note.md"},
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "b/note.md"},
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "c/sub/note.md"},
+	)
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{source: "a/x.md", expected: "[note](/a/note)"},
+		{source: "b/x.md", expected: "[note](/b/note)"},
+		{source: "c/x.md", expected: "[note](/c/sub/note)"},
+		{source: "c/sub/deep/x.md", expected: "[note](/c/sub/note)"},
+		// a/note.md and b/note.md are both one directory away.
+		{source: "x.md"},
+		{source: "d/x.md"},
+	}
+	for _, test := range tests {
+		output, err := ReplaceLink("[[note]]", idx, Options{Prefix: "/", StripExt: true, Source: test.source, ResolveNearest: true})
+		if test.expected == "" {
+			if !errors.Is(err, ErrAmbiguousLink) {
+				t.Errorf("Source: %s, expected ErrAmbiguousLink, got %v", test.source, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Source: %s, unexpected error: %v", test.source, err)
+		}
+		if output != test.expected {
+			t.Errorf("Source: %s, Expected: %s, Got: %s", test.source, test.expected, output)
+		}
+	}
+
+	if _, err := ReplaceLink("[[note]]", idx, Options{Prefix: "/", Source: "a/x.md"}); !errors.Is(err, ErrAmbiguousLink) {
+		t.Errorf("ReplaceLink failed: expected ErrAmbiguousLink without ResolveNearest, got %v", err)
+	}
+}
+
+func TestReplaceLinkPrefixMap(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "hello.md", Basename: "hello", Ext: ".md", Path: "blog/hello.md"},
+		FileInfo{Name: "old.md", Basename: "old", Ext: ".md", Path: "blog/archive/old.md"},
+		FileInfo{Name: "setup.md", Basename: "setup", Ext: ".md", Path: "docs/setup.md"},
+		FileInfo{Name: "about.md", Basename: "about", Ext: ".md", Path: "about.md"},
+		FileInfo{Name: "blogroll.md", Basename: "blogroll", Ext: ".md", Path: "blogroll/blogroll.md"},
+	)
+	opts := Options{
+		Prefix:   "/",
+		StripExt: true,
+		PrefixMap: map[string]string{
+			"blog":         "/posts/",
+			"blog/archive": "https://old.example.com/",
+			"/docs/":       "/guide/",
+		},
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "[[hello#Intro]]", expected: "[hello](/posts/hello#Intro)"},
+		{input: "[[old]]", expected: "[old](https://old.example.com/old)"},
+		{input: "[[setup]]", expected: "[setup](/guide/setup)"},
+		{input: "[[about]]", expected: "[about](/about)"},
+		{input: "[[blogroll]]", expected: "[blogroll](/blogroll/blogroll)"},
+	}
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkBaseURL(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"},
+		FileInfo{Name: "old.md", Basename: "old", Ext: ".md", Path: "archive/old.md"},
+	)
+
+	tests := []struct {
+		opts     Options
+		input    string
+		expected string
+	}{
+		{opts: Options{BaseURL: "https://site.com", Prefix: "/wiki/"}, input: "[[note]]", expected: "[note](https://site.com/wiki/note)"},
+		{opts: Options{BaseURL: "https://site.com/", Prefix: "wiki"}, input: "[[note#Intro]]", expected: "[note](https://site.com/wiki/note#Intro)"},
+		{opts: Options{BaseURL: "https://site.com/docs/", Prefix: "/"}, input: "[[note]]", expected: "[note](https://site.com/docs/note)"},
+		{opts: Options{BaseURL: "https://site.com"}, input: "[[note]]", expected: "[note](https://site.com/note)"},
+		{opts: Options{Prefix: "https://site.com/wiki/"}, input: "[[note]]", expected: "[note](https://site.com/wiki/note)"},
+		{opts: Options{BaseURL: "https://site.com", Prefix: "/wiki/", PrefixMap: map[string]string{"archive": "https://old.site.com/"}}, input: "[[old]]", expected: "[old](https://old.site.com/old)"},
+		{opts: Options{BaseURL: "https://site.com", Prefix: "/wiki/", RelativeLinks: true, Source: "index.md"}, input: "[[note]]", expected: "[note](note)"},
+	}
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, test.opts)
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Base URL: %s, Prefix: %s, Input: %s, Expected: %s, Got: %s", test.opts.BaseURL, test.opts.Prefix, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkSlashes(t *testing.T) {
+	// FileInfo.Path is built with the native separator, which is a backslash on
+	// Windows, to make sure links always use "/".
+	idx := newTestIndex(FileInfo{
+		Name:     "note.md",
+		Basename: "note",
+		Ext:      ".md",
+		Path:     filepath.Join("sub", "deep", "note.md"),
+	})
+
+	output, err := ReplaceLink("[[note]]", idx, Options{Prefix: "/"})
+	if err != nil {
+		t.Fatalf("ReplaceLink failed: %v", err)
+	}
+	if expected := "[note](/sub/deep/note)"; output != expected {
+		t.Errorf("ReplaceLink failed: Expected: %s, Got: %s", expected, output)
+	}
+}
+
+func TestReplaceLinkTemplate(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{
+			Name:     "My Note.md",
+			Basename: "My Note",
+			Ext:      ".md",
+			Path:     "sub/My Note.md",
+		},
+		FileInfo{
+			Name:     "image.png",
+			Basename: "image",
+			Ext:      ".png",
+			Path:     "image.png",
+		},
+	)
+
+	tests := []struct {
+		template string
+		input    string
+		expected string
+	}{
+		{template: DefaultTemplate, input: "[[My Note|Alias]]", expected: "[Alias](/docs/sub/My-Note)"},
+		{template: DefaultTemplate, input: "![[image]]", expected: "![image](/docs/image.png)"},
+		{template: `<a href="{{.Link}}">{{.Alias}}</a>`, input: "[[My Note#Heading]]", expected: `<a href="/docs/sub/My-Note#Heading">My Note</a>`},
+		{template: `{{.Prefix}}|{{.Path}}|{{.Anchor}}|{{.Ext}}`, input: "[[My Note#Heading]]", expected: "/docs|sub/My-Note|Heading|.md"},
+		{template: `{{if .Image}}<img src="{{.Link}}">{{else}}{{.Alias}}{{end}}`, input: "![[image]]", expected: `<img src="/docs/image.png">`},
+		{template: `<a href="{{.Link}}"{{with .Title}} title="{{html .}}"{{end}}>{{.Alias}}</a>`, input: "[[My Note|Shown]]", expected: `<a href="/docs/sub/My-Note" title="My Note">Shown</a>`},
+		{template: `<a href="{{.Link}}"{{with .Title}} title="{{html .}}"{{end}}>{{.Alias}}</a>`, input: "[[My Note|My Note]]", expected: `<a href="/docs/sub/My-Note">My Note</a>`},
+		{template: `<a href="{{.Link}}"{{with .Title}} title="{{html .}}"{{end}}>{{.Alias}}</a>`, input: "[[My Note]]", expected: `<a href="/docs/sub/My-Note">My Note</a>`},
+		{template: TitleTemplate, input: "[[My Note|Shown]]", expected: `[Shown](/docs/sub/My-Note "My Note")`},
+		{template: TitleTemplate, input: "[[My Note#Heading]]", expected: "[My Note](/docs/sub/My-Note#Heading)"},
+		{template: TitleTemplate, input: "![[image|A \"quoted\" caption]]", expected: `![A "quoted" caption](/docs/image.png "image")`},
+	}
+
+	for _, test := range tests {
+		tmpl := template.Must(template.New("link").Parse(test.template))
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/docs", Template: tmpl})
+		if err != nil {
+			t.Errorf("Template: %s, Input: %s, unexpected error: %v", test.template, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Template: %s, Input: %s, Expected: %s, Got: %s", test.template, test.input, test.expected, output)
+		}
+	}
+
+	tmpl := template.Must(template.New("link").Parse(`{{.Missing}}`))
+	_, err := ReplaceLink("[[image]]", idx, Options{Template: tmpl})
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) {
+		t.Errorf("ReplaceLink failed: expected *LinkError for a failing template, got %v", err)
+	}
+}
+
+func TestReplaceLinkEmbed(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "# Note\n\nBody\n")
+	createTestFile(tempDir, "meta.md", "---\ntitle: Meta\ntags: [a]\n---\n# Meta\n\nBody\n")
+	createTestFile(tempDir, "image.png", "")
+	createTestFile(tempDir, "doc.pdf", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		embedMode string
+		input     string
+		expected  string
+	}{
+		{embedMode: EmbedModeLink, input: "![[image.png]]", expected: "![image.png](/image.png)"},
+		{embedMode: EmbedModeLink, input: "![[image.png|Diagram]]", expected: "![Diagram](/image.png)"},
+		{embedMode: EmbedModeLink, input: "[[image.png]]", expected: "[image.png](/image.png)"},
+		{embedMode: EmbedModeLink, input: "![[note]]", expected: "[note](/note)"},
+		{embedMode: EmbedModeImage, input: "![[doc.pdf]]", expected: "![doc.pdf](/doc.pdf)"},
+		{embedMode: EmbedModeImage, input: "[[doc.pdf]]", expected: "[doc.pdf](/doc.pdf)"},
+		{embedMode: EmbedModeInline, input: "![[note]]", expected: "# Note\n\nBody"},
+		{embedMode: EmbedModeInline, input: "![[meta]]", expected: "# Meta\n\nBody"},
+		{embedMode: EmbedModeInline, input: "[[note]]", expected: "[note](/note)"},
+		{embedMode: EmbedModeInline, input: "![[image.png]]", expected: "![image.png](/image.png)"},
+		{embedMode: EmbedModeInline, input: "![[doc.pdf]]", expected: "[doc.pdf](/doc.pdf)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", EmbedMode: test.embedMode})
+		if err != nil {
+			t.Errorf("Mode: %s, Input: %s, unexpected error: %v", test.embedMode, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Mode: %s, Input: %s, Expected: %q, Got: %q", test.embedMode, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkImageExtensions(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	os.Mkdir(filepath.Join(tempDir, "assets"), 0755)
+	createTestFile(tempDir, "assets/image.png", "")
+	createTestFile(tempDir, "assets/photo.JPG", "")
+	createTestFile(tempDir, "assets/doc.pdf", "")
+
+	idx, err := BuildIndex(tempDir, nil)
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		extensions []string
+		input      string
+		expected   string
+	}{
+		{input: "![[image.png]]", expected: "![image.png](/assets/image.png)"},
+		{input: "![[photo.JPG|A photo]]", expected: "![A photo](/assets/photo.JPG)"},
+		{input: "![[doc.pdf]]", expected: "[doc.pdf](/assets/doc.pdf)"},
+		{input: "[[image.png]]", expected: "[image.png](/assets/image.png)"},
+		{extensions: []string{".pdf", ".jpg"}, input: "![[doc.pdf]]", expected: "![doc.pdf](/assets/doc.pdf)"},
+		{extensions: []string{".pdf", ".jpg"}, input: "![[photo.JPG]]", expected: "![photo.JPG](/assets/photo.JPG)"},
+		{extensions: []string{".pdf", ".jpg"}, input: "![[image.png]]", expected: "[image.png](/assets/image.png)"},
+	}
+
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/", ImageExtensions: test.extensions})
+		if err != nil {
+			t.Errorf("Extensions: %v, Input: %s, unexpected error: %v", test.extensions, test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Extensions: %v, Input: %s, Expected: %s, Got: %s", test.extensions, test.input, test.expected, output)
+		}
+	}
+}
+
+func TestRenderEscapeAlias(t *testing.T) {
+	tests := []struct {
+		alias    string
+		expected string
+	}{
+		{alias: "Foo [bar]", expected: `[Foo \[bar\]](/note)`},
+		{alias: "a | b", expected: `[a \| b](/note)`},
+		{alias: `back\slash`, expected: `[back\\slash](/note)`},
+		{alias: "Foo (bar)", expected: `[Foo (bar)](/note)`},
+	}
+
+	for _, test := range tests {
+		output, err := render("[[note]]", TemplateData{Alias: test.alias, Link: "/note"}, Options{})
+		if err != nil {
+			t.Errorf("Alias: %s, unexpected error: %v", test.alias, err)
+		}
+		if output != test.expected {
+			t.Errorf("Alias: %s, Expected: %s, Got: %s", test.alias, test.expected, output)
+		}
+	}
+}
+
+func TestRewriteMultiPipeAlias(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "[[note|Display | Subtitle]]", expected: `[Display \| Subtitle](/note)`},
+		{input: "[[note#Heading|A | B]]", expected: `[A \| B](/note#Heading)`},
+		{input: "[[note#Heading^abc|A | B]]", expected: `[A \| B](/note#Heading^abc)`},
+		{input: "| [[note|A | B]] | [[note]] |", expected: `| [A \| B](/note) | [note](/note) |`},
+	}
+	for _, test := range tests {
+		output, errs := Rewrite(test.input, idx, Options{Prefix: "/"})
+		if len(errs) > 0 {
+			t.Errorf("Input: %s, unexpected errors: %v", test.input, errs)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestReplaceLinkEncodedBase(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "My Note.md", Basename: "My Note", Ext: ".md", Path: "sub dir/My Note.md"},
+		FileInfo{Name: "50% off.md", Basename: "50% off", Ext: ".md", Path: "50% off.md"},
+	)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "[[My%20Note]]", expected: "[My Note](/sub-dir/My-Note)"},
+		{input: "[[My%20Note|Alias]]", expected: "[Alias](/sub-dir/My-Note)"},
+		{input: "[[sub%20dir/My%20Note.md#Heading]]", expected: "[sub dir/My Note.md](/sub-dir/My-Note#Heading)"},
+		{input: "[[My Note]]", expected: "[My Note](/sub-dir/My-Note)"},
+		{input: "[[50% off]]", expected: "[50% off](/50%25-off)"},
+	}
+	for _, test := range tests {
+		output, err := ReplaceLink(test.input, idx, Options{Prefix: "/"})
+		if err != nil {
+			t.Errorf("Input: %s, unexpected error: %v", test.input, err)
+		}
+		if output != test.expected {
+			t.Errorf("Input: %s, Expected: %s, Got: %s", test.input, test.expected, output)
+		}
+	}
+}
+
+func TestRewriteCode(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+
+	input := "See [[note]].\n\n```md\nWrite [[note]] to link.\n```\n\nOr `[[note|alias]]` inline, and [[missing]].\n"
+	expected := "See [note](/note).\n\n```md\nWrite [[note]] to link.\n```\n\nOr `[[note|alias]]` inline, and [[missing]].\n"
+	output, errs := Rewrite(input, idx, Options{Prefix: "/"})
+	if output != expected {
+		t.Errorf("Rewrite failed: got %q, want %q", output, expected)
+	}
+	if len(errs) != 1 {
+		t.Errorf("Rewrite failed: expected 1 error for the missing link, got %v", errs)
+	}
+}
+
+func TestJoinPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		path     string
+		expected string
+	}{
+		{prefix: "/", path: "guide.md", expected: "/guide.md"},
+		{prefix: "/docs", path: "guide.md", expected: "/docs/guide.md"},
+		{prefix: "/docs/", path: "guide.md", expected: "/docs/guide.md"},
+		{prefix: "/docs//", path: "/guide.md", expected: "/docs/guide.md"},
+		{prefix: "https://example.com/wiki", path: "sub/guide", expected: "https://example.com/wiki/sub/guide"},
+		{prefix: "https://example.com/wiki/", path: "/sub/guide", expected: "https://example.com/wiki/sub/guide"},
+		{prefix: "https://example.com", path: "my%20note", expected: "https://example.com/my%20note"},
+		{prefix: "https://example.com/my wiki/", path: "my%20note", expected: "https://example.com/my%20wiki/my%20note"},
+		{prefix: "https://example.com/wiki/", path: "", expected: "https://example.com/wiki/"},
+		{prefix: "/docs", path: "", expected: "/docs/"},
+		{prefix: "/", path: "", expected: "/"},
+		{prefix: "", path: "guide.md", expected: "guide.md"},
+	}
+
+	for _, test := range tests {
+		joined := joinPrefix(test.prefix, test.path)
+		if joined != test.expected {
+			t.Errorf("Prefix: %q, Path: %q, Expected: %q, Got: %q", test.prefix, test.path, test.expected, joined)
+		}
+	}
+}
+
+func TestReplaceLinkURLPrefix(t *testing.T) {
+	idx := newTestIndex(
+		FileInfo{Name: "my note.md", Basename: "my note", Ext: ".md", Path: "sub dir/my note.md"},
+		FileInfo{Name: "100% done.txt", Basename: "100% done", Ext: ".txt", Path: "100% done.txt"},
+	)
+
+	output, err := ReplaceLink("[[my note#Some Heading]]", idx, Options{Prefix: "https://example.com/wiki/"})
+	if err != nil {
+		t.Fatalf("ReplaceLink failed: %v", err)
+	}
+	if expected := "[my note](https://example.com/wiki/sub-dir/my-note#Some-Heading)"; output != expected {
+		t.Errorf("ReplaceLink failed: Expected: %s, Got: %s", expected, output)
+	}
+
+	output, err = ReplaceLink("[[100% done]]", idx, Options{Prefix: "https://example.com/wiki/"})
+	if err != nil {
+		t.Fatalf("ReplaceLink failed: %v", err)
+	}
+	if expected := "[100% done](https://example.com/wiki/100%25-done.txt)"; output != expected {
+		t.Errorf("ReplaceLink failed: Expected: %s, Got: %s", expected, output)
+	}
+
+	output, err = ReplaceLink("[[my note]]", idx, Options{Prefix: "https://example.com/wiki/", StripExt: true})
+	if err != nil {
+		t.Fatalf("ReplaceLink failed: %v", err)
+	}
+	if expected := "[my note](https://example.com/wiki/sub-dir/my-note)"; output != expected {
+		t.Errorf("ReplaceLink failed: Expected: %s, Got: %s", expected, output)
+	}
+}
+
+func TestReplaceLinkPrefix(t *testing.T) {
+	idx := newTestIndex(FileInfo{
+		Name:     "guide.md",
+		Basename: "guide",
+		Ext:      ".md",
+		Path:     "guide.md",
+	})
+
+	for _, prefix := range []string{"/docs", "/docs/"} {
+		output, err := ReplaceLink("[[guide]]", idx, Options{Prefix: prefix})
+		if err != nil {
+			t.Errorf("Prefix: %s, unexpected error: %v", prefix, err)
+		}
+		if expected := "[guide](/docs/guide)"; output != expected {
+			t.Errorf("Prefix: %s, Expected: %s, Got: %s", prefix, expected, output)
+		}
+	}
+}
+
+func newTestIndex(files ...FileInfo) Index {
+	idx := NewIndex(".", IndexOptions{})
+	for _, file := range files {
+		idx.Add(file)
+	}
+	return idx
+}
@@ -0,0 +1,107 @@
+package linklore
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Anchor styles select the heading ID scheme used when slugifying anchors.
+const (
+	// AnchorStyleGitHub lowercases the heading, drops punctuation and
+	// replaces spaces with hyphens, e.g. "My Heading!" -> "my-heading".
+	AnchorStyleGitHub = "github"
+	// AnchorStyleObsidian keeps the heading as written and replaces runs of
+	// whitespace with a hyphen, e.g. "My Heading!" -> "My-Heading!".
+	AnchorStyleObsidian = "obsidian"
+)
+
+// Path transforms change the path of each link, e.g. for a site publishing
+// CamelCase.md as /camelcase.
+const (
+	// PathTransformNone keeps the path as named in the index.
+	PathTransformNone = "none"
+	// PathTransformLower lowercases the path, e.g. "My Note" -> "my-note".
+	PathTransformLower = "lower"
+	// PathTransformSlug slugifies each segment of the path like a GitHub
+	// heading, e.g. "My Note (draft)" -> "my-note-draft".
+	PathTransformSlug = "slug"
+)
+
+// transformPath applies transform, one of the PathTransform constants, to
+// the slash-separated path, without extension. The "." and ".." segments of
+// a relative path are kept.
+func transformPath(path, transform string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "." || segment == "..":
+		case transform == PathTransformLower:
+			segments[i] = strings.ToLower(segment)
+		case transform == PathTransformSlug:
+			segments[i] = slugifyGitHub(segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func slugify(s string) string {
+	// TODO: permalink YAML key,
+	// see https://help.obsidian.md/Obsidian+Publish/Publish+and+unpublish+notes#Permalinks
+	// TODO: support custom slug rules / ruleset
+
+	// obsidian slug rules
+	// Example: "Bézout's Identity" -> "Bézout's-Identity"
+
+	// 1. replace space with -
+	slug := strings.ReplaceAll(s, " ", "-")
+
+	// 2. replace multiple - with single -
+	slug = strings.ReplaceAll(slug, "--", "-")
+
+	// 3. remove leading and trailing -
+	slug = strings.Trim(slug, "-")
+
+	// 4. encodeURIComponent
+	// slug = url.PathEscape(slug)
+
+	// remove .md suffix
+	slug = strings.TrimSuffix(slug, ".md")
+	return slug
+}
+
+// escapePath percent-encodes each segment of a slash-separated path,
+// leaving the separators intact.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// slugifyAnchor returns the fragment for anchor, before it is percent-encoded.
+// Without SlugifyAnchors, each run of whitespace becomes a single "-" and the
+// punctuation is kept, e.g. "Section 1.2:  Intro" -> "Section-1.2:-Intro".
+func slugifyAnchor(anchor string, opts Options) string {
+	if !opts.SlugifyAnchors || opts.AnchorStyle == AnchorStyleObsidian {
+		return strings.Join(strings.Fields(anchor), "-")
+	}
+	return slugifyGitHub(anchor)
+}
+
+// slugifyGitHub follows github-slugger: letters (including non-ASCII ones),
+// digits, "-" and "_" are kept, spaces become "-", everything else is
+// dropped.
+func slugifyGitHub(s string) string {
+	var slug strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsNumber(r), unicode.IsMark(r), r == '-', r == '_':
+			slug.WriteRune(r)
+		case r == ' ':
+			slug.WriteRune('-')
+		}
+	}
+	return slug.String()
+}
@@ -0,0 +1,33 @@
+package linklore
+
+import "testing"
+
+func TestSlugifyAnchor(t *testing.T) {
+	tests := []struct {
+		opts     Options
+		anchor   string
+		expected string
+	}{
+		{opts: Options{}, anchor: "My Heading", expected: "My-Heading"},
+		{opts: Options{}, anchor: "Section 1.2: Intro", expected: "Section-1.2:-Intro"},
+		{opts: Options{}, anchor: " A   B\tC ", expected: "A-B-C"},
+		{opts: Options{}, anchor: "Notes on .md", expected: "Notes-on-.md"},
+		{opts: Options{SlugifyAnchors: true}, anchor: "My Heading!", expected: "my-heading"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "Bézout's Identity", expected: "bézouts-identity"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "  C++ & Go: 2 ways ", expected: "c--go-2-ways"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "snake_case-name", expected: "snake_case-name"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "Section 1.2: Intro", expected: "section-12-intro"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "v2.0.1  Release", expected: "v201--release"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleGitHub}, anchor: "小节 一：概述", expected: "小节-一概述"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleObsidian}, anchor: "Bézout's  Identity", expected: "Bézout's-Identity"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleObsidian}, anchor: "小节 一：概述", expected: "小节-一：概述"},
+		{opts: Options{SlugifyAnchors: true, AnchorStyle: AnchorStyleObsidian}, anchor: "Section 1.2:   Intro", expected: "Section-1.2:-Intro"},
+	}
+
+	for _, test := range tests {
+		slug := slugifyAnchor(test.anchor, test.opts)
+		if slug != test.expected {
+			t.Errorf("Anchor: %q, Style: %q, Expected: %q, Got: %q", test.anchor, test.opts.AnchorStyle, test.expected, slug)
+		}
+	}
+}
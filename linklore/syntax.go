@@ -0,0 +1,88 @@
+package linklore
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Syntax holds the delimiters of a wikilink. Empty fields mean the
+// corresponding field of DefaultSyntax.
+type Syntax struct {
+	Open   string
+	Close  string
+	Alias  string
+	Anchor string
+	Block  string
+}
+
+// DefaultSyntax is the Obsidian wikilink syntax, [[base|alias#anchor^block]].
+var DefaultSyntax = Syntax{Open: "[[", Close: "]]", Alias: "|", Anchor: "#", Block: "^"}
+
+// CompilePattern returns the pattern matching wikilinks written in syntax,
+// with the same groups as LinkPattern.
+func CompilePattern(syntax Syntax) (*regexp.Regexp, error) {
+	syntax = syntax.withDefaults()
+	if syntax.Alias == syntax.Anchor || syntax.Alias == syntax.Block || syntax.Anchor == syntax.Block {
+		return nil, errors.New("alias, anchor and block separators must differ")
+	}
+
+	// A component cannot contain any character of a delimiter, except for
+	// the alias, which may contain further alias separators, and for the
+	// characters of Open and Close escaped with a backslash.
+	escaped := `\\[` + charClass(syntax.Open+syntax.Close) + `]`
+	component := "((?:" + escaped + "|[^" + charClass(syntax.Open+syntax.Close+syntax.Alias+syntax.Anchor+syntax.Block) + "])+)"
+	alias := "((?:" + escaped + "|[^" + charClass(syntax.Open+syntax.Close+syntax.Anchor+syntax.Block) + "])+)"
+	optional := func(separator, component string) string {
+		return "(?:" + regexp.QuoteMeta(separator) + component + ")?"
+	}
+	return regexp.Compile(`!?` +
+		regexp.QuoteMeta(syntax.Open) + component + `?` +
+		optional(syntax.Alias, alias) +
+		optional(syntax.Anchor, component) +
+		optional(syntax.Block, component) +
+		optional(syntax.Alias, alias) +
+		regexp.QuoteMeta(syntax.Close))
+}
+
+func (s Syntax) withDefaults() Syntax {
+	if s.Open == "" {
+		s.Open = DefaultSyntax.Open
+	}
+	if s.Close == "" {
+		s.Close = DefaultSyntax.Close
+	}
+	if s.Alias == "" {
+		s.Alias = DefaultSyntax.Alias
+	}
+	if s.Anchor == "" {
+		s.Anchor = DefaultSyntax.Anchor
+	}
+	if s.Block == "" {
+		s.Block = DefaultSyntax.Block
+	}
+	return s
+}
+
+// charClass returns the body of a character class matching each character
+// of chars. ASCII punctuation is escaped, which is always valid in a class.
+func charClass(chars string) string {
+	var class strings.Builder
+	seen := make(map[rune]bool)
+	for _, r := range chars {
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		if r < utf8.RuneSelf && !isAlnum(r) {
+			class.WriteByte('\\')
+		}
+		class.WriteRune(r)
+	}
+	return class.String()
+}
+
+func isAlnum(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9'
+}
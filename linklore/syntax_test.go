@@ -0,0 +1,35 @@
+package linklore
+
+import "testing"
+
+func TestCompilePattern(t *testing.T) {
+	idx := newTestIndex(FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"})
+
+	tests := []struct {
+		syntax   Syntax
+		input    string
+		expected string
+	}{
+		{syntax: Syntax{}, input: "[[note|Alias]] [[note#Heading^block]]", expected: "[Alias](/note) [note](/note#Heading^block)"},
+		{syntax: DefaultSyntax, input: "[[note#Heading|Alias]]", expected: "[Alias](/note#Heading)"},
+		{syntax: Syntax{Open: "{{", Close: "}}"}, input: "{{note|Alias}} [[note]]", expected: "[Alias](/note) [[note]]"},
+		{syntax: Syntax{Open: "{{", Close: "}}", Alias: "::", Anchor: "@"}, input: "!{{note@Heading::Alias}}", expected: "[Alias](/note#Heading)"},
+		{syntax: Syntax{Open: "((", Close: "))", Block: "$"}, input: "((note$abc)) ((a.b))", expected: "[note](/note#^abc) ((a.b))"},
+		{syntax: Syntax{Open: "{{", Close: "}}", Alias: "::"}, input: "{{note::A::B}}", expected: "[A::B](/note)"},
+	}
+
+	for _, test := range tests {
+		pattern, err := CompilePattern(test.syntax)
+		if err != nil {
+			t.Fatalf("CompilePattern failed for %+v: %v", test.syntax, err)
+		}
+		output, _ := Rewrite(test.input, idx, Options{Prefix: "/", Pattern: pattern})
+		if output != test.expected {
+			t.Errorf("Syntax: %+v, Input: %s, Expected: %s, Got: %s", test.syntax, test.input, test.expected, output)
+		}
+	}
+
+	if _, err := CompilePattern(Syntax{Alias: "#"}); err == nil {
+		t.Errorf("CompilePattern failed: expected error for alias and anchor separators that are the same")
+	}
+}
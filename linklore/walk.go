@@ -0,0 +1,375 @@
+package linklore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// indexWalker adds the files of a directory tree to an index, one directory
+// at a time.
+type indexWalker struct {
+	ctx     context.Context
+	idx     Index
+	baseDir string
+	ignore  Matcher
+	count   int
+	visited visitedDirs
+}
+
+// walk indexes the files under dir. prefix is the path of dir relative to
+// the base directory, which differs from dir when dir is the target of a
+// symlink; it is empty for the base directory itself.
+func (w *indexWalker) walk(dir, prefix string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %v", err)
+		}
+		relativePath = filepath.Join(prefix, relativePath)
+
+		// The base directory is never ignored, and the target of a symlink was
+		// already matched through the link.
+		if path != dir {
+			ignored, err := w.ignore.Match(relativePath, d.IsDir())
+			if err != nil {
+				return err
+			}
+			if ignored {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 && w.idx.opts.FollowSymlinks {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return err
+				}
+				return w.walk(target, relativePath)
+			}
+		}
+
+		if d.IsDir() {
+			if w.idx.opts.FollowSymlinks {
+				visited, err := w.visited.visit(path)
+				if err != nil {
+					return err
+				}
+				if visited {
+					return filepath.SkipDir
+				}
+			}
+			w.idx.dirs[path] = walkedDir{BaseDir: w.baseDir, Path: path, Prefix: slashPrefix(relativePath)}
+			return nil
+		}
+
+		included, err := isIncluded(d.Name(), w.idx.opts.Include)
+		if err != nil || !included {
+			return err
+		}
+
+		// Past the limit, files are only counted, so that the error reports
+		// how many there are.
+		w.count++
+		if maxFiles := w.idx.opts.MaxFiles; maxFiles > 0 && w.count > maxFiles {
+			return nil
+		}
+		fileInfo, err := readFileInfo(newFileInfo(w.baseDir, d.Name(), relativePath), path, w.idx.opts)
+		if err != nil {
+			return err
+		}
+		w.idx.Add(fileInfo)
+		return nil
+	})
+}
+
+// parallelWalker reads the directories of a tree concurrently, at most
+// cap(sem) at a time. The files are collected rather than added to an index
+// directly, so that they can be added in the order indexWalker would add
+// them and duplicates are reported the same way.
+type parallelWalker struct {
+	ctx     context.Context
+	opts    IndexOptions
+	ignore  Matcher
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	count   atomic.Int64
+	visited visitedDirs
+
+	mu    sync.Mutex
+	files []FileInfo
+	dirs  []walkedDir
+	err   error
+}
+
+// run walks baseDir and returns its files sorted in walk order and the
+// directories read, along with the first error encountered.
+func (w *parallelWalker) run(baseDir string) ([]FileInfo, []walkedDir, error) {
+	if w.opts.FollowSymlinks {
+		if _, err := w.visited.visit(baseDir); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	w.files = nil
+	w.dirs = nil
+	w.wg.Add(1)
+	go w.walkDir(baseDir, "")
+	w.wg.Wait()
+
+	for i := range w.files {
+		w.files[i].Dir = baseDir
+	}
+	for i := range w.dirs {
+		w.dirs[i].BaseDir = baseDir
+	}
+
+	sort.Slice(w.files, func(i, j int) bool {
+		return walkOrderLess(w.files[i].Path, w.files[j].Path)
+	})
+	return w.files, w.dirs, w.err
+}
+
+// walkDir collects the files in dir and starts walking its subdirectories.
+// prefix is the path of dir relative to the base directory.
+func (w *parallelWalker) walkDir(dir, prefix string) {
+	defer w.wg.Done()
+	if w.failed() {
+		return
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.fail(err)
+		return
+	}
+
+	w.sem <- struct{}{}
+	entries, err := os.ReadDir(dir)
+	<-w.sem
+	if err != nil {
+		w.fail(err)
+		return
+	}
+
+	var files []FileInfo
+	for _, entry := range entries {
+		if err := w.ctx.Err(); err != nil {
+			w.fail(err)
+			return
+		}
+		path := filepath.Join(dir, entry.Name())
+		relativePath := filepath.Join(prefix, entry.Name())
+
+		ignored, err := w.ignore.Match(relativePath, entry.IsDir())
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		if ignored {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&fs.ModeSymlink != 0 && w.opts.FollowSymlinks {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				target, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					w.fail(err)
+					return
+				}
+				path, isDir = target, true
+			}
+		}
+
+		if isDir {
+			if w.opts.FollowSymlinks {
+				visited, err := w.visited.visit(path)
+				if err != nil {
+					w.fail(err)
+					return
+				}
+				if visited {
+					continue
+				}
+			}
+			w.wg.Add(1)
+			go w.walkDir(path, relativePath)
+			continue
+		}
+
+		included, err := isIncluded(entry.Name(), w.opts.Include)
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		if !included {
+			continue
+		}
+		if maxFiles := int64(w.opts.MaxFiles); w.count.Add(1) > maxFiles && maxFiles > 0 {
+			continue
+		}
+		w.sem <- struct{}{}
+		fileInfo, err := readFileInfo(newFileInfo("", entry.Name(), relativePath), path, w.opts)
+		<-w.sem
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		files = append(files, fileInfo)
+	}
+
+	w.mu.Lock()
+	w.files = append(w.files, files...)
+	w.dirs = append(w.dirs, walkedDir{Path: dir, Prefix: filepath.ToSlash(prefix)})
+	w.mu.Unlock()
+}
+
+func (w *parallelWalker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *parallelWalker) failed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err != nil
+}
+
+// visitedDirs holds the real paths of the directories walked so far when
+// following symlinks, so that a symlink cycle is walked only once.
+type visitedDirs struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+// visit records dir as walked and reports whether it had been walked before.
+func (v *visitedDirs) visit(dir string) (bool, error) {
+	realPath, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return false, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.paths[realPath] {
+		return true, nil
+	}
+	if v.paths == nil {
+		v.paths = make(map[string]bool)
+	}
+	v.paths[realPath] = true
+	return false, nil
+}
+
+// slashPrefix returns relativePath with slashes, and "" for the base
+// directory itself.
+func slashPrefix(relativePath string) string {
+	if relativePath == "." {
+		return ""
+	}
+	return filepath.ToSlash(relativePath)
+}
+
+func newFileInfo(baseDir, name, relativePath string) FileInfo {
+	ext := filepath.Ext(name)
+	return FileInfo{
+		Name:     name,
+		Basename: strings.TrimSuffix(name, ext),
+		Ext:      ext,
+		Dir:      baseDir,
+		Path:     filepath.ToSlash(relativePath),
+	}
+}
+
+// readFileInfo adds to fileInfo, found at path, what opts asks to read from
+// its content.
+func readFileInfo(fileInfo FileInfo, path string, opts IndexOptions) (FileInfo, error) {
+	if fileInfo.Ext != ".md" || !opts.Headings && !opts.Titles && !opts.Aliases {
+		return fileInfo, nil
+	}
+	reason, err := unparsedReason(path, opts)
+	if err != nil || reason != "" {
+		fileInfo.Unparsed = reason
+		return fileInfo, err
+	}
+	fileInfo, err = addHeadings(fileInfo, path, opts)
+	if err != nil {
+		return fileInfo, err
+	}
+	return addFrontmatter(fileInfo, path, opts)
+}
+
+// binarySniffLength is the number of bytes at the start of a file searched
+// for a NUL byte, as git does to tell binary files.
+const binarySniffLength = 8000
+
+// unparsedReason returns why the file at path should not be parsed, or ""
+// if it can be.
+func unparsedReason(path string, opts IndexOptions) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if opts.MaxParseSize > 0 && info.Size() > opts.MaxParseSize {
+		return fmt.Sprintf("larger than %d bytes", opts.MaxParseSize), nil
+	}
+	head := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if bytes.IndexByte(head[:n], 0) >= 0 {
+		return "binary", nil
+	}
+	return "", nil
+}
+
+// walkOrderLess reports whether filepath.WalkDir visits the file at slash
+// separated path a before the one at b: entries are visited in lexical
+// order one directory at a time, so "a/b" comes before "a.md".
+func walkOrderLess(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			// A component ending here sorts before a longer one.
+			switch {
+			case a[i] == '/':
+				return true
+			case b[i] == '/':
+				return false
+			}
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,48 @@
+package linklore
+
+import "strings"
+
+// WikiLink is a wikilink found in Markdown content, split into its
+// components, e.g. "![[note#Heading^block|alias]]".
+type WikiLink struct {
+	// Embed reports whether the link is an embed, written with a leading
+	// "!".
+	Embed  bool
+	Base   string
+	Alias  string
+	Anchor string
+	Block  string
+	// Text is the link as written, found at content[Start:End]. The offsets
+	// are in bytes.
+	Text  string
+	Start int
+	End   int
+}
+
+// ParseLinks returns the wikilinks of content, written in DefaultSyntax, in
+// order. As when rewriting, the links inside code are left out, and the
+// components are unescaped and decoded.
+func ParseLinks(content string) []WikiLink {
+	var opts Options
+	var links []WikiLink
+	for _, loc := range FindLinks(opts.pattern(), content) {
+		link := parseWikiLink(content[loc[0]:loc[1]], opts)
+		link.Start, link.End = loc[0], loc[1]
+		links = append(links, link)
+	}
+	return links
+}
+
+// parseWikiLink returns the components of match, a single match of
+// opts.Pattern.
+func parseWikiLink(match string, opts Options) WikiLink {
+	base, alias, anchor, block := parseLink(match, opts)
+	return WikiLink{
+		Embed:  strings.HasPrefix(match, "!"),
+		Base:   base,
+		Alias:  alias,
+		Anchor: anchor,
+		Block:  block,
+		Text:   match,
+	}
+}
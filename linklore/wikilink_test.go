@@ -0,0 +1,30 @@
+package linklore
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	content := "See [[note#Heading|the note]] and ![[image.png]].\n`[[code]]` [[My%20Note^abc123]] [[#Intro]]"
+
+	expected := []WikiLink{
+		{Base: "note", Alias: "the note", Anchor: "Heading", Text: "[[note#Heading|the note]]", Start: 4, End: 29},
+		{Embed: true, Base: "image.png", Text: "![[image.png]]", Start: 34, End: 48},
+		{Base: "My Note", Block: "abc123", Text: "[[My%20Note^abc123]]", Start: 61, End: 81},
+		{Anchor: "Intro", Text: "[[#Intro]]", Start: 82, End: 92},
+	}
+	links := ParseLinks(content)
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("ParseLinks failed: got %+v, want %+v", links, expected)
+	}
+	for _, link := range links {
+		if content[link.Start:link.End] != link.Text {
+			t.Errorf("ParseLinks failed: %q is not at [%d:%d]", link.Text, link.Start, link.End)
+		}
+	}
+
+	if links := ParseLinks("no links here"); len(links) != 0 {
+		t.Errorf("ParseLinks failed: expected no links, got %+v", links)
+	}
+}
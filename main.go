@@ -2,316 +2,2147 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pluveto/linklore/linklore"
 )
 
-type FileInfo struct {
-	name     string
-	basename string
-	ext      string
-	path     string
+// linkChange records how a single wikilink in the input was handled.
+type linkChange struct {
+	match       string
+	replacement string
+	err         error
+	// line and column locate the link in the input, starting at 1. The
+	// column counts characters, not bytes.
+	line   int
+	column int
+}
+
+// unresolvedLinksError lists the links of an input file that could not be
+// resolved in strict mode.
+type unresolvedLinksError struct {
+	inputFile string
+	links     []string
+}
+
+func (e *unresolvedLinksError) Error() string {
+	return fmt.Sprintf("%s: %d unresolved link(s): %s", e.inputFile, len(e.links), strings.Join(e.links, ", "))
+}
+
+// runStats counts the files and links processed in a run, and collects the
+// links that could not be rewritten for the report at its end, and the
+// records of every link for --report. It is shared by the configs of every
+// file, so that directory mode aggregates them.
+type runStats struct {
+	files      int
+	rewritten  int
+	unresolved int
+	issues     []linkIssue
+	records    []linklore.LinkRecord
+}
+
+// merge adds the counts and links of other to s. It is a no-op if either is
+// nil.
+func (s *runStats) merge(other *runStats) {
+	if s == nil || other == nil {
+		return
+	}
+	s.files += other.files
+	s.rewritten += other.rewritten
+	s.unresolved += other.unresolved
+	s.issues = append(s.issues, other.issues...)
+	s.records = append(s.records, other.records...)
+}
+
+// record adds the outcome of processing one file. It is a no-op on nil.
+func (s *runStats) record(inputFile string, changes []linkChange) {
+	if s == nil {
+		return
+	}
+	s.files++
+	for _, change := range changes {
+		if change.err != nil {
+			s.issues = append(s.issues, newLinkIssue(inputFile, change))
+		}
+		if change.err != nil && !linklore.IsWarning(change.err) {
+			s.unresolved++
+		} else {
+			s.rewritten++
+		}
+	}
+}
+
+// sort orders the issues and the records by input file and position, so that
+// what is reported does not depend on the order the files were processed
+// in. It is a no-op on nil.
+func (s *runStats) sort() {
+	if s == nil {
+		return
+	}
+	slices.SortStableFunc(s.issues, func(a, b linkIssue) int {
+		return comparePositions(a.File, a.Line, a.Column, b.File, b.Line, b.Column)
+	})
+	slices.SortStableFunc(s.records, func(a, b linklore.LinkRecord) int {
+		return comparePositions(a.Source, a.Line, a.Column, b.Source, b.Line, b.Column)
+	})
+}
+
+// comparePositions compares the position of a link in fileA with that of a
+// link in fileB, the files by name, like strings.Compare.
+func comparePositions(fileA string, lineA, columnA int, fileB string, lineB, columnB int) int {
+	if c := strings.Compare(fileA, fileB); c != 0 {
+		return c
+	}
+	if lineA != lineB {
+		return lineA - lineB
+	}
+	return columnA - columnB
+}
+
+// addRecord adds the record of a link. It is a no-op on nil.
+func (s *runStats) addRecord(record linklore.LinkRecord) {
+	if s != nil {
+		s.records = append(s.records, record)
+	}
+}
+
+func (s *runStats) summary(elapsed time.Duration) string {
+	return fmt.Sprintf("processed %d file(s), %d link(s) rewritten, %d unresolved, %.2fs",
+		s.files, s.rewritten, s.unresolved, elapsed.Seconds())
+}
+
+type Config struct {
+	inputFile       string
+	inputFiles      []string
+	outputFile      string
+	outDir          string
+	outSuffix       string
+	ignorePatterns  []string
+	noDefaultIgnore bool
+	includePatterns []string
+	priorityDirs    []string
+	ignoreStyle     string
+	baseDir         string
+	autoBase        bool
+	prefix          string
+	baseURL         string
+	envBaseURL      string
+	force           bool
+	skipIdentical   bool
+	inPlace         bool
+	backup          bool
+	recursive       bool
+	filesFrom       string
+	filesFrom0      string
+	stripExt        bool
+	extMap          string
+	extensions      map[string]string
+	imageExts       string
+	imageExtensions []string
+	prefixMap       string
+	prefixes        map[string]string
+	caseInsensitive bool
+	looseMatch      bool
+	followSymlinks  bool
+	indexTitles     bool
+	indexAliases    bool
+	indexCache      string
+	noCache         bool
+	maxFiles        int
+	maxParseSize    int
+	concurrency     int
+	dumpIndex       bool
+	verbose         bool
+	quiet           bool
+	template        string
+	linkTemplate    *template.Template
+	syntax          linklore.Syntax
+	maxLinkLength   int
+	linkPattern     *regexp.Regexp
+	dryRun          bool
+	keepGoing       bool
+	diff            bool
+	extract         bool
+	extractFormat   string
+	check           bool
+	strict          bool
+	failOnDuplicate bool
+	embedMode       string
+	slugifyAnchors  bool
+	validateAnchors bool
+	refStyle        bool
+	linkTitles      bool
+	relativeLinks   bool
+	anchorStyle     string
+	anchorPrefix    string
+	blockMode       string
+	linkFormat      string
+	resolveNearest  bool
+	unresolvedMode  string
+	frontmatterMode string
+	selfLinkMode    string
+	pathTransform   string
+	reportFormat    string
+	reportFile      string
+	linkStats       bool
+	linkStatsFile   string
+	pathRule        string
+	index           linklore.Index
+	stats           *runStats
+}
+
+var Version = "dev"
+
+// BuildDate is set at build time with -ldflags. When empty, the commit time
+// recorded by the go command is reported instead.
+var BuildDate = ""
+
+// versionInfo returns the version and the build metadata in info, one
+// "key: value" pair per line. Unknown values are reported as "unknown".
+func versionInfo(info *debug.BuildInfo) string {
+	goVersion, commit, date, modified := "unknown", "unknown", "unknown", false
+	if info != nil {
+		goVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.time":
+				date = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if modified {
+		commit += " (modified)"
+	}
+	if BuildDate != "" {
+		date = BuildDate
+	}
+	return fmt.Sprintf("linklore %s\ngo: %s\ncommit: %s\ndate: %s\n", Version, goVersion, commit, date)
+}
+
+// stringList is a flag that can be repeated, collecting every value.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// commandCheck is the subcommand that only reports unresolved links.
+const commandCheck = "check"
+
+// splitCommand returns the subcommand at the start of args, or "" for the
+// default command, and the arguments following it.
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 && args[0] == commandCheck {
+		return args[0], args[1:]
+	}
+	return "", args
+}
+
+// stdio is the path that stands for stdin when used as the input file and
+// stdout when used as the output file.
+const stdio = "-"
+
+func main() {
+	start := time.Now()
+	runStart := start
+	config, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:", err)
+		os.Exit(1)
+	}
+	if config.verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	}
+	slog.Debug("loaded config", "duration", time.Since(start))
+
+	err = validateConfig(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid args:", err)
+		os.Exit(1)
+	}
+
+	// The first Ctrl-C stops the run cleanly; a second one kills it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start = time.Now()
+	config.index, err = buildIndex(ctx, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error building index:", err)
+		var tooMany *linklore.TooManyFilesError
+		if errors.As(err, &tooMany) {
+			fmt.Fprintln(os.Stderr, "raise the limit with --max-files, or set it to 0 for no limit")
+		}
+		os.Exit(1)
+	}
+	slog.Debug("built index", "dirs", config.baseDir, "files", config.index.Len(),
+		"duplicates", len(config.index.DuplicateKeys()), "duration", time.Since(start))
+	if !config.quiet && config.reportFormat != reportFormatJSON {
+		reportUnparsed(config)
+	}
+
+	if config.dumpIndex {
+		err = dumpIndex(os.Stdout, config.index)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error dumping index:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	start = time.Now()
+	config.stats = &runStats{}
+	switch {
+	case hasFileList(config):
+		err = processFilesFrom(ctx, config)
+	case len(config.inputFiles) > 1:
+		err = processFiles(ctx, config, config.inputFiles)
+	case isDirectoryMode(config):
+		err = processDir(ctx, config)
+	default:
+		err = processFile(config)
+	}
+	slog.Debug("processed input", "input", config.inputFile, "duration", time.Since(start))
+	config.stats.sort()
+	switch {
+	case config.reportFormat == reportFormatJSON:
+		if err := writeJSONReport(os.Stderr, config, time.Since(runStart).Seconds()); err != nil {
+			fmt.Fprintln(os.Stderr, "error writing report:", err)
+		}
+	case !config.quiet:
+		writeIssues(os.Stderr, config.stats.issues, useColor(os.Stderr))
+		reportDuplicates(config)
+		fmt.Fprintln(os.Stderr, config.stats.summary(time.Since(runStart)))
+	default:
+		reportDuplicates(config)
+	}
+	if config.reportFile != "" {
+		if err := writeReportFile(config.reportFile, config.stats.records); err != nil {
+			fmt.Fprintln(os.Stderr, "error writing report:", err)
+			os.Exit(1)
+		}
+	}
+	if config.linkStats {
+		if err := writeLinkStatsTo(config.linkStatsFile, config.stats.records); err != nil {
+			fmt.Fprintln(os.Stderr, "error writing link stats:", err)
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error processing file:", err)
+		os.Exit(1)
+	}
+}
+
+func validateConfig(config Config) error {
+	// --dump-index does not process any file.
+	if !config.dumpIndex {
+		if err := validateInput(config); err != nil {
+			return err
+		}
+	}
+	for _, baseDir := range strings.Split(config.baseDir, ",") {
+		if baseDir == "" {
+			return errors.New("base directory is not specified")
+		}
+	}
+	switch config.embedMode {
+	case linklore.EmbedModeLink, linklore.EmbedModeImage, linklore.EmbedModeInline:
+	default:
+		return fmt.Errorf("invalid embed mode: %s (expect %s, %s or %s)", config.embedMode,
+			linklore.EmbedModeLink, linklore.EmbedModeImage, linklore.EmbedModeInline)
+	}
+	switch config.anchorStyle {
+	case linklore.AnchorStyleGitHub, linklore.AnchorStyleObsidian:
+	default:
+		return fmt.Errorf("invalid anchor style: %s (expect %s or %s)", config.anchorStyle,
+			linklore.AnchorStyleGitHub, linklore.AnchorStyleObsidian)
+	}
+	switch config.linkFormat {
+	case linklore.LinkFormatShortest, linklore.LinkFormatRelative, linklore.LinkFormatAbsolute:
+	default:
+		return fmt.Errorf("invalid link format: %s (expect %s, %s or %s)", config.linkFormat,
+			linklore.LinkFormatShortest, linklore.LinkFormatRelative, linklore.LinkFormatAbsolute)
+	}
+	switch config.unresolvedMode {
+	case linklore.UnresolvedModeKeep, linklore.UnresolvedModePlain, linklore.UnresolvedModeRemove:
+	default:
+		return fmt.Errorf("invalid unresolved mode: %s (expect %s, %s or %s)", config.unresolvedMode,
+			linklore.UnresolvedModeKeep, linklore.UnresolvedModePlain, linklore.UnresolvedModeRemove)
+	}
+	switch config.frontmatterMode {
+	case linklore.FrontmatterModeProcess, linklore.FrontmatterModeSkip:
+	default:
+		return fmt.Errorf("invalid frontmatter mode: %s (expect %s or %s)", config.frontmatterMode,
+			linklore.FrontmatterModeProcess, linklore.FrontmatterModeSkip)
+	}
+	switch config.selfLinkMode {
+	case linklore.SelfLinkModeKeep, linklore.SelfLinkModeAnchor, linklore.SelfLinkModeWarn:
+	default:
+		return fmt.Errorf("invalid self-link mode: %s (expect %s, %s or %s)", config.selfLinkMode,
+			linklore.SelfLinkModeKeep, linklore.SelfLinkModeAnchor, linklore.SelfLinkModeWarn)
+	}
+	switch config.pathTransform {
+	case linklore.PathTransformNone, linklore.PathTransformLower, linklore.PathTransformSlug:
+	default:
+		return fmt.Errorf("invalid path transform: %s (expect %s, %s or %s)", config.pathTransform,
+			linklore.PathTransformNone, linklore.PathTransformLower, linklore.PathTransformSlug)
+	}
+	if config.extract {
+		switch config.extractFormat {
+		case reportFormatText, reportFormatJSON:
+		default:
+			return fmt.Errorf("invalid extract format: %s (expect %s or %s)", config.extractFormat,
+				reportFormatText, reportFormatJSON)
+		}
+		if config.diff {
+			return errors.New("--extract cannot be used with --diff")
+		}
+	}
+	switch config.reportFormat {
+	case reportFormatText, reportFormatJSON:
+	default:
+		return fmt.Errorf("invalid report format: %s (expect %s or %s)", config.reportFormat,
+			reportFormatText, reportFormatJSON)
+	}
+	if _, exists := pathRules[config.pathRule]; config.pathRule != "" && !exists {
+		return fmt.Errorf("invalid path rule: %s (expect date or flat)", config.pathRule)
+	}
+	if config.linkTitles && (config.refStyle || config.template != linklore.TitleTemplate) {
+		return errors.New("--link-titles cannot be used with --ref-style or --template (use {{.Title}} in the template instead)")
+	}
+	if config.relativeLinks && config.pathRule != "" {
+		return errors.New("--relative-links cannot be used with --path-rule")
+	}
+	switch config.blockMode {
+	case linklore.BlockModeKeep, linklore.BlockModeSlug, linklore.BlockModeDrop:
+	default:
+		return fmt.Errorf("invalid block mode: %s (expect %s, %s or %s)", config.blockMode,
+			linklore.BlockModeKeep, linklore.BlockModeSlug, linklore.BlockModeDrop)
+	}
+	if strings.Contains(config.prefix, "://") {
+		prefixURL, err := url.Parse(config.prefix)
+		if err != nil {
+			return fmt.Errorf("invalid prefix: %w", err)
+		}
+		if prefixURL.Host == "" {
+			return fmt.Errorf("invalid prefix: %s (expect a host, e.g. https://example.com/wiki/)", config.prefix)
+		}
+	}
+	if config.baseURL != "" {
+		baseURL, err := url.Parse(config.baseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base URL: %w", err)
+		}
+		if !baseURL.IsAbs() || baseURL.Host == "" {
+			return fmt.Errorf("invalid base URL: %s (expect a scheme and a host, e.g. https://example.com)", config.baseURL)
+		}
+		if strings.Contains(config.prefix, "://") {
+			return fmt.Errorf("--base-url cannot be used with a prefix that is a URL: %s", config.prefix)
+		}
+	}
+	if _, err := linklore.CompilePattern(config.syntax); err != nil {
+		return fmt.Errorf("invalid link syntax: %w", err)
+	}
+	if config.maxLinkLength < 0 {
+		return fmt.Errorf("invalid max link length: %d (expect 0 for no limit or a positive number)", config.maxLinkLength)
+	}
+	if config.maxParseSize < 0 {
+		return fmt.Errorf("invalid max parse size: %d (expect 0 for no limit or a positive number)", config.maxParseSize)
+	}
+	if config.maxFiles < 0 {
+		return fmt.Errorf("invalid max files: %d (expect 0 for no limit or a positive number)", config.maxFiles)
+	}
+	if strings.ContainsAny(config.outSuffix, `/\`) {
+		return fmt.Errorf("invalid out suffix: %s (expect a file name suffix, without path separators)", config.outSuffix)
+	}
+	if config.concurrency < 0 {
+		return fmt.Errorf("invalid concurrency: %d (expect 0 for the number of CPUs or a positive number)", config.concurrency)
+	}
+	if config.ignorePatterns == nil {
+		return errors.New("bug: ignore patterns should not be nil, expect []")
+	}
+
+	err := validatePatterns("ignore", config.ignorePatterns)
+	if err != nil {
+		return err
+	}
+	_, err = linklore.NewMatcher(config.ignorePatterns, config.ignoreStyle)
+	if err != nil {
+		return fmt.Errorf("invalid ignore patterns: %w (expect style %s or %s)", err,
+			linklore.IgnoreStyleGlob, linklore.IgnoreStyleGitignore)
+	}
+	return validatePatterns("include", config.includePatterns)
+}
+
+// validatePatterns checks that each pattern can be used with filepath.Match.
+// kind names the option in error messages.
+func validatePatterns(kind string, patterns []string) error {
+	for _, pattern := range patterns {
+		_, err := filepath.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid %s pattern: %s (cannot be used with "+
+				"filepath.Match. see: https://golang.org/pkg/path/filepath/#Match)", kind, pattern)
+		}
+
+		patternTrimmed := strings.TrimSpace(pattern)
+		if patternTrimmed == "" {
+			return fmt.Errorf("invalid %s pattern: (emtpy string)", kind)
+		}
+
+		if patternTrimmed != pattern {
+			return fmt.Errorf("invalid %s pattern: %s (leading or trailing whitespace)", kind, pattern)
+		}
+
+	}
+	return nil
+}
+
+func validateInput(config Config) error {
+	if config.outDir != "" {
+		if config.inPlace {
+			return errors.New("--out-dir cannot be used with --in-place")
+		}
+		if config.outputFile != "" {
+			return errors.New("output file cannot be specified with --out-dir")
+		}
+		if !hasFileList(config) && len(config.inputFiles) <= 1 && !isDirectoryMode(config) {
+			return errors.New("--out-dir requires -r with an input directory, --files-from or several input files")
+		}
+	}
+	if config.inPlace {
+		if config.inputFile == stdio {
+			return errors.New("--in-place cannot be used when reading from stdin")
+		}
+		if isURL(config.inputFile) {
+			return errors.New("--in-place cannot be used when reading from a URL")
+		}
+		if config.outputFile != "" && config.outputFile != config.inputFile {
+			return errors.New("output file cannot be specified with --in-place")
+		}
+	}
+	if config.backup && !config.inPlace {
+		return errors.New("--backup requires --in-place")
+	}
+	if config.filesFrom != "" && config.filesFrom0 != "" {
+		return errors.New("--files-from and --files-from0 cannot be used together")
+	}
+	if hasFileList(config) {
+		if config.inputFile != "" {
+			return errors.New("input file cannot be specified with --files-from")
+		}
+		if config.outputFile != "" {
+			return errors.New("output file cannot be specified with --files-from")
+		}
+		return nil
+	}
+	if len(config.inputFiles) > 1 {
+		if config.outputFile != "" {
+			return errors.New("output file cannot be specified with several input files")
+		}
+		for _, inputFile := range config.inputFiles {
+			if inputFile == stdio {
+				return errors.New("stdin cannot be one of several input files")
+			}
+			if info, err := os.Stat(inputFile); err == nil && info.IsDir() {
+				return fmt.Errorf("input file %s is a directory", inputFile)
+			}
+		}
+		return nil
+	}
+	if config.inputFile == "" {
+		return errors.New("input file is not specified")
+	}
+	if isDirectoryMode(config) {
+		if config.outputFile != "" {
+			return errors.New("output file cannot be specified when input is a directory")
+		}
+	} else {
+		if info, err := os.Stat(config.inputFile); err == nil && info.IsDir() && config.inputFile != stdio {
+			return errors.New("input file is a directory (use -r to process directories)")
+		}
+		if config.outputFile == "" {
+			return errors.New("output file is not specified")
+		}
+	}
+	return nil
+}
+
+// expandInputGlobs replaces the input files that are glob patterns, such as
+// "notes/*.md", with the files matching them, see filepath.Glob. An input
+// file that exists is not expanded, even if its name has glob
+// metacharacters.
+func expandInputGlobs(config *Config) error {
+	inputFiles := config.inputFiles
+	if len(inputFiles) == 0 && config.inputFile != "" {
+		inputFiles = []string{config.inputFile}
+	}
+
+	var expanded []string
+	for _, inputFile := range inputFiles {
+		if !isGlob(inputFile) {
+			expanded = append(expanded, inputFile)
+			continue
+		}
+		matches, err := filepath.Glob(inputFile)
+		if err != nil {
+			return fmt.Errorf("invalid input pattern: %s: %w", inputFile, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no input file matches %s", inputFile)
+		}
+		expanded = append(expanded, matches...)
+	}
+
+	if len(expanded) > 0 {
+		config.inputFile = expanded[0]
+	}
+	config.inputFiles = nil
+	if len(expanded) > 1 {
+		config.inputFiles = expanded
+	}
+	return nil
+}
+
+// isGlob reports whether inputFile is a glob pattern rather than a file.
+func isGlob(inputFile string) bool {
+	if inputFile == stdio || isURL(inputFile) || !strings.ContainsAny(inputFile, "*?[") {
+		return false
+	}
+	_, err := os.Stat(inputFile)
+	return err != nil
+}
+
+// loadConfig layers the configuration sources, each overriding the previous
+// one: config file, dotenv files, environment variables, then flags.
+// Defaults fill whatever is left unset.
+func loadConfig() (Config, error) {
+	config := Config{
+		ignorePatterns: []string{},
+		maxFiles:       linklore.DefaultMaxFiles,
+		maxParseSize:   linklore.DefaultMaxParseSize,
+		maxLinkLength:  linklore.DefaultMaxComponentLength,
+		concurrency:    runtime.NumCPU(),
+		looseMatch:     true,
+	}
+
+	command, args := splitCommand(os.Args[1:])
+	config.check = command == commandCheck
+
+	// Each source overrides the settings of the previous ones: the config
+	// file, .env, the environment, then the flags. The ignore patterns of
+	// the last source setting them are used, with defaultIgnorePatterns
+	// added unless --no-default-ignore is set and then the patterns of the
+	// .linkloreignore files.
+	err := loadConfigFile(&config, findConfigFlag(args))
+	if err != nil {
+		return config, err
+	}
+	err = loadDotEnvVariables(&config, findEnvFiles(args))
+	if err != nil {
+		return config, err
+	}
+	err = loadEnvVariables(&config)
+	if err != nil {
+		return config, err
+	}
+	parseCommandLineFlags(&config, args)
+	applyEnvBaseURL(&config, explicitFlags())
+	err = expandInputGlobs(&config)
+	if err != nil {
+		return config, err
+	}
+	if config.autoBase && config.baseDir == "" {
+		config.baseDir, err = findVaultRoot(autoBaseStart(config))
+		if err != nil {
+			return config, err
+		}
+	}
+	setDefaultValues(&config)
+	err = loadIgnoreFiles(&config)
+	if err != nil {
+		return config, err
+	}
+
+	config.linkTemplate, err = template.New("link").Parse(config.template)
+	if err != nil {
+		return config, fmt.Errorf("invalid template: %w", err)
+	}
+	config.linkPattern, err = linklore.CompilePattern(config.syntax)
+	if err != nil {
+		return config, fmt.Errorf("invalid link syntax: %w", err)
+	}
+	config.extensions, err = parseExtMap(config.extMap)
+	if err != nil {
+		return config, fmt.Errorf("invalid ext map: %w", err)
+	}
+	config.imageExtensions, err = parseImageExts(config.imageExts)
+	if err != nil {
+		return config, fmt.Errorf("invalid image extensions: %w", err)
+	}
+	config.prefixes, err = parsePrefixMap(config.prefixMap)
+	if err != nil {
+		return config, fmt.Errorf("invalid prefix map: %w", err)
+	}
+
+	return config, nil
+}
+
+// parseExtMap parses comma-separated from:to extension pairs, e.g.
+// ".md:.html,.markdown:.html". An empty to removes the extension.
+func parseExtMap(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	extensions := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		from, to, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("%s (expect from:to, e.g. .md:.html)", pair)
+		}
+		if !strings.HasPrefix(from, ".") || (to != "" && !strings.HasPrefix(to, ".")) {
+			return nil, fmt.Errorf("%s (extensions must start with .)", pair)
+		}
+		extensions[from] = to
+	}
+	return extensions, nil
+}
+
+// parseImageExts parses comma-separated extensions, e.g. ".png,.jpg". An
+// empty value means the default ones.
+func parseImageExts(value string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	extensions := strings.Split(value, ",")
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			return nil, fmt.Errorf("%s (extensions must start with .)", ext)
+		}
+	}
+	return extensions, nil
+}
+
+// parsePrefixMap parses comma-separated dir:prefix pairs, e.g.
+// blog:/posts/,docs:/guide/. Only the first colon of a pair separates the
+// directory from the prefix, which may be a URL.
+func parsePrefixMap(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	prefixes := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		dir, prefix, found := strings.Cut(pair, ":")
+		if !found {
+			return nil, fmt.Errorf("%s (expect dir:prefix, e.g. blog:/posts/)", pair)
+		}
+		dir = strings.Trim(filepath.ToSlash(dir), "/")
+		if dir == "" {
+			return nil, fmt.Errorf("%s (the directory must not be empty, use --prefix for the other files)", pair)
+		}
+		prefixes[dir] = prefix
+	}
+	return prefixes, nil
+}
+
+// vaultMarkers are the entries, directories or files, that mark the root of
+// a vault for --auto-base.
+var vaultMarkers = []string{".obsidian", ".linklore-root"}
+
+// autoBaseStart returns the directory the search for the vault root starts
+// from: the input directory, the directory of the input file, or the current
+// directory if the input is stdin or a URL.
+func autoBaseStart(config Config) string {
+	if config.inputFile == "" || config.inputFile == stdio || isURL(config.inputFile) {
+		return "."
+	}
+	if info, err := os.Stat(config.inputFile); err == nil && info.IsDir() {
+		return config.inputFile
+	}
+	return filepath.Dir(config.inputFile)
+}
+
+// findVaultRoot returns the nearest directory holding one of vaultMarkers,
+// starting from dir and going up, or "" if there is none.
+func findVaultRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, marker := range vaultMarkers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return dir, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// ignoreFileName is the file in a base directory listing ignore patterns,
+// one per line, that are used in addition to those of the config.
+const ignoreFileName = ".linkloreignore"
+
+// loadIgnoreFiles appends the patterns in the ignore file of each base
+// directory to config.ignorePatterns. The ignore file itself is ignored.
+func loadIgnoreFiles(config *Config) error {
+	for _, baseDir := range strings.Split(config.baseDir, ",") {
+		ignoreFile := filepath.Join(baseDir, ignoreFileName)
+		patterns, err := readFileList(ignoreFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", ignoreFile, err)
+		}
+		config.ignorePatterns = append(config.ignorePatterns, ignoreFileName)
+		config.ignorePatterns = append(config.ignorePatterns, patterns...)
+	}
+	return nil
+}
+
+// applyEnvBaseURL applies LINKLORE_BASE_URL, which used to be another name
+// for LINKLORE_PREFIX. It only sets the base URL when it has a scheme and a
+// host and a prefix is set too; otherwise it still sets the prefix. It runs
+// after the flags so that a prefix given with -p counts, but it leaves the
+// settings of setFlags alone.
+func applyEnvBaseURL(config *Config, setFlags map[string]bool) {
+	if config.envBaseURL == "" {
+		return
+	}
+	baseURL, err := url.Parse(config.envBaseURL)
+	if err == nil && baseURL.IsAbs() && baseURL.Host != "" && config.prefix != "" {
+		if !setFlags["base-url"] {
+			config.baseURL = config.envBaseURL
+		}
+		return
+	}
+	if !setFlags["p"] {
+		config.prefix = config.envBaseURL
+	}
+}
+
+// explicitFlags returns the names of the flags set on the command line.
+func explicitFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+func loadEnvVariables(config *Config) error {
+	config.inputFile = getEnvOrDefault("LINKLORE_INPUT_FILE", config.inputFile)
+	config.outputFile = getEnvOrDefault("LINKLORE_OUTPUT_FILE", config.outputFile)
+	config.outDir = getEnvOrDefault("LINKLORE_OUT_DIR", config.outDir)
+	config.outSuffix = getEnvOrDefault("LINKLORE_OUT_SUFFIX", config.outSuffix)
+	config.baseDir = getEnvOrDefault("LINKLORE_BASE_DIR", config.baseDir)
+	config.autoBase = getEnvBool("LINKLORE_AUTO_BASE", config.autoBase)
+	config.prefix = getEnvOrDefault("LINKLORE_PREFIX", config.prefix)
+	config.envBaseURL = getEnvOrDefault("LINKLORE_BASE_URL", config.envBaseURL)
+	config.force = getEnvBool("LINKLORE_FORCE", config.force)
+	config.skipIdentical = getEnvBool("LINKLORE_NO_CLOBBER_IDENTICAL", config.skipIdentical)
+	config.inPlace = getEnvBool("LINKLORE_IN_PLACE", config.inPlace)
+	config.backup = getEnvBool("LINKLORE_BACKUP", config.backup)
+	config.recursive = getEnvBool("LINKLORE_RECURSIVE", config.recursive)
+	config.filesFrom = getEnvOrDefault("LINKLORE_FILES_FROM", config.filesFrom)
+	config.filesFrom0 = getEnvOrDefault("LINKLORE_FILES_FROM0", config.filesFrom0)
+	config.stripExt = getEnvBool("LINKLORE_STRIP_EXT", config.stripExt)
+	config.extMap = getEnvOrDefault("LINKLORE_EXT_MAP", config.extMap)
+	config.imageExts = getEnvOrDefault("LINKLORE_IMAGE_EXTS", config.imageExts)
+	config.prefixMap = getEnvOrDefault("LINKLORE_PREFIX_MAP", config.prefixMap)
+	config.caseInsensitive = getEnvBool("LINKLORE_CASE_INSENSITIVE", config.caseInsensitive)
+	config.looseMatch = getEnvBool("LINKLORE_LOOSE_MATCH", config.looseMatch)
+	config.followSymlinks = getEnvBool("LINKLORE_FOLLOW_SYMLINKS", config.followSymlinks)
+	config.indexTitles = getEnvBool("LINKLORE_INDEX_TITLES", config.indexTitles)
+	config.indexAliases = getEnvBool("LINKLORE_INDEX_ALIASES", config.indexAliases)
+	config.indexCache = getEnvOrDefault("LINKLORE_INDEX_CACHE", config.indexCache)
+	maxFiles, err := getEnvInt("LINKLORE_MAX_FILES", config.maxFiles)
+	if err != nil {
+		return err
+	}
+	config.maxFiles = maxFiles
+	maxParseSize, err := getEnvInt("LINKLORE_MAX_PARSE_SIZE", config.maxParseSize)
+	if err != nil {
+		return err
+	}
+	config.maxParseSize = maxParseSize
+	concurrency, err := getEnvInt("LINKLORE_CONCURRENCY", config.concurrency)
+	if err != nil {
+		return err
+	}
+	config.concurrency = concurrency
+	config.dryRun = getEnvBool("LINKLORE_DRY_RUN", config.dryRun)
+	config.diff = getEnvBool("LINKLORE_DIFF", config.diff)
+	config.extract = getEnvBool("LINKLORE_EXTRACT", config.extract)
+	config.extractFormat = getEnvOrDefault("LINKLORE_EXTRACT_FORMAT", config.extractFormat)
+	config.keepGoing = getEnvBool("LINKLORE_KEEP_GOING", config.keepGoing)
+	config.strict = getEnvBool("LINKLORE_STRICT", config.strict)
+	config.failOnDuplicate = getEnvBool("LINKLORE_FAIL_ON_DUPLICATE_ALIAS", config.failOnDuplicate)
+	config.embedMode = getEnvOrDefault("LINKLORE_EMBED_MODE", config.embedMode)
+	config.slugifyAnchors = getEnvBool("LINKLORE_SLUGIFY_ANCHORS", config.slugifyAnchors)
+	config.validateAnchors = getEnvBool("LINKLORE_VALIDATE_ANCHORS", config.validateAnchors)
+	config.refStyle = getEnvBool("LINKLORE_REF_STYLE", config.refStyle)
+	config.linkTitles = getEnvBool("LINKLORE_LINK_TITLES", config.linkTitles)
+	config.relativeLinks = getEnvBool("LINKLORE_RELATIVE_LINKS", config.relativeLinks)
+	config.anchorStyle = getEnvOrDefault("LINKLORE_ANCHOR_STYLE", config.anchorStyle)
+	config.anchorPrefix = getEnvOrDefault("LINKLORE_ANCHOR_PREFIX", config.anchorPrefix)
+	config.template = getEnvOrDefault("LINKLORE_TEMPLATE", config.template)
+	config.blockMode = getEnvOrDefault("LINKLORE_BLOCK_MODE", config.blockMode)
+	config.linkFormat = getEnvOrDefault("LINKLORE_LINK_FORMAT", config.linkFormat)
+	config.resolveNearest = getEnvBool("LINKLORE_RESOLVE_NEAREST", config.resolveNearest)
+	config.unresolvedMode = getEnvOrDefault("LINKLORE_UNRESOLVED_MODE", config.unresolvedMode)
+	config.frontmatterMode = getEnvOrDefault("LINKLORE_FRONTMATTER_MODE", config.frontmatterMode)
+	config.selfLinkMode = getEnvOrDefault("LINKLORE_SELF_LINK_MODE", config.selfLinkMode)
+	config.pathTransform = getEnvOrDefault("LINKLORE_PATH_TRANSFORM", config.pathTransform)
+	config.reportFormat = getEnvOrDefault("LINKLORE_REPORT_FORMAT", config.reportFormat)
+	config.reportFile = getEnvOrDefault("LINKLORE_REPORT", config.reportFile)
+	config.linkStats = getEnvBool("LINKLORE_LINK_STATS", config.linkStats)
+	config.linkStatsFile = getEnvOrDefault("LINKLORE_LINK_STATS_FILE", config.linkStatsFile)
+	config.pathRule = getEnvOrDefault("LINKLORE_PATH_RULE", config.pathRule)
+	config.syntax.Open = getEnvOrDefault("LINKLORE_OPEN", config.syntax.Open)
+	config.syntax.Close = getEnvOrDefault("LINKLORE_CLOSE", config.syntax.Close)
+	config.syntax.Alias = getEnvOrDefault("LINKLORE_ALIAS_SEP", config.syntax.Alias)
+	config.syntax.Anchor = getEnvOrDefault("LINKLORE_ANCHOR_SEP", config.syntax.Anchor)
+	config.syntax.Block = getEnvOrDefault("LINKLORE_BLOCK_SEP", config.syntax.Block)
+	maxLinkLength, err := getEnvInt("LINKLORE_MAX_LINK_LENGTH", config.maxLinkLength)
+	if err != nil {
+		return err
+	}
+	config.maxLinkLength = maxLinkLength
+	config.verbose = getEnvBool("LINKLORE_VERBOSE", config.verbose)
+	config.quiet = getEnvBool("LINKLORE_QUIET", config.quiet)
+	ignorePatternsRaw := getEnvOrDefault("LINKLORE_IGNORE", "")
+	if ignorePatternsRaw != "" {
+		config.ignorePatterns = strings.Split(ignorePatternsRaw, ",")
+	}
+	config.noDefaultIgnore = getEnvBool("LINKLORE_NO_DEFAULT_IGNORE", config.noDefaultIgnore)
+	config.ignoreStyle = getEnvOrDefault("LINKLORE_IGNORE_STYLE", config.ignoreStyle)
+	includePatternsRaw := getEnvOrDefault("LINKLORE_INCLUDE", "")
+	if includePatternsRaw != "" {
+		config.includePatterns = strings.Split(includePatternsRaw, ",")
+	}
+	priorityDirsRaw := getEnvOrDefault("LINKLORE_PRIORITY_DIRS", "")
+	if priorityDirsRaw != "" {
+		config.priorityDirs = strings.Split(priorityDirsRaw, ",")
+	}
+	return nil
+}
+
+// parseCommandLineFlags parses the flags in args, using the values loaded so
+// far as their defaults.
+func parseCommandLineFlags(config *Config, args []string) {
+	flag.String("config", "", "config file, YAML or TOML (default "+strings.Join(defaultConfigFiles, " or ")+")")
+	flag.Var(new(stringList), "env-file", "dotenv file, repeat to load several, the later ones overriding the earlier ones (default .env)")
+	var inputFiles stringList
+	flag.Var(&inputFiles, "i", "input file, repeat to process several files")
+	flag.StringVar(&config.outputFile, "o", config.outputFile, "output file")
+	flag.StringVar(&config.outDir, "out-dir", config.outDir, "write the outputs to this directory, mirroring their paths under the base directory")
+	flag.StringVar(&config.outSuffix, "out-suffix", config.outSuffix, "suffix replacing the extension of the input in default output file names (default "+defaultOutSuffix+")")
+	flag.StringVar(&config.baseDir, "d", config.baseDir, "base directories, comma-separated")
+	flag.BoolVar(&config.autoBase, "auto-base", config.autoBase, "use the nearest directory above the input holding "+strings.Join(vaultMarkers, " or ")+" as the base directory")
+	flag.StringVar(&config.prefix, "p", config.prefix, "prefix")
+	flag.StringVar(&config.baseURL, "base-url", config.baseURL, "scheme and host the prefix is under, e.g. https://example.com")
+	ignorePatternsRaw := flag.String("x", "", "ignore patterns, in addition to the default ones")
+	flag.BoolVar(&config.noDefaultIgnore, "no-default-ignore", config.noDefaultIgnore, "do not ignore "+strings.Join(defaultIgnorePatterns, ",")+" by default")
+	flag.StringVar(&config.ignoreStyle, "ignore-style", config.ignoreStyle, "how ignore patterns are matched: glob (file names) or gitignore (relative paths)")
+	includePatternsRaw := flag.String("I", "", "include patterns, only matching files are indexed")
+	priorityDirsRaw := flag.String("priority-dirs", "", "directories whose files win when several files share a name, highest priority first")
+	flag.BoolVar(&config.force, "f", config.force, "force overwrite output file")
+	flag.BoolVar(&config.skipIdentical, "no-clobber-identical", config.skipIdentical, "leave an existing output file untouched if the new output is identical to it")
+	flag.BoolVar(&config.inPlace, "in-place", config.inPlace, "rewrite the input file itself instead of writing an output file")
+	flag.BoolVar(&config.backup, "backup", config.backup, "with --in-place, keep a copy of each input file with a .bak suffix")
+	flag.BoolVar(&config.recursive, "r", config.recursive, "process every .md file when input is a directory")
+	flag.StringVar(&config.filesFrom, "files-from", config.filesFrom, "process the input files listed in this file, one per line (- for stdin)")
+	flag.StringVar(&config.filesFrom0, "files-from0", config.filesFrom0, "like --files-from, but the paths are separated by NUL characters, as printed by find -print0")
+	flag.BoolVar(&config.stripExt, "s", config.stripExt, "strip file extension from generated links")
+	flag.StringVar(&config.extMap, "ext-map", config.extMap, "replace extensions in generated links, e.g. .md:.html,.markdown:.html")
+	flag.StringVar(&config.imageExts, "image-exts", config.imageExts, "extensions of the files whose embeds are rendered as images (default "+strings.Join(linklore.DefaultImageExtensions, ",")+")")
+	flag.StringVar(&config.prefixMap, "prefix-map", config.prefixMap, "use another prefix for the files of some directories, e.g. blog:/posts/,docs:/guide/")
+	flag.BoolVar(&config.caseInsensitive, "c", config.caseInsensitive, "resolve links case-insensitively")
+	flag.BoolVar(&config.looseMatch, "loose-match", config.looseMatch, "retry links without their extension when they match no file (disable with --loose-match=false)")
+	flag.BoolVar(&config.followSymlinks, "follow-symlinks", config.followSymlinks, "index files in symlinked directories")
+	flag.BoolVar(&config.indexTitles, "index-titles", config.indexTitles, "also resolve Markdown files by the title set in their frontmatter")
+	flag.BoolVar(&config.indexAliases, "index-aliases", config.indexAliases, "also resolve Markdown files by the aliases listed in their frontmatter")
+	flag.StringVar(&config.indexCache, "index-cache", config.indexCache, "reuse the index saved in this file while no indexed file changes")
+	flag.BoolVar(&config.noCache, "no-cache", config.noCache, "with --index-cache, rebuild the index instead of loading it")
+	flag.IntVar(&config.maxFiles, "max-files", config.maxFiles, "maximum number of files to index, 0 for no limit")
+	flag.IntVar(&config.maxParseSize, "max-parse-size", config.maxParseSize, "size in bytes above which the headings and frontmatter of a note are not read, 0 for no limit")
+	flag.IntVar(&config.concurrency, "concurrency", config.concurrency, "number of files processed at a time with -r or --files-from, 0 for the number of CPUs")
+	flag.BoolVar(&config.dryRun, "n", config.dryRun, "report link changes without writing output")
+	flag.BoolVar(&config.diff, "diff", config.diff, "print a unified diff of each file to stdout instead of writing output, implies -n")
+	flag.BoolVar(&config.extract, "extract", config.extract, "print the links of each file and what they resolve to on stdout instead of writing output, implies -n")
+	flag.StringVar(&config.extractFormat, "extract-format", config.extractFormat, "format of the links printed by --extract: text or json")
+	flag.BoolVar(&config.keepGoing, "keep-going", config.keepGoing, "with several input files, skip the files that fail and report them at the end")
+	flag.BoolVar(&config.strict, "strict", config.strict, "exit with an error if any link cannot be resolved")
+	flag.BoolVar(&config.failOnDuplicate, "fail-on-duplicate-alias", config.failOnDuplicate, "exit with an error if different links of a file render to the same alias and target")
+	flag.StringVar(&config.embedMode, "embed-mode", config.embedMode, "how to render embeds of non-image files: link, image or inline")
+	flag.BoolVar(&config.slugifyAnchors, "slugify-anchors", config.slugifyAnchors, "convert anchors to rendered heading IDs")
+	flag.BoolVar(&config.validateAnchors, "validate-anchors", config.validateAnchors, "report anchors that do not match a heading of the target note")
+	flag.BoolVar(&config.refStyle, "ref-style", config.refStyle, "emit reference-style links, with their definitions at the end of the output")
+	flag.BoolVar(&config.linkTitles, "link-titles", config.linkTitles, "give links whose alias hides the target the target as their title")
+	flag.BoolVar(&config.relativeLinks, "relative-links", config.relativeLinks, "write link paths relative to the directory of the input file, ignoring the prefix")
+	flag.StringVar(&config.anchorStyle, "anchor-style", config.anchorStyle, "heading ID style used by -slugify-anchors: github or obsidian")
+	flag.StringVar(&config.anchorPrefix, "anchor-prefix", config.anchorPrefix, "separator between the path of a link and its anchor (default #)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [check] -i <input> [options]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "The check command reports unresolved links without writing any output.\n")
+		flag.PrintDefaults()
+	}
+
+	flag.StringVar(&config.syntax.Open, "open", config.syntax.Open, "opening delimiter of wikilinks (default [[)")
+	flag.StringVar(&config.syntax.Close, "close", config.syntax.Close, "closing delimiter of wikilinks (default ]])")
+	flag.StringVar(&config.syntax.Alias, "alias-sep", config.syntax.Alias, "separator before the alias of a wikilink (default |)")
+	flag.StringVar(&config.syntax.Anchor, "anchor-sep", config.syntax.Anchor, "separator before the anchor of a wikilink (default #)")
+	flag.StringVar(&config.syntax.Block, "block-sep", config.syntax.Block, "separator before the block reference of a wikilink (default ^)")
+	flag.IntVar(&config.maxLinkLength, "max-link-length", config.maxLinkLength, "maximum length in bytes of each part of a wikilink, 0 for no limit")
+	flag.StringVar(&config.unresolvedMode, "unresolved-mode", config.unresolvedMode, "what replaces links to missing files: keep, plain or remove")
+	flag.StringVar(&config.frontmatterMode, "frontmatter-mode", config.frontmatterMode, "whether links in the YAML frontmatter are rewritten: process or skip")
+	flag.StringVar(&config.pathTransform, "path-transform", config.pathTransform, "transform of the file paths in links: none, lower or slug")
+	flag.StringVar(&config.selfLinkMode, "self-link-mode", config.selfLinkMode, "how links from a file to itself are rewritten: keep, anchor (#heading) or warn")
+	flag.StringVar(&config.reportFormat, "report-format", config.reportFormat, "format of the report of the links that could not be rewritten: text or json")
+	flag.StringVar(&config.reportFile, "report", config.reportFile, "write a JSON record of every link processed to this file")
+	flag.BoolVar(&config.linkStats, "link-stats", config.linkStats, "print how often each target is linked and which links are repeated")
+	flag.StringVar(&config.linkStatsFile, "link-stats-file", config.linkStatsFile, "write the link stats to this file instead of stderr, implies --link-stats")
+	flag.StringVar(&config.pathRule, "path-rule", config.pathRule, "built-in rule mapping files to link paths: date or flat (default none)")
+	flag.StringVar(&config.linkFormat, "link-format", config.linkFormat, "how link targets are written: shortest, relative or absolute")
+	flag.BoolVar(&config.resolveNearest, "resolve-nearest", config.resolveNearest, "resolve a link shared by several files to the one nearest to the input file")
+	flag.StringVar(&config.blockMode, "block-mode", config.blockMode, "how to render ^block references: keep (#^block), slug (#block) or drop")
+	flag.StringVar(&config.template, "template", config.template, "Go text/template rendering each link (default "+linklore.DefaultTemplate+")")
+	flag.BoolVar(&config.verbose, "V", config.verbose, "log index and link resolution details to stderr")
+	flag.BoolVar(&config.quiet, "q", config.quiet, "do not print a message for each unresolved link")
+	flag.BoolVar(&config.dumpIndex, "dump-index", false, "print the index as JSON and exit without processing any file")
+
+	version := flag.Bool("v", false, "show version and build information")
+	flag.BoolVar(version, "version", false, "show version and build information")
+	short := flag.Bool("short", false, "with -v or --version, show only the version")
+	flag.CommandLine.Parse(args)
+
+	if len(inputFiles) > 0 {
+		config.inputFile = inputFiles[0]
+		if len(inputFiles) > 1 {
+			config.inputFiles = inputFiles
+		}
+	}
+	if *ignorePatternsRaw != "" {
+		config.ignorePatterns = strings.Split(*ignorePatternsRaw, ",")
+	}
+	if *includePatternsRaw != "" {
+		config.includePatterns = strings.Split(*includePatternsRaw, ",")
+	}
+	if *priorityDirsRaw != "" {
+		config.priorityDirs = strings.Split(*priorityDirsRaw, ",")
+	}
+
+	if *version {
+		if *short {
+			fmt.Println(Version)
+		} else {
+			info, _ := debug.ReadBuildInfo()
+			fmt.Print(versionInfo(info))
+		}
+		os.Exit(0)
+	}
+}
+
+func setDefaultValues(config *Config) {
+	if config.baseDir == "" {
+		config.baseDir = "."
+	}
+	if config.prefix == "" {
+		config.prefix = "/"
+	}
+	if config.embedMode == "" {
+		config.embedMode = linklore.EmbedModeLink
+	}
+	if config.anchorStyle == "" {
+		config.anchorStyle = linklore.AnchorStyleGitHub
+	}
+	if config.linkFormat == "" {
+		config.linkFormat = linklore.LinkFormatShortest
+	}
+	if config.unresolvedMode == "" {
+		config.unresolvedMode = linklore.UnresolvedModeKeep
+	}
+	if config.frontmatterMode == "" {
+		config.frontmatterMode = linklore.FrontmatterModeProcess
+	}
+	if config.selfLinkMode == "" {
+		config.selfLinkMode = linklore.SelfLinkModeKeep
+	}
+	if config.pathTransform == "" {
+		config.pathTransform = linklore.PathTransformNone
+	}
+	if config.reportFormat == "" {
+		config.reportFormat = reportFormatText
+	}
+	if config.linkStatsFile != "" {
+		config.linkStats = true
+	}
+	if config.diff || config.extract {
+		config.dryRun = true
+	}
+	if config.extractFormat == "" {
+		config.extractFormat = reportFormatText
+	}
+	if config.blockMode == "" {
+		config.blockMode = linklore.BlockModeKeep
+	}
+	if config.ignoreStyle == "" {
+		config.ignoreStyle = linklore.IgnoreStyleGlob
+	}
+	if config.template == "" {
+		config.template = linklore.DefaultTemplate
+		if config.refStyle {
+			config.template = linklore.RefTemplate
+		}
+		if config.linkTitles {
+			config.template = linklore.TitleTemplate
+		}
+	}
+	if config.outSuffix == "" {
+		config.outSuffix = defaultOutSuffix
+	}
+	if config.outputFile == "" && !hasFileList(*config) && len(config.inputFiles) <= 1 && !isDirectoryMode(*config) {
+		config.outputFile = outputFileFor(*config, config.inputFile)
+	}
+	if !config.noDefaultIgnore {
+		// The defaults come first and the patterns already given are not
+		// repeated, so that the patterns read the same as before.
+		var patterns []string
+		for _, pattern := range defaultIgnorePatterns {
+			if pattern == "*"+defaultOutSuffix {
+				// Ignore the outputs of this run instead, unless the suffix
+				// is a bare extension that the inputs have too.
+				if config.outSuffix == filepath.Ext(config.outSuffix) {
+					continue
+				}
+				pattern = "*" + config.outSuffix
+			}
+			if !slices.Contains(config.ignorePatterns, pattern) {
+				patterns = append(patterns, pattern)
+			}
+		}
+		config.ignorePatterns = append(patterns, config.ignorePatterns...)
+	}
+}
+
+// defaultIgnorePatterns are ignored in addition to the ignore patterns of
+// the config, unless --no-default-ignore is set. The outputs are ignored
+// with the configured suffix.
+var defaultIgnorePatterns = []string{".git", ".github", ".vscode", ".idea", ".env", "node_modules", ".obsidian", "*" + defaultOutSuffix}
+
+// defaultOutSuffix replaces the extension of an input file in the name of its
+// output file, unless --out-suffix is set.
+const defaultOutSuffix = ".out.md"
+
+// defaultOutputFile derives the output path for an input file by replacing
+// its extension with suffix, or defaultOutSuffix if it is "",
+// e.g. "foo/bar.md" -> "foo/bar.out.md". Input from stdin goes to stdout.
+func defaultOutputFile(inputFile, suffix string) string {
+	if inputFile == stdio {
+		return stdio
+	}
+	if isURL(inputFile) {
+		// Written to the current directory, named after the last element
+		// of the URL path.
+		u, _ := url.Parse(inputFile)
+		inputFile = path.Base(u.Path)
+		if inputFile == "/" || inputFile == "." {
+			inputFile = "index"
+		}
+	}
+	if suffix == "" {
+		suffix = defaultOutSuffix
+	}
+	return strings.TrimSuffix(inputFile, filepath.Ext(inputFile)) + suffix
+}
+
+// outputFileFor returns the output path for an input file: the input file
+// itself with --in-place, or its default output file.
+func outputFileFor(config Config, inputFile string) string {
+	if config.inPlace {
+		return inputFile
+	}
+	return defaultOutputFile(inputFile, config.outSuffix)
+}
+
+// outDirFile returns the output path of inputFile with --out-dir: its path
+// relative to the base directory it is in, under config.outDir. The name of
+// the input is kept, since the output directory already separates the
+// outputs from their sources.
+func outDirFile(config Config, inputFile string) (string, error) {
+	relativePath, ok := baseDirPath(config, inputFile)
+	if !ok {
+		return "", errors.New("input file is not under a base directory, required by --out-dir")
+	}
+	return filepath.Join(config.outDir, relativePath), nil
+}
+
+// baseDirPath returns the path of file relative to the first base directory
+// it is in, and whether there is one. Both are made absolute first, so that
+// a relative base directory contains an absolute path under it.
+func baseDirPath(config Config, file string) (string, bool) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	for _, baseDir := range strings.Split(config.baseDir, ",") {
+		absBase, err := filepath.Abs(baseDir)
+		if err != nil {
+			continue
+		}
+		relativePath, err := filepath.Rel(absBase, absFile)
+		if err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+			return relativePath, true
+		}
+	}
+	return "", false
+}
+
+// checkVolume returns an error if the links of inputFile are resolved or
+// written relative to it, but it is on another volume than every base
+// directory, such as D:\notes\note.md with C:\vault on Windows. No path
+// relates the two, so it could not be located in the index.
+func checkVolume(config Config, inputFile string) error {
+	if inputFile == "" || inputFile == stdio || isURL(inputFile) {
+		return nil
+	}
+	relative := config.linkFormat == linklore.LinkFormatRelative || config.relativeLinks || config.resolveNearest ||
+		config.selfLinkMode == linklore.SelfLinkModeAnchor || config.selfLinkMode == linklore.SelfLinkModeWarn
+	if !relative {
+		return nil
+	}
+	absInput, err := filepath.Abs(inputFile)
+	if err != nil {
+		return err
+	}
+	volume := filepath.VolumeName(absInput)
+	for _, baseDir := range strings.Split(config.baseDir, ",") {
+		absBase, err := filepath.Abs(baseDir)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(filepath.VolumeName(absBase), volume) {
+			return nil
+		}
+	}
+	return fmt.Errorf("input file %s is on volume %s, but no base directory is (base directories: %s)", inputFile, volume, config.baseDir)
+}
+
+// hasFileList reports whether the input files are listed in a file, with
+// --files-from or --files-from0.
+func hasFileList(config Config) bool {
+	return config.filesFrom != "" || config.filesFrom0 != ""
+}
+
+// isDirectoryMode reports whether the input should be processed as a
+// directory of notes rather than a single file.
+func isDirectoryMode(config Config) bool {
+	if !config.recursive || config.inputFile == stdio {
+		return false
+	}
+	info, err := os.Stat(config.inputFile)
+	return err == nil && info.IsDir()
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value != "" {
+		return isTruthy(value)
+	}
+	return defaultValue
+}
+
+// findConfigFlag returns the value of the --config flag in args. The config
+// file is loaded before the flags are parsed, since flags override it.
+func findConfigFlag(args []string) string {
+	values := findFlagValues(args, "config")
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// findEnvFiles returns the dotenv files to load, in order: those of the
+// --env-file flags in args, else those listed in LINKLORE_ENV_FILE. Like the
+// config file, they are found before the flags are parsed.
+func findEnvFiles(args []string) []string {
+	if envFiles := findFlagValues(args, "env-file"); len(envFiles) > 0 {
+		return envFiles
+	}
+	if value := os.Getenv("LINKLORE_ENV_FILE"); value != "" {
+		return strings.Split(value, ",")
+	}
+	return nil
+}
+
+// findFlagValues returns the value of each occurrence of the flag name in
+// args, in order.
+func findFlagValues(args []string, name string) []string {
+	var values []string
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		argName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if argName != name {
+			continue
+		}
+		if hasValue {
+			values = append(values, value)
+		} else if i+1 < len(args) {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s: expect an integer, got %q", key, value)
+	}
+	return n, nil
+}
+
+func isTruthy(value string) bool {
+	return value == "true" || value == "1"
+}
+
+// buildIndex builds the index of the base directories. With --index-cache,
+// the index is loaded from the cache file if it is still up to date, and
+// saved to it otherwise.
+func buildIndex(ctx context.Context, config Config) (linklore.Index, error) {
+	for _, inputFile := range append([]string{config.inputFile}, config.inputFiles...) {
+		if err := checkVolume(config, inputFile); err != nil {
+			return linklore.Index{}, err
+		}
+	}
+	baseDirs := strings.Split(config.baseDir, ",")
+	opts := linklore.IndexOptions{
+		CaseInsensitive: config.caseInsensitive,
+		ExactMatch:      !config.looseMatch,
+		FollowSymlinks:  config.followSymlinks,
+		MaxFiles:        config.maxFiles,
+		MaxParseSize:    int64(config.maxParseSize),
+		Include:         config.includePatterns,
+		IgnoreStyle:     config.ignoreStyle,
+		Headings:        config.validateAnchors,
+		Titles:          config.indexTitles,
+		Aliases:         config.indexAliases,
+		PriorityDirs:    config.priorityDirs,
+	}
+	if config.indexCache == "" {
+		return linklore.BuildIndexContext(ctx, baseDirs, config.ignorePatterns, opts)
+	}
+
+	if !config.noCache {
+		idx, err := readIndexCache(config.indexCache, baseDirs, config.ignorePatterns, opts)
+		if err == nil {
+			slog.Debug("loaded index cache", "path", config.indexCache)
+			return idx, nil
+		}
+		slog.Debug("rebuilding index", "cache", config.indexCache, "reason", err)
+	}
+	idx, err := linklore.BuildIndexContext(ctx, baseDirs, config.ignorePatterns, opts)
+	if err != nil {
+		return idx, err
+	}
+	var cache bytes.Buffer
+	if err := idx.WriteCache(&cache); err != nil {
+		return idx, err
+	}
+	if err := writeOutput(config.indexCache, cache.Bytes(), 0644); err != nil {
+		return idx, fmt.Errorf("failed to write index cache: %w", err)
+	}
+	return idx, nil
+}
+
+func readIndexCache(path string, baseDirs, ignore []string, opts linklore.IndexOptions) (linklore.Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return linklore.Index{}, err
+	}
+	defer file.Close()
+	return linklore.ReadCache(file, baseDirs, ignore, opts)
 }
 
-type Config struct {
-	inputFile      string
-	outputFile     string
-	ignorePatterns []string
-	baseDir        string
-	prefix         string
-	force          bool
-	index          map[string]FileInfo
-}
-
-var (
-	// Match an optional ! at the beginning.
-	// Then [[ followed by a series of characters that are not |, [, ], #, or ^ (the base link).
-	// Optionally match a | followed by a series of characters that are not |, [, ], #, or ^ (the alias).
-	// Optionally match a # followed by a series of characters that are not |, [, ], #, or ^ (the anchor).
-	// Optionally match a ^ followed by a series of characters that are not |, [, ], #, or ^ (the block).
-	// Finally match the closing ]].
-	linkComponentPattern = `([^|\[\]#^]+)`
-	linkPattern          = regexp.MustCompile(`!?` +
-		`\[\[` + linkComponentPattern +
-		`(?:\|` + linkComponentPattern + `)?` +
-		`(?:#` + linkComponentPattern + `)?` +
-		`(?:\^` + linkComponentPattern + `)?` +
-		`\]\]`)
-
-	Version = "dev"
-)
+// rewriteOptions returns the options used to rewrite each link.
+func rewriteOptions(config Config) linklore.Options {
+	opts := linklore.Options{
+		Prefix:             config.prefix,
+		BaseURL:            config.baseURL,
+		StripExt:           config.stripExt,
+		ExtMap:             config.extensions,
+		ImageExtensions:    config.imageExtensions,
+		PrefixMap:          config.prefixes,
+		EmbedMode:          config.embedMode,
+		SlugifyAnchors:     config.slugifyAnchors,
+		ValidateAnchors:    config.validateAnchors,
+		AnchorStyle:        config.anchorStyle,
+		AnchorPrefix:       config.anchorPrefix,
+		BlockMode:          config.blockMode,
+		LinkFormat:         config.linkFormat,
+		ResolveNearest:     config.resolveNearest,
+		UnresolvedMode:     config.unresolvedMode,
+		FrontmatterMode:    config.frontmatterMode,
+		SelfLinkMode:       config.selfLinkMode,
+		PathTransform:      config.pathTransform,
+		Source:             sourcePath(config),
+		RelativeLinks:      config.relativeLinks,
+		Template:           config.linkTemplate,
+		Pattern:            config.linkPattern,
+		MaxComponentLength: config.maxLinkLength,
+	}
+	if pathRule := pathRules[config.pathRule]; pathRule != nil {
+		opts.PathRewriter = pathRule(opts)
+	}
+	return opts
+}
 
-func main() {
-	config := loadConfig()
-	err := validateConfig(config)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "invalid args:", err)
-		os.Exit(1)
+// pathRules are the built-in path rewriters selected with --path-rule.
+var pathRules = map[string]func(linklore.Options) linklore.PathRewriter{
+	"date": linklore.DatePathRewriter,
+	"flat": linklore.FlatPathRewriter,
+}
+
+// sourcePath returns the input file relative to the base directory that
+// contains it, or "" if none does.
+func sourcePath(config Config) string {
+	if config.inputFile == stdio || isURL(config.inputFile) {
+		return ""
 	}
-	err = buildIndex(config)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error building index:", err)
-		os.Exit(1)
+	relativePath, _ := baseDirPath(config, config.inputFile)
+	return relativePath
+}
+
+// isIndexedFile reports whether file is one of the files in the index.
+func isIndexedFile(config Config, file string) bool {
+	relativePath, ok := baseDirPath(config, file)
+	if !ok {
+		return false
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	fileInfo, exists := config.index.LookupPath(relativePath)
+	return exists && filepath.ToSlash(fileInfo.Path) == relativePath
+}
+
+func processFile(config Config) error {
+	if !config.inPlace && config.outputFile == config.inputFile && config.inputFile != stdio {
+		return errors.New("output file is the input file (use --in-place to rewrite it)")
+	}
+	if !config.force && !config.inPlace && !config.dryRun && !config.check && config.outputFile != stdio {
+		if isIndexedFile(config, config.outputFile) {
+			return fmt.Errorf("output file %s is an indexed file of the base directory (use --force to overwrite it)", config.outputFile)
+		}
+		// With --no-clobber-identical, an existing output file is compared
+		// with the new output before it is written.
+		if _, err := os.Stat(config.outputFile); err == nil && !config.skipIdentical {
+			return errors.New("output file already exists")
+		}
 	}
 
-	err = processFile(config)
+	input, err := readInput(config.inputFile)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "error processing file:", err)
-		os.Exit(1)
+		return err
 	}
-}
+	content, hasBOM := bytes.CutPrefix(input, utf8BOM)
+	lineEnding := detectLineEnding(content)
 
-func validateConfig(config Config) error {
-	if config.inputFile == "" {
-		return errors.New("input file is not specified")
+	opts := rewriteOptions(config)
+	if config.refStyle {
+		opts.References = &linklore.References{}
 	}
-	if config.outputFile == "" {
-		return errors.New("output file is not specified")
+	var changes []linkChange
+	var ambiguousLinks int
+	slog.Debug("processing file", "input", config.inputFile, "output", config.outputFile)
+	pattern := config.linkPattern
+	if pattern == nil {
+		pattern = linklore.LinkPattern
 	}
-	if config.baseDir == "" {
-		return errors.New("base directory is not specified")
+	text := string(content)
+	skip := 0
+	if opts.FrontmatterMode == linklore.FrontmatterModeSkip {
+		skip = linklore.FrontmatterEnd(text)
 	}
-	if config.ignorePatterns == nil {
-		return errors.New("bug: ignore patterns should not be nil, expect []")
+	positions := positionTracker{content: text}
+	var output strings.Builder
+	if hasBOM {
+		output.Write(utf8BOM)
 	}
+	end := 0
+	for _, loc := range linklore.FindLinks(pattern, text) {
+		if loc[0] < skip {
+			continue
+		}
+		output.WriteString(text[end:loc[0]])
+		end = loc[1]
 
-	for _, pattern := range config.ignorePatterns {
-		_, err := filepath.Match(pattern, "")
+		match := text[loc[0]:loc[1]]
+		replacement, err := linklore.ReplaceLink(match, config.index, opts)
+		change := linkChange{match: match, replacement: replacement, err: err}
+		change.line, change.column = positions.position(loc[0])
+		linkChanges := []linkChange{change}
+		var embedErr *linklore.EmbedError
+		if errors.As(err, &embedErr) {
+			// The embed is inlined, and the links of its content that are not
+			// rewritten are reported at its position instead.
+			err, linkChanges[0].err = nil, nil
+			for _, embedded := range embeddedChanges(change, embedErr) {
+				linkChanges = append(linkChanges, embedded)
+				if errors.Is(embedded.err, linklore.ErrAmbiguousLink) {
+					ambiguousLinks++
+				}
+			}
+		}
+		for _, change := range linkChanges {
+			changes = append(changes, change)
+			if config.reportFile != "" || config.linkStats {
+				config.stats.addRecord(linkRecord(config, opts, change))
+			}
+		}
+		// Failed links are reported at the end of the run, see runStats.
+		switch {
+		case linklore.IsWarning(err):
+			output.WriteString(replacement)
+		case err != nil:
+			if errors.Is(err, linklore.ErrAmbiguousLink) {
+				ambiguousLinks++
+			}
+			if errors.Is(err, linklore.ErrLinkNotFound) {
+				// Replaced according to --unresolved-mode.
+				output.WriteString(replacement)
+			} else {
+				output.WriteString(match)
+			}
+		default:
+			// Inlined embeds bring the line endings of their own file.
+			output.WriteString(convertLineEndings(replacement, lineEnding))
+		}
+	}
+	output.WriteString(text[end:])
+	if opts.References != nil {
+		if definitions := opts.References.Definitions(); definitions != "" {
+			writeDefinitions(&output, definitions, lineEnding)
+		}
+	}
+	processedContent := output.String()
+
+	config.stats.record(config.inputFile, changes)
+	switch {
+	case config.diff:
+		diff := unifiedDiff(config.inputFile, config.outputFile, string(input), processedContent)
+		outputMu.Lock()
+		_, err = io.WriteString(os.Stdout, diff)
+		outputMu.Unlock()
+		if err != nil {
+			return err
+		}
+	case config.extract:
+		links := make([]extractedLink, len(changes))
+		for i, change := range changes {
+			links[i] = extractedLink{LinkRecord: linkRecord(config, opts, change), Status: linkStatus(change.err)}
+		}
+		outputMu.Lock()
+		err = writeExtract(os.Stdout, links, config.extractFormat)
+		outputMu.Unlock()
+		if err != nil {
+			return err
+		}
+	case config.dryRun:
+		reportChanges(config.inputFile, changes)
+	}
+	if ambiguousLinks > 0 {
+		return fmt.Errorf("%d link(s) resolve to duplicate keys", ambiguousLinks)
+	}
+	if config.failOnDuplicate {
+		if err := duplicateLinks(changes); err != nil {
+			return err
+		}
+	}
+	unchanged := false
+	if config.skipIdentical && !config.dryRun && !config.check && config.outputFile != stdio {
+		existing, err := os.ReadFile(config.outputFile)
+		switch {
+		case err == nil && string(existing) == processedContent:
+			unchanged = true
+			if !config.quiet && config.reportFormat != reportFormatJSON {
+				outputMu.Lock()
+				fmt.Fprintf(os.Stderr, "%s: unchanged\n", config.outputFile)
+				outputMu.Unlock()
+			}
+		case err == nil && !config.force && !config.inPlace:
+			return errors.New("output file already exists")
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+	}
+	if !config.dryRun && !config.check && !unchanged {
+		mode, err := outputMode(config.inputFile)
+		if err != nil {
+			return err
+		}
+		if config.backup {
+			// Written before the input is replaced, so a failed run leaves
+			// both the backup and the original in place.
+			err = writeOutput(config.inputFile+".bak", input, mode)
+			if err != nil {
+				return err
+			}
+		}
+		if config.outDir != "" {
+			err = os.MkdirAll(filepath.Dir(config.outputFile), 0755)
+			if err != nil {
+				return err
+			}
+		}
+		err = writeOutput(config.outputFile, []byte(processedContent), mode)
 		if err != nil {
-			return fmt.Errorf("invalid ignore pattern: %s (cannot be used with "+
-				"filepath.Match. see: https://golang.org/pkg/path/filepath/#Match)", pattern)
+			return err
 		}
+	}
 
-		patternTrimmed := strings.TrimSpace(pattern)
-		if patternTrimmed == "" {
-			return fmt.Errorf("invalid ignore pattern: (emtpy string)")
+	if config.strict || config.check {
+		var unresolved []string
+		for _, change := range changes {
+			if change.err != nil {
+				unresolved = append(unresolved, change.match)
+			}
 		}
+		if len(unresolved) > 0 {
+			return &unresolvedLinksError{inputFile: config.inputFile, links: unresolved}
+		}
+	}
 
-		if patternTrimmed != pattern {
-			return fmt.Errorf("invalid ignore pattern: %s (leading or trailing whitespace)", pattern)
+	return nil
+}
+
+// writeDefinitions appends the link reference definitions to output,
+// separated from the content by a blank line.
+func writeDefinitions(output *strings.Builder, definitions, lineEnding string) {
+	if content := output.String(); content != "" && !strings.HasSuffix(content, "\n") {
+		output.WriteString(lineEnding)
+	}
+	output.WriteString(lineEnding)
+	output.WriteString(convertLineEndings(definitions, lineEnding))
+}
+
+// embeddedChanges returns the changes for the links of the content inlined
+// by the embed of change that could not be rewritten, as reported by
+// embedErr. They are located at the embed, and keep the link as written
+// since their replacement is part of the embed's.
+func embeddedChanges(change linkChange, embedErr *linklore.EmbedError) []linkChange {
+	changes := make([]linkChange, 0, len(embedErr.Errs))
+	for _, err := range embedErr.Errs {
+		match := change.match
+		var linkErr *linklore.LinkError
+		if errors.As(err, &linkErr) {
+			match = linkErr.Link
 		}
+		changes = append(changes, linkChange{match: match, replacement: match, err: err, line: change.line, column: change.column})
+	}
+	return changes
+}
 
+// duplicateLinks returns an error listing the links of changes that render
+// to the same text as an earlier link written differently, e.g. [[note|Intro]]
+// and [[sub/note|Intro]], which is often a copy-paste mistake. Links that
+// are repeated as written are not reported.
+func duplicateLinks(changes []linkChange) error {
+	first := make(map[string]linkChange)
+	var duplicates []string
+	for _, change := range changes {
+		if change.err != nil && !linklore.IsWarning(change.err) {
+			continue
+		}
+		earlier, ok := first[change.replacement]
+		if !ok {
+			first[change.replacement] = change
+			continue
+		}
+		if earlier.match != change.match {
+			duplicates = append(duplicates, fmt.Sprintf("%s at %d:%d renders the same as %s at %d:%d",
+				change.match, change.line, change.column, earlier.match, earlier.line, earlier.column))
+		}
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("%d link(s) duplicate another link: %s", len(duplicates), strings.Join(duplicates, "; "))
 	}
 	return nil
 }
 
-func loadConfig() Config {
-	config := Config{
-		index:          make(map[string]FileInfo),
-		ignorePatterns: []string{},
+// outputMu serializes what files processed concurrently print, so that the
+// lines of different files do not interleave.
+var outputMu sync.Mutex
+
+// reportChanges prints every rewritten link of a dry run. The others are
+// reported at the end of the run.
+func reportChanges(inputFile string, changes []linkChange) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	for _, change := range changes {
+		if change.err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %s → %s\n", inputFile, change.line, change.column, change.match, change.replacement)
 	}
+}
 
-	loadEnvVariables(&config)
-	loadDotEnvVariables(&config)
-	parseCommandLineFlags(&config)
-	setDefaultValues(&config)
+// positionTracker converts byte offsets in content into line and column
+// numbers. Offsets must be passed in increasing order, so that the content
+// is scanned only once.
+type positionTracker struct {
+	content   string
+	offset    int
+	line      int
+	lineStart int
+}
 
-	return config
+// position returns the line and column of offset, starting at 1. The column
+// counts characters, not bytes.
+func (p *positionTracker) position(offset int) (line, column int) {
+	for ; p.offset < offset; p.offset++ {
+		if p.content[p.offset] == '\n' {
+			p.line++
+			p.lineStart = p.offset + 1
+		}
+	}
+	return p.line + 1, utf8.RuneCountInString(p.content[p.lineStart:offset]) + 1
 }
 
-func loadEnvVariables(config *Config) {
-	config.inputFile = getEnvOrDefault("LINKLORE_INPUT_FILE", "")
-	config.outputFile = getEnvOrDefault("LINKLORE_OUTPUT_FILE", "")
-	config.baseDir = getEnvOrDefault("LINKLORE_BASE_DIR", "")
-	config.prefix = getEnvOrDefault("LINKLORE_PREFIX", "")
-	config.prefix = getEnvOrDefault("LINKLORE_BASE_URL", config.prefix)
-	ignorePatternsRaw := getEnvOrDefault("LINKLORE_IGNORE", "")
-	if ignorePatternsRaw != "" {
-		config.ignorePatterns = strings.Split(ignorePatternsRaw, ",")
+// utf8BOM is the byte order mark some Windows editors put at the start of
+// UTF-8 files. It is stripped before matching links and restored on write.
+var utf8BOM = []byte("\ufeff")
+
+// detectLineEnding returns "\r\n" if most lines of content end with CRLF,
+// and "\n" otherwise.
+func detectLineEnding(content []byte) string {
+	crlf := bytes.Count(content, []byte("\r\n"))
+	if crlf > bytes.Count(content, []byte("\n"))-crlf {
+		return "\r\n"
 	}
+	return "\n"
 }
 
-func parseCommandLineFlags(config *Config) {
-	flag.StringVar(&config.inputFile, "i", "", "input file")
-	flag.StringVar(&config.outputFile, "o", "", "output file")
-	flag.StringVar(&config.baseDir, "d", "", "base directory")
-	flag.StringVar(&config.prefix, "p", "", "prefix")
-	ignorePatternsRaw := flag.String("x", "", "ignore patterns")
-	if *ignorePatternsRaw != "" {
-		config.ignorePatterns = strings.Split(*ignorePatternsRaw, ",")
+// convertLineEndings converts every line ending in s to lineEnding.
+func convertLineEndings(s, lineEnding string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if lineEnding == "\n" {
+		return s
 	}
-	flag.BoolVar(&config.force, "f", false, "force overwrite output file")
+	return strings.ReplaceAll(s, "\n", lineEnding)
+}
 
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -i <input> [options]\n", os.Args[0])
-		flag.PrintDefaults()
+func readInput(inputFile string) ([]byte, error) {
+	if inputFile == stdio {
+		return io.ReadAll(os.Stdin)
 	}
+	if isURL(inputFile) {
+		return fetchURL(inputFile)
+	}
+	return os.ReadFile(inputFile)
+}
 
-	version := flag.Bool("v", false, "show version")
-	flag.Parse()
+// fetchTimeout bounds the whole request made to read an input URL.
+const fetchTimeout = 30 * time.Second
 
-	if *version {
-		fmt.Println(Version)
-		os.Exit(0)
-	}
+// isURL reports whether inputFile is an http or https URL rather than a
+// local path.
+func isURL(inputFile string) bool {
+	return strings.HasPrefix(inputFile, "http://") || strings.HasPrefix(inputFile, "https://")
 }
 
-func setDefaultValues(config *Config) {
-	if config.baseDir == "" {
-		config.baseDir = "."
+// fetchURL returns the body of rawURL. Any status other than 200 OK is an
+// error.
+func fetchURL(rawURL string) ([]byte, error) {
+	client := http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
 	}
-	if config.prefix == "" {
-		config.prefix = "/"
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
 	}
-	if config.outputFile == "" {
-		config.outputFile = strings.TrimSuffix(config.inputFile, filepath.Ext(config.inputFile)) + ".out.md"
+	return io.ReadAll(resp.Body)
+}
+
+// outputMode returns the permission bits given to the output file: those of
+// the input file, or 0644 when reading from stdin or a URL.
+func outputMode(inputFile string) (fs.FileMode, error) {
+	if inputFile == stdio || isURL(inputFile) {
+		return 0644, nil
 	}
-	if len(config.ignorePatterns) == 0 {
-		config.ignorePatterns = []string{".git", ".github", ".vscode", ".idea", ".env", "node_modules", ".obsidian", "*.out.md"}
+	info, err := os.Stat(inputFile)
+	if err != nil {
+		return 0, err
 	}
+	return info.Mode().Perm(), nil
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value != "" {
-		return value
+// writeOutput writes content to a temporary file next to outputFile and
+// renames it into place, so that an interrupted run never leaves a
+// truncated output file behind.
+func writeOutput(outputFile string, content []byte, mode fs.FileMode) error {
+	if outputFile == stdio {
+		_, err := os.Stdout.Write(content)
+		return err
 	}
-	return defaultValue
-}
 
-func buildIndex(config Config) error {
-	var count int
+	tempFile, err := os.CreateTemp(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(content)
+	if err == nil {
+		// CreateTemp uses mode 0600.
+		err = tempFile.Chmod(mode)
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), outputFile)
+}
 
-	err := filepath.Walk(config.baseDir, func(path string, info fs.FileInfo, err error) error {
+// processDir processes every .md file under config.inputFile, writing each
+// output alongside its source, or under --out-dir. Unresolved links in
+// strict mode do not stop the walk; they are collected and returned together
+// at the end.
+func processDir(ctx context.Context, config Config) error {
+	matcher, err := linklore.NewMatcher(config.ignorePatterns, config.ignoreStyle)
+	if err != nil {
+		return err
+	}
+	// The outputs of a previous run are not inputs.
+	var outDir string
+	if config.outDir != "" {
+		outDir, err = filepath.Abs(config.outDir)
 		if err != nil {
 			return err
 		}
+	}
 
-		for _, pattern := range config.ignorePatterns {
-			matched, err := filepath.Match(pattern, info.Name())
-			if err != nil {
-				return err
-			}
-			if matched {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
+	var inputFiles []string
+	var walkErrs []error
+	err = filepath.Walk(config.inputFile, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if config.keepGoing && path != config.inputFile {
+				// An unreadable directory is skipped like a file that
+				// fails, see processFiles.
+				walkErrs = append(walkErrs, err)
 				return nil
 			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		if !info.IsDir() {
-			ext := filepath.Ext(path)
-			basename := strings.TrimSuffix(info.Name(), ext)
-
-			if entry, exists := config.index[basename]; exists {
-				context := fmt.Sprintf("path=%s", entry.path)
-				return fmt.Errorf("duplicate key: %s (context: %s)", basename, context)
-			}
-
-			relativePath, err := filepath.Rel(config.baseDir, path)
-			if err != nil {
-				return fmt.Errorf("failed to get relative path: %v", err)
-			}
-
-			config.index[basename] = FileInfo{
-				name:     info.Name(),
-				basename: basename,
-				ext:      ext,
-				path:     relativePath,
+		relativePath, err := filepath.Rel(config.inputFile, path)
+		if err != nil {
+			return err
+		}
+		ignored, err := matcher.Match(relativePath, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if ignored && path != config.inputFile {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
-
-			count++
-			if count > 10000 {
-				return errors.New("too many files, limit is 10000")
+			return nil
+		}
+		if outDir != "" && info.IsDir() {
+			if absPath, err := filepath.Abs(path); err == nil && absPath == outDir {
+				return filepath.SkipDir
 			}
 		}
 
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+		inputFiles = append(inputFiles, path)
 		return nil
 	})
-
-	return err
-}
-
-func processFile(config Config) error {
-	if !config.force {
-		if _, err := os.Stat(config.outputFile); err == nil {
-			return errors.New("output file already exists")
-		}
-	}
-
-	content, err := os.ReadFile(config.inputFile)
 	if err != nil {
 		return err
 	}
 
-	processedContent := linkPattern.ReplaceAllStringFunc(string(content), replaceLink(config))
+	return errors.Join(append(walkErrs, processFiles(ctx, config, inputFiles))...)
+}
 
-	err = os.WriteFile(config.outputFile, []byte(processedContent), 0644)
+// processFilesFrom processes every input file listed in config.filesFrom,
+// or in config.filesFrom0.
+func processFilesFrom(ctx context.Context, config Config) error {
+	var inputFiles []string
+	var err error
+	if config.filesFrom0 != "" {
+		inputFiles, err = readFileList0(config.filesFrom0)
+	} else {
+		inputFiles, err = readFileList(config.filesFrom)
+	}
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return processFiles(ctx, config, inputFiles)
 }
 
-func replaceLink(config Config) func(string) string {
-	return func(match string) string {
-		submatches := linkPattern.FindStringSubmatch(match)
+// processFiles processes each of inputFiles, writing each output to its
+// default output file. Up to config.concurrency files are processed at a
+// time against the shared index, which is only read. The stats of each file
+// are added in the order of inputFiles, so that the report does not depend
+// on the order the files finish in. Like processDir, it returns the
+// unresolved links of all files together at the end, and with --keep-going
+// the other errors of each file too, instead of stopping at the first one.
+func processFiles(ctx context.Context, config Config, inputFiles []string) error {
+	workers := config.concurrency
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(inputFiles))
 
-		base := submatches[1]
-		alias := submatches[2]
-		anchor := submatches[3]
+	// A file that fails stops the files not yet started, as when they were
+	// processed one by one, unless --keep-going is set.
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		fileInfo, exists := config.index[base]
-		if !exists {
-			// try match without ext
-			baseWithoutExt := strings.TrimSuffix(base, filepath.Ext(base))
-			fileInfo, exists = config.index[baseWithoutExt]
-			if !exists {
-				fmt.Fprintf(os.Stderr, "error: file not found for link: %s\n", match)
-				return match
+	errs := make([]error, len(inputFiles))
+	stats := make([]*runStats, len(inputFiles))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if workCtx.Err() != nil {
+					continue
+				}
+				fileConfig := config
+				fileConfig.inputFile = inputFiles[i]
+				fileConfig.outputFile = outputFileFor(config, inputFiles[i])
+				if config.outDir != "" {
+					fileConfig.outputFile, errs[i] = outDirFile(config, inputFiles[i])
+				}
+				if config.stats != nil {
+					stats[i] = &runStats{}
+					fileConfig.stats = stats[i]
+				}
+				if errs[i] == nil {
+					errs[i] = processFile(fileConfig)
+				}
+				var unresolved *unresolvedLinksError
+				if errs[i] != nil && !errors.As(errs[i], &unresolved) && !config.keepGoing {
+					cancel()
+				}
 			}
+		}()
+	}
+send:
+	for i := range inputFiles {
+		select {
+		case jobs <- i:
+		case <-workCtx.Done():
+			break send
 		}
+	}
+	close(jobs)
+	wg.Wait()
 
-		link := config.prefix + slugify(fileInfo.path)
-		if anchor != "" {
-			link += "#" + slugify(anchor)
+	for _, fileStats := range stats {
+		config.stats.merge(fileStats)
+	}
+	var fileErrs []error
+	for i, err := range errs {
+		if err == nil {
+			continue
 		}
+		var unresolved *unresolvedLinksError
+		if errors.As(err, &unresolved) {
+			fileErrs = append(fileErrs, err)
+			continue
+		}
+		err = fmt.Errorf("%s: %w", inputFiles[i], err)
+		if !config.keepGoing {
+			return err
+		}
+		fileErrs = append(fileErrs, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errors.Join(fileErrs...)
+}
 
-		if alias == "" {
-			alias = base
+// readFileList reads the newline-separated entries in listFile, or stdin if
+// it is "-". Blank lines and lines starting with # are skipped, as in .env.
+func readFileList(listFile string) ([]string, error) {
+	content, err := readInput(listFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+// readFileList0 reads the paths listed in listFile, or stdin if it is "-",
+// separated by NUL characters. Unlike readFileList, paths are kept as they
+// are, since they may contain spaces or newlines, and only empty ones are
+// skipped.
+func readFileList0(listFile string) ([]string, error) {
+	content, err := readInput(listFile)
+	if err != nil {
+		return nil, err
+	}
 
-		return fmt.Sprintf("[%s](%s)", alias, link)
+	var paths []string
+	for _, path := range strings.Split(string(content), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
 	}
+	return paths, nil
 }
 
-func slugify(s string) string {
-	// TODO: permalink YAML key,
-	// see https://help.obsidian.md/Obsidian+Publish/Publish+and+unpublish+notes#Permalinks
-	// TODO: support custom slug rules / ruleset
+// indexDump is the JSON document printed by --dump-index.
+type indexDump struct {
+	Files      []linklore.FileInfo `json:"files"`
+	Duplicates map[string][]string `json:"duplicates"`
+}
 
-	// obsidian slug rules
-	// Example: "Bézout's Identity" -> "Bézout's-Identity"
+// dumpIndex writes the files of index, sorted by basename and then by path,
+// and the paths sharing each duplicate key, sorted, so that dumps of the
+// same vault can be diffed.
+func dumpIndex(w io.Writer, index linklore.Index) error {
+	dump := indexDump{
+		Files:      index.Files(),
+		Duplicates: make(map[string][]string),
+	}
+	slices.SortStableFunc(dump.Files, func(a, b linklore.FileInfo) int {
+		return strings.Compare(a.Basename, b.Basename)
+	})
+	for _, key := range index.DuplicateKeys() {
+		paths := slices.Clone(index.Duplicates(key))
+		slices.Sort(paths)
+		dump.Duplicates[key] = paths
+	}
 
-	// 1. replace space with -
-	slug := strings.ReplaceAll(s, " ", "-")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
 
-	// 2. replace multiple - with single -
-	slug = strings.ReplaceAll(slug, "--", "-")
+// reportDuplicates prints every key shared by several files, sorted by key.
+func reportDuplicates(config Config) {
+	for _, key := range config.index.DuplicateKeys() {
+		fmt.Fprintf(os.Stderr, "warning: duplicate key: %s (paths: %s)\n", key, strings.Join(config.index.Duplicates(key), ", "))
+	}
+}
 
-	// 3. remove leading and trailing -
-	slug = strings.Trim(slug, "-")
+// reportUnparsed prints every Markdown file whose headings and frontmatter
+// were not read, since links to it cannot be checked against them.
+func reportUnparsed(config Config) {
+	for _, fileInfo := range config.index.Files() {
+		if fileInfo.Unparsed != "" {
+			fmt.Fprintf(os.Stderr, "warning: headings and frontmatter not read: %s (%s)\n", fileInfo.Path, fileInfo.Unparsed)
+		}
+	}
+}
 
-	// 4. encodeURIComponent
-	// slug = url.PathEscape(slug)
+// defaultEnvFile is the dotenv file loaded when no other is given. Unlike
+// the files given with --env-file, it may be missing.
+const defaultEnvFile = ".env"
 
-	// remove .md suffix
-	slug = strings.TrimSuffix(slug, ".md")
-	return slug
+// loadDotEnvVariables loads envFiles in order, or defaultEnvFile if there is
+// none, each overriding the settings of the previous ones.
+func loadDotEnvVariables(config *Config, envFiles []string) error {
+	if len(envFiles) == 0 {
+		err := loadDotEnvFile(config, defaultEnvFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, path := range envFiles {
+		if err := loadDotEnvFile(config, path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func loadDotEnvVariables(config *Config) {
-	envFile, err := os.Open(".env")
+func loadDotEnvFile(config *Config, path string) error {
+	envFile, err := os.Open(path)
 	if err != nil {
-		return
+		return err
 	}
 
 	defer envFile.Close()
@@ -330,22 +2161,205 @@ func loadDotEnvVariables(config *Config) {
 			continue
 		}
 
-		key, value := parts[0], parts[1]
+		key, value := strings.TrimSpace(parts[0]), parseDotEnvValue(parts[1])
 		switch strings.ToUpper(key) {
 		case "LINKLORE_INPUT_FILE":
 			config.inputFile = value
 		case "LINKLORE_OUTPUT_FILE":
 			config.outputFile = value
+		case "LINKLORE_OUT_DIR":
+			config.outDir = value
+		case "LINKLORE_OUT_SUFFIX":
+			config.outSuffix = value
 		case "LINKLORE_BASE_DIR":
 			config.baseDir = value
+		case "LINKLORE_AUTO_BASE":
+			config.autoBase = isTruthy(value)
 		case "LINKLORE_PREFIX":
 			config.prefix = value
 		case "LINKLORE_BASE_URL":
-			config.prefix = value
+			config.envBaseURL = value
 		case "LINKLORE_FORCE":
-			config.force = value == "true" || value == "1"
+			config.force = isTruthy(value)
+		case "LINKLORE_NO_CLOBBER_IDENTICAL":
+			config.skipIdentical = isTruthy(value)
+		case "LINKLORE_IN_PLACE":
+			config.inPlace = isTruthy(value)
+		case "LINKLORE_BACKUP":
+			config.backup = isTruthy(value)
+		case "LINKLORE_RECURSIVE":
+			config.recursive = isTruthy(value)
+		case "LINKLORE_FILES_FROM":
+			config.filesFrom = value
+		case "LINKLORE_FILES_FROM0":
+			config.filesFrom0 = value
+		case "LINKLORE_STRIP_EXT":
+			config.stripExt = isTruthy(value)
+		case "LINKLORE_EXT_MAP":
+			config.extMap = value
+		case "LINKLORE_IMAGE_EXTS":
+			config.imageExts = value
+		case "LINKLORE_PREFIX_MAP":
+			config.prefixMap = value
+		case "LINKLORE_CASE_INSENSITIVE":
+			config.caseInsensitive = isTruthy(value)
+		case "LINKLORE_LOOSE_MATCH":
+			config.looseMatch = isTruthy(value)
+		case "LINKLORE_FOLLOW_SYMLINKS":
+			config.followSymlinks = isTruthy(value)
+		case "LINKLORE_INDEX_TITLES":
+			config.indexTitles = isTruthy(value)
+		case "LINKLORE_INDEX_ALIASES":
+			config.indexAliases = isTruthy(value)
+		case "LINKLORE_INDEX_CACHE":
+			config.indexCache = value
+		case "LINKLORE_MAX_FILES":
+			config.maxFiles, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s: expect an integer, got %q", path, key, value)
+			}
+		case "LINKLORE_MAX_PARSE_SIZE":
+			config.maxParseSize, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s: expect an integer, got %q", path, key, value)
+			}
+		case "LINKLORE_CONCURRENCY":
+			config.concurrency, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s: expect an integer, got %q", path, key, value)
+			}
+		case "LINKLORE_DRY_RUN":
+			config.dryRun = isTruthy(value)
+		case "LINKLORE_DIFF":
+			config.diff = isTruthy(value)
+		case "LINKLORE_EXTRACT":
+			config.extract = isTruthy(value)
+		case "LINKLORE_EXTRACT_FORMAT":
+			config.extractFormat = value
+		case "LINKLORE_KEEP_GOING":
+			config.keepGoing = isTruthy(value)
+		case "LINKLORE_STRICT":
+			config.strict = isTruthy(value)
+		case "LINKLORE_FAIL_ON_DUPLICATE_ALIAS":
+			config.failOnDuplicate = isTruthy(value)
+		case "LINKLORE_EMBED_MODE":
+			config.embedMode = value
+		case "LINKLORE_SLUGIFY_ANCHORS":
+			config.slugifyAnchors = isTruthy(value)
+		case "LINKLORE_VALIDATE_ANCHORS":
+			config.validateAnchors = isTruthy(value)
+		case "LINKLORE_REF_STYLE":
+			config.refStyle = isTruthy(value)
+		case "LINKLORE_LINK_TITLES":
+			config.linkTitles = isTruthy(value)
+		case "LINKLORE_RELATIVE_LINKS":
+			config.relativeLinks = isTruthy(value)
+		case "LINKLORE_ANCHOR_STYLE":
+			config.anchorStyle = value
+		case "LINKLORE_ANCHOR_PREFIX":
+			config.anchorPrefix = value
+		case "LINKLORE_TEMPLATE":
+			config.template = value
+		case "LINKLORE_LINK_FORMAT":
+			config.linkFormat = value
+		case "LINKLORE_RESOLVE_NEAREST":
+			config.resolveNearest = isTruthy(value)
+		case "LINKLORE_UNRESOLVED_MODE":
+			config.unresolvedMode = value
+		case "LINKLORE_FRONTMATTER_MODE":
+			config.frontmatterMode = value
+		case "LINKLORE_SELF_LINK_MODE":
+			config.selfLinkMode = value
+		case "LINKLORE_PATH_TRANSFORM":
+			config.pathTransform = value
+		case "LINKLORE_REPORT_FORMAT":
+			config.reportFormat = value
+		case "LINKLORE_REPORT":
+			config.reportFile = value
+		case "LINKLORE_LINK_STATS":
+			config.linkStats = isTruthy(value)
+		case "LINKLORE_LINK_STATS_FILE":
+			config.linkStatsFile = value
+		case "LINKLORE_PATH_RULE":
+			config.pathRule = value
+		case "LINKLORE_OPEN":
+			config.syntax.Open = value
+		case "LINKLORE_CLOSE":
+			config.syntax.Close = value
+		case "LINKLORE_ALIAS_SEP":
+			config.syntax.Alias = value
+		case "LINKLORE_ANCHOR_SEP":
+			config.syntax.Anchor = value
+		case "LINKLORE_BLOCK_SEP":
+			config.syntax.Block = value
+		case "LINKLORE_MAX_LINK_LENGTH":
+			config.maxLinkLength, err = strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s: expect an integer, got %q", path, key, value)
+			}
+		case "LINKLORE_BLOCK_MODE":
+			config.blockMode = value
+		case "LINKLORE_VERBOSE":
+			config.verbose = isTruthy(value)
+		case "LINKLORE_QUIET":
+			config.quiet = isTruthy(value)
 		case "LINKLORE_IGNORE":
 			config.ignorePatterns = strings.Split(value, ",")
+		case "LINKLORE_NO_DEFAULT_IGNORE":
+			config.noDefaultIgnore = isTruthy(value)
+		case "LINKLORE_IGNORE_STYLE":
+			config.ignoreStyle = value
+		case "LINKLORE_INCLUDE":
+			config.includePatterns = strings.Split(value, ",")
+		case "LINKLORE_PRIORITY_DIRS":
+			config.priorityDirs = strings.Split(value, ",")
+		}
+	}
+	return envScanner.Err()
+}
+
+// parseDotEnvValue returns the value of a dotenv line from the text after
+// "=". A value in double quotes may contain the escapes \n, \t, \r, \" and
+// \\, one in single quotes is taken literally, and the text after the
+// closing quote is ignored. A value missing its closing quote is kept as
+// written, only trimmed. An unquoted value ends at a " #" comment and is
+// trimmed.
+func parseDotEnvValue(raw string) string {
+	value := strings.TrimSpace(raw)
+	if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+		quote := value[0]
+		var unquoted strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch {
+			case c == quote:
+				return unquoted.String()
+			case c == '\\' && quote == '"' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					unquoted.WriteByte('\n')
+				case 't':
+					unquoted.WriteByte('\t')
+				case 'r':
+					unquoted.WriteByte('\r')
+				case '"', '\\':
+					unquoted.WriteByte(value[i])
+				default:
+					unquoted.WriteByte('\\')
+					unquoted.WriteByte(value[i])
+				}
+			default:
+				unquoted.WriteByte(c)
+			}
+		}
+		return value
+	}
+
+	for i := 1; i < len(raw); i++ {
+		if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+			return strings.TrimSpace(raw[:i])
 		}
 	}
+	return value
 }
@@ -1,116 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
 	"testing"
-)
-
-func TestLinkPattern(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-		base     string
-		alias    string
-		anchor   string
-	}{
-		{input: "[[Link]]", expected: true, base: "Link"},
-		{input: "![[Link]]", expected: true, base: "Link"},
-		{input: "![[Link#Anchor]]", expected: true, base: "Link", anchor: "Anchor"},
-		{input: "![[Link^Block]]", expected: true, base: "Link"},
-		{input: "[[Link|Alias]]", expected: true, base: "Link", alias: "Alias"},
-		{input: "[[Link|Alias^Block]]", expected: true, base: "Link", alias: "Alias"},
-		{input: "[[Link|Alias^Block^Extra]]", expected: false, base: "Link", alias: "Alias"},
-		{input: "[[Link|Alias^#Anchor]]", expected: false},
-		{input: "[[Link|Alias^#Anchor^Extra]]", expected: false},
-		{input: "[[Link|Alias^Extra#Anchor]]", expected: false},
-		{input: "[[Link|Alias^Extra#Anchor^Extra]]", expected: false},
-		{input: "[Link]", expected: false},
-		{input: "[[Link", expected: false},
-		{input: "Link]]", expected: false},
-	}
-
-	for _, test := range tests {
-		matched := linkPattern.MatchString(test.input)
-		if matched != test.expected {
-			t.Errorf("Input: %s, Expected: %v, Got: %v", test.input, test.expected, matched)
-		}
-		match := linkPattern.FindString(test.input)
-
-		if !matched {
-			continue
-		}
-
-		submatches := linkPattern.FindStringSubmatch(match)
-
-		base := submatches[1]
-		alias := submatches[2]
-		anchor := submatches[3]
-
-		if base != test.base {
-			t.Errorf("Input: %s, Expected base: %s, Got: %s", test.input, test.base, base)
-		}
-
-		if alias != test.alias {
-			t.Errorf("Input: %s, Expected alias: %s, Got: %s", test.input, test.alias, alias)
-		}
-
-		if anchor != test.anchor {
-			t.Errorf("Input: %s, Expected anchor: %s, Got: %s", test.input, test.anchor, anchor)
-		}
-	}
-}
-
-func TestBuildIndex(t *testing.T) {
-	tempDir := createTempDir(t)
-	defer os.RemoveAll(tempDir)
-
-	// 创建测试文件
-	createTestFile(tempDir, "file1.txt", "")
-	createTestFile(tempDir, "file2.txt", "")
-
-	config := Config{
-		baseDir: tempDir,
-		index:   make(map[string]FileInfo),
-	}
-
-	err := buildIndex(config)
-	if err != nil {
-		t.Errorf("buildIndex failed: %v", err)
-	}
-
-	expectedIndex := map[string]FileInfo{
-		"file1": {
-			name:     "file1.txt",
-			basename: "file1",
-			ext:      ".txt",
-			path:     "file1.txt",
-		},
-		"file2": {
-			name:     "file2.txt",
-			basename: "file2",
-			ext:      ".txt",
-			path:     "file2.txt",
-		},
-	}
-
-	if len(config.index) != len(expectedIndex) {
-		t.Errorf("buildIndex failed: incorrect index size, got %d, want %d", len(config.index), len(expectedIndex))
-	}
+	"time"
 
-	for key, expectedFileInfo := range expectedIndex {
-		fileInfo, exists := config.index[key]
-		if !exists {
-			t.Errorf("buildIndex failed: missing key %s in index", key)
-			continue
-		}
-
-		if fileInfo != expectedFileInfo {
-			t.Errorf("buildIndex failed: incorrect FileInfo for key %s, got %+v, want %+v", key, fileInfo, expectedFileInfo)
-		}
-	}
-}
+	"github.com/pluveto/linklore/linklore"
+)
 
 func TestProcessFile(t *testing.T) {
 	tempDir := createTempDir(t)
@@ -127,20 +38,20 @@ func TestProcessFile(t *testing.T) {
 		baseDir:    tempDir,
 		prefix:     "/",
 		force:      true,
-		index: map[string]FileInfo{
-			"file1": {
-				name:     "file1.txt",
-				basename: "file1",
-				ext:      ".txt",
-				path:     "file1.txt",
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
 			},
-			"file2": {
-				name:     "file2.txt",
-				basename: "file2",
-				ext:      ".txt",
-				path:     "file2.txt",
+			linklore.FileInfo{
+				Name:     "file2.txt",
+				Basename: "file2",
+				Ext:      ".txt",
+				Path:     "file2.txt",
 			},
-		},
+		),
 	}
 
 	err := processFile(config)
@@ -176,20 +87,20 @@ func TestProcessFileNested(t *testing.T) {
 		baseDir:    nestedDir,
 		prefix:     "/nested/",
 		force:      true,
-		index: map[string]FileInfo{
-			"file1": {
-				name:     "file1.txt",
-				basename: "file1",
-				ext:      ".txt",
-				path:     "file1.txt",
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
 			},
-			"file2": {
-				name:     "file2.txt",
-				basename: "file2",
-				ext:      ".txt",
-				path:     "file2.txt",
+			linklore.FileInfo{
+				Name:     "file2.txt",
+				Basename: "file2",
+				Ext:      ".txt",
+				Path:     "file2.txt",
 			},
-		},
+		),
 	}
 
 	err := processFile(config)
@@ -208,18 +119,2215 @@ func TestProcessFileNested(t *testing.T) {
 	}
 }
 
-func createTempDir(t *testing.T) string {
-	tempDir, err := os.MkdirTemp("", "linklore_test")
+func TestProcessFileLineEndings(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "embed.md", "first\nsecond\n")
+	createTestFile(tempDir, "crlf.txt", "[[embed]]\r\n![[embed]]\r\nend\n")
+	createTestFile(tempDir, "bom.txt", "\ufeff[[embed]]\n")
+
+	config := Config{
+		baseDir:        tempDir,
+		prefix:         "/",
+		embedMode:      "inline",
+		ignorePatterns: []string{"*.txt"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
 	if err != nil {
-		t.Fatalf("createTempDir failed: %v", err)
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		inputFile string
+		expected  string
+	}{
+		{inputFile: "crlf.txt", expected: "[embed](/embed)\r\nfirst\r\nsecond\r\nend\n"},
+		{inputFile: "bom.txt", expected: "\ufeff[embed](/embed)\n"},
+	}
+	for _, test := range tests {
+		config.inputFile = filepath.Join(tempDir, test.inputFile)
+		config.outputFile = filepath.Join(tempDir, test.inputFile+".out")
+		err = processFile(config)
+		if err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+
+		outputContent, err := os.ReadFile(config.outputFile)
+		if err != nil {
+			t.Errorf("processFile failed: unable to read output file: %v", err)
+		}
+		if string(outputContent) != test.expected {
+			t.Errorf("processFile failed: incorrect output content for %s, got %q, want %q", test.inputFile, outputContent, test.expected)
+		}
 	}
-	return tempDir
 }
 
-func createTestFile(dir, filename, content string) {
-	filePath := filepath.Join(dir, filename)
-	err := os.WriteFile(filePath, []byte(content), 0644)
+func TestProcessFileStrictEmbed(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "embed.md", "See [[missing]] and [[embed]].\n")
+	createTestFile(tempDir, "input.txt", "Intro\n![[embed]]\n")
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "input.txt"),
+		outputFile:     filepath.Join(tempDir, "output.txt"),
+		prefix:         "/",
+		embedMode:      "inline",
+		strict:         true,
+		ignorePatterns: []string{"*.txt"},
+		stats:          &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
 	if err != nil {
-		panic(err)
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processFile(config)
+	var unresolved *unresolvedLinksError
+	if !errors.As(err, &unresolved) || !reflect.DeepEqual(unresolved.links, []string{"[[missing]]"}) {
+		t.Fatalf("processFile failed: expected the broken link of the embed to be unresolved, got %v", err)
+	}
+	if content, _ := os.ReadFile(config.outputFile); string(content) != "Intro\nSee [[missing]] and [embed](/embed).\n" {
+		t.Errorf("processFile failed: incorrect output content, got %q", content)
+	}
+	if len(config.stats.issues) != 1 || config.stats.issues[0].Line != 2 || config.stats.issues[0].Reason != reasonNotFound {
+		t.Errorf("processFile failed: expected one issue at the embed, got %+v", config.stats.issues)
+	}
+}
+
+func TestProcessFileCode(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	input := "[[a]]\n\n```\n[[a]] [[missing]]\n```\n\n`[[a]]` and [[a]]\n"
+	createTestFile(tempDir, "input.txt", input)
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "input.txt"),
+		outputFile:     filepath.Join(tempDir, "output.txt"),
+		prefix:         "/",
+		strict:         true,
+		ignorePatterns: []string{"*.txt"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Fatalf("processFile failed: unable to read output file: %v", err)
+	}
+	expected := "[a](/a)\n\n```\n[[a]] [[missing]]\n```\n\n`[[a]]` and [a](/a)\n"
+	if string(outputContent) != expected {
+		t.Errorf("processFile failed: got %q, want %q", outputContent, expected)
+	}
+}
+
+func TestProcessFileFrontmatterMode(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	input := "---\nup: \"[[a]]\"\n---\n[[a]]\n"
+	createTestFile(tempDir, "input.txt", input)
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{mode: linklore.FrontmatterModeProcess, expected: "---\nup: \"[a](/a)\"\n---\n[a](/a)\n"},
+		{mode: linklore.FrontmatterModeSkip, expected: "---\nup: \"[[a]]\"\n---\n[a](/a)\n"},
+	}
+	for _, test := range tests {
+		config := Config{
+			baseDir:         tempDir,
+			inputFile:       filepath.Join(tempDir, "input.txt"),
+			outputFile:      filepath.Join(tempDir, test.mode+".txt"),
+			prefix:          "/",
+			frontmatterMode: test.mode,
+			ignorePatterns:  []string{"*.txt"},
+		}
+		var err error
+		config.index, err = buildIndex(context.Background(), config)
+		if err != nil {
+			t.Fatalf("buildIndex failed: %v", err)
+		}
+		if err := processFile(config); err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+
+		outputContent, err := os.ReadFile(config.outputFile)
+		if err != nil {
+			t.Fatalf("processFile failed: unable to read output file: %v", err)
+		}
+		if string(outputContent) != test.expected {
+			t.Errorf("processFile failed for mode %s: got %q, want %q", test.mode, outputContent, test.expected)
+		}
+	}
+}
+
+func TestProcessFileIndexedOutput(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[b]]")
+	createTestFile(tempDir, "b.md", "b")
+
+	config := Config{
+		baseDir:    tempDir,
+		inputFile:  filepath.Join(tempDir, "a.md"),
+		outputFile: filepath.Join(tempDir, "b.md"),
+		prefix:     "/",
+		stats:      &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processFile(config)
+	if err == nil || !strings.Contains(err.Error(), "indexed file") {
+		t.Errorf("processFile failed: expected error for an indexed output file, got %v", err)
+	}
+	if content, _ := os.ReadFile(config.outputFile); string(content) != "b" {
+		t.Errorf("processFile failed: indexed output file was overwritten")
+	}
+
+	config.force = true
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed with --force: %v", err)
+	}
+	if content, _ := os.ReadFile(config.outputFile); string(content) != "[b](/b)" {
+		t.Errorf("processFile failed with --force: got %s", content)
+	}
+}
+
+func TestProcessFileFailOnDuplicate(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(tempDir, "input.md", "[[note|Intro]] [[note|Intro]]\n[[note.md|Intro]] [[note|Other]]\n")
+
+	config := Config{
+		baseDir:    tempDir,
+		inputFile:  filepath.Join(tempDir, "input.md"),
+		outputFile: filepath.Join(tempDir, "output.md"),
+		prefix:     "/",
+		stats:      &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed without --fail-on-duplicate-alias: %v", err)
+	}
+	os.Remove(config.outputFile)
+
+	config.failOnDuplicate = true
+	err = processFile(config)
+	if err == nil || !strings.Contains(err.Error(), "[[note.md|Intro]] at 2:1 renders the same as [[note|Intro]] at 1:1") {
+		t.Errorf("processFile failed: expected a duplicate link error, got %v", err)
+	}
+	if strings.Count(err.Error(), "renders the same") != 1 {
+		t.Errorf("processFile failed: links repeated as written reported as duplicates: %v", err)
+	}
+	if _, err := os.Stat(config.outputFile); err == nil {
+		t.Errorf("processFile failed: output written despite duplicate links")
+	}
+}
+
+func TestProcessFileSelfLinkMode(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "note.md", "# Intro\n[[note#Intro]] [[a]]\n")
+
+	tests := []struct {
+		mode     string
+		expected string
+		issues   int
+	}{
+		{mode: linklore.SelfLinkModeKeep, expected: "# Intro\n[note](/note#Intro) [a](/a)\n"},
+		{mode: linklore.SelfLinkModeAnchor, expected: "# Intro\n[note](#Intro) [a](/a)\n"},
+		{mode: linklore.SelfLinkModeWarn, expected: "# Intro\n[note](/note#Intro) [a](/a)\n", issues: 1},
+	}
+	for _, test := range tests {
+		config := Config{
+			baseDir:        tempDir,
+			inputFile:      filepath.Join(tempDir, "note.md"),
+			outputFile:     filepath.Join(tempDir, test.mode+".txt"),
+			prefix:         "/",
+			stripExt:       true,
+			selfLinkMode:   test.mode,
+			ignorePatterns: []string{"*.txt"},
+			stats:          &runStats{},
+		}
+		var err error
+		config.index, err = buildIndex(context.Background(), config)
+		if err != nil {
+			t.Fatalf("buildIndex failed: %v", err)
+		}
+		if err := processFile(config); err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+
+		outputContent, err := os.ReadFile(config.outputFile)
+		if err != nil {
+			t.Fatalf("processFile failed: unable to read output file: %v", err)
+		}
+		if string(outputContent) != test.expected {
+			t.Errorf("processFile failed for mode %s: got %q, want %q", test.mode, outputContent, test.expected)
+		}
+		if len(config.stats.issues) != test.issues || config.stats.rewritten != 2 {
+			t.Errorf("processFile failed for mode %s: got %d rewritten and issues %+v", test.mode, config.stats.rewritten, config.stats.issues)
+		}
+		for _, issue := range config.stats.issues {
+			if issue.Reason != reasonSelfLink {
+				t.Errorf("processFile failed for mode %s: got reason %s, want %s", test.mode, issue.Reason, reasonSelfLink)
+			}
+		}
+	}
+}
+
+func TestProcessFileRelativeLinks(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	os.MkdirAll(filepath.Join(tempDir, "sub", "deep"), 0755)
+	createTestFile(tempDir, "top.md", "")
+	createTestFile(filepath.Join(tempDir, "sub"), "sibling.md", "")
+	createTestFile(filepath.Join(tempDir, "sub", "deep"), "child.md", "")
+	createTestFile(filepath.Join(tempDir, "sub"), "input.txt", "[[top]] [[sibling]] [[child]]")
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "sub", "input.txt"),
+		outputFile:     filepath.Join(tempDir, "output.txt"),
+		prefix:         "/docs",
+		relativeLinks:  true,
+		ignorePatterns: []string{"*.txt"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Fatalf("processFile failed: unable to read output file: %v", err)
+	}
+	expected := "[top](../top) [sibling](sibling) [child](deep/child)"
+	if string(outputContent) != expected {
+		t.Errorf("processFile failed: got %q, want %q", outputContent, expected)
+	}
+}
+
+func TestProcessFileRefStyle(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "b.md", "")
+	createTestFile(tempDir, "plain.txt", "[[a]] [[b]] [[a|A]]")
+	createTestFile(tempDir, "crlf.txt", "[[b]]\r\n")
+	createTestFile(tempDir, "none.txt", "no links\n")
+
+	config := Config{
+		baseDir:        tempDir,
+		prefix:         "/",
+		refStyle:       true,
+		ignorePatterns: []string{"*.txt"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	tests := []struct {
+		inputFile string
+		expected  string
+	}{
+		{inputFile: "plain.txt", expected: "[a][1] [b][2] [A][1]\n\n[1]: /a\n[2]: /b\n"},
+		{inputFile: "crlf.txt", expected: "[b][1]\r\n\r\n[1]: /b\r\n"},
+		{inputFile: "none.txt", expected: "no links\n"},
+	}
+	for _, test := range tests {
+		config.inputFile = filepath.Join(tempDir, test.inputFile)
+		config.outputFile = filepath.Join(tempDir, test.inputFile+".out")
+		if err := processFile(config); err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+		outputContent, err := os.ReadFile(config.outputFile)
+		if err != nil {
+			t.Fatalf("processFile failed: unable to read output file: %v", err)
+		}
+		if string(outputContent) != test.expected {
+			t.Errorf("processFile failed: incorrect output content for %s, got %q, want %q", test.inputFile, outputContent, test.expected)
+		}
+	}
+}
+
+func TestProcessFileInPlace(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "[[file1]]")
+	inputFile := filepath.Join(tempDir, "note.md")
+
+	config := Config{
+		inputFile: inputFile,
+		prefix:    "/",
+		inPlace:   true,
+		backup:    true,
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+	setDefaultValues(&config)
+	if config.outputFile != inputFile {
+		t.Fatalf("setDefaultValues failed: expected output file %s with --in-place, got %s", inputFile, config.outputFile)
+	}
+
+	err := processFile(config)
+	if err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	expectedContents := map[string]string{
+		inputFile:          "[file1](/file1.txt)",
+		inputFile + ".bak": "[[file1]]",
+	}
+	for path, expected := range expectedContents {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processFile failed: unable to read %s: %v", path, err)
+			continue
+		}
+		if string(content) != expected {
+			t.Errorf("processFile failed: incorrect content for %s, got %s, want %s", path, content, expected)
+		}
+	}
+
+	invalidConfigs := []Config{
+		{inputFile: stdio, inPlace: true},
+		{inputFile: inputFile, outputFile: filepath.Join(tempDir, "other.md"), inPlace: true},
+		{inputFile: inputFile, outputFile: inputFile, backup: true},
+	}
+	for _, invalid := range invalidConfigs {
+		if err := validateInput(invalid); err == nil {
+			t.Errorf("validateInput failed: expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestProcessFileSkipIdentical(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "note.md", "[[file1]]")
+	createTestFile(tempDir, "file1.md", "")
+	outputFile := filepath.Join(tempDir, "note.out.md")
+	createTestFile(tempDir, "note.out.md", "[file1](/file1)")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(outputFile, old, old)
+
+	config := Config{
+		baseDir:       tempDir,
+		inputFile:     filepath.Join(tempDir, "note.md"),
+		outputFile:    outputFile,
+		prefix:        "/",
+		skipIdentical: true,
+		quiet:         true,
+		index:         newTestIndex(linklore.FileInfo{Name: "file1.md", Basename: "file1", Ext: ".md", Path: "file1.md"}),
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed with an identical output file: %v", err)
+	}
+	if info, err := os.Stat(outputFile); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("processFile failed: identical output file was rewritten")
+	}
+
+	createTestFile(tempDir, "note.out.md", "stale")
+	if err := processFile(config); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("processFile failed: expected error for a different output file without --force, got %v", err)
+	}
+	config.force = true
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed with --force: %v", err)
+	}
+	if content, _ := os.ReadFile(outputFile); string(content) != "[file1](/file1)" {
+		t.Errorf("processFile failed with --force: got %s", content)
+	}
+}
+
+func TestPositionTracker(t *testing.T) {
+	content := "[[a]] x\nline two [[b]]\n\n中文 [[c]]"
+	positions := positionTracker{content: content}
+
+	tests := []struct {
+		match  string
+		line   int
+		column int
+	}{
+		{match: "[[a]]", line: 1, column: 1},
+		{match: "[[b]]", line: 2, column: 10},
+		{match: "[[c]]", line: 4, column: 4},
+	}
+	for _, test := range tests {
+		line, column := positions.position(strings.Index(content, test.match))
+		if line != test.line || column != test.column {
+			t.Errorf("position of %s failed: got %d:%d, want %d:%d", test.match, line, column, test.line, test.column)
+		}
+	}
+}
+
+func TestProcessFileMode(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "input.txt", "[[file1]]")
+	createTestFile(tempDir, "existing.txt", "")
+	inputFile := filepath.Join(tempDir, "input.txt")
+	if err := os.Chmod(inputFile, 0640); err != nil {
+		t.Fatalf("unable to chmod input file: %v", err)
+	}
+
+	for _, outputFile := range []string{"output.txt", "existing.txt"} {
+		config := Config{
+			inputFile:  inputFile,
+			outputFile: filepath.Join(tempDir, outputFile),
+			prefix:     "/",
+			force:      true,
+			index: newTestIndex(
+				linklore.FileInfo{
+					Name:     "file1.txt",
+					Basename: "file1",
+					Ext:      ".txt",
+					Path:     "file1.txt",
+				},
+			),
+		}
+
+		err := processFile(config)
+		if err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+
+		info, err := os.Stat(config.outputFile)
+		if err != nil {
+			t.Fatalf("processFile failed: unable to stat output file: %v", err)
+		}
+		if mode := info.Mode().Perm(); mode != 0640 {
+			t.Errorf("processFile failed: incorrect mode for %s, got %o, want %o", outputFile, mode, 0640)
+		}
+	}
+}
+
+func TestProcessFileAtomic(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "input.txt", "[[file1]]")
+	createTestFile(tempDir, "output.txt", "original")
+
+	config := Config{
+		inputFile:  filepath.Join(tempDir, "input.txt"),
+		outputFile: filepath.Join(tempDir, "output.txt"),
+		prefix:     "/",
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+
+	if err := processFile(config); err == nil {
+		t.Errorf("processFile failed: expected error for existing output file without force")
+	}
+	config.force = true
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Fatalf("processFile failed: unable to read output file: %v", err)
+	}
+	if expected := "[file1](/file1.txt)"; string(outputContent) != expected {
+		t.Errorf("processFile failed: incorrect output content, got %s, want %s", outputContent, expected)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("unable to read temp dir: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("processFile failed: temporary file left behind, got %d entries", len(entries))
+	}
+}
+
+func TestProcessFileStdio(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "stdin.txt", "[[file1]]")
+	stdin, err := os.Open(filepath.Join(tempDir, "stdin.txt"))
+	if err != nil {
+		t.Fatalf("unable to open stdin file: %v", err)
+	}
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(tempDir, "stdout.txt"))
+	if err != nil {
+		t.Fatalf("unable to create stdout file: %v", err)
+	}
+	defer stdout.Close()
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	config := Config{
+		inputFile:  stdio,
+		outputFile: defaultOutputFile(stdio, ""),
+		baseDir:    tempDir,
+		prefix:     "/",
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+
+	err = processFile(config)
+	if err != nil {
+		t.Errorf("processFile failed: %v", err)
+	}
+
+	expectedOutput := "[file1](/file1.txt)"
+	outputContent, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Errorf("processFile failed: unable to read stdout file: %v", err)
+	}
+
+	if string(outputContent) != expectedOutput {
+		t.Errorf("processFile failed: incorrect output content, got %s, want %s", outputContent, expectedOutput)
+	}
+}
+
+func TestProcessFileURL(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/notes/input.md" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("[[file1]]"))
+	}))
+	defer server.Close()
+
+	config := Config{
+		inputFile:  server.URL + "/notes/input.md",
+		outputFile: filepath.Join(tempDir, "output.md"),
+		prefix:     "/",
+		index: newTestIndex(linklore.FileInfo{
+			Name:     "file1.md",
+			Basename: "file1",
+			Ext:      ".md",
+			Path:     "file1.md",
+		}),
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Fatalf("processFile failed: unable to read output file: %v", err)
+	}
+	if string(outputContent) != "[file1](/file1)" {
+		t.Errorf("processFile failed: got %q, want %q", outputContent, "[file1](/file1)")
+	}
+
+	config.inputFile = server.URL + "/notes/missing.md"
+	config.force = true
+	if err := processFile(config); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("processFile failed: expected a 404 error, got %v", err)
+	}
+
+	if got := defaultOutputFile(server.URL+"/notes/input.md?raw=1", ""); got != "input.out.md" {
+		t.Errorf("defaultOutputFile failed: got %s, want input.out.md", got)
+	}
+}
+
+func TestProcessFileDryRun(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "input.txt", "[[file1]] [[missing]]")
+	createTestFile(tempDir, "existing.txt", "original")
+
+	config := Config{
+		inputFile:  filepath.Join(tempDir, "input.txt"),
+		outputFile: filepath.Join(tempDir, "output.txt"),
+		prefix:     "/",
+		dryRun:     true,
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+
+	err := processFile(config)
+	if err != nil {
+		t.Errorf("processFile failed: %v", err)
+	}
+	if _, err := os.Stat(config.outputFile); err == nil {
+		t.Errorf("processFile failed: output file should not be created in dry-run mode")
+	}
+
+	config.outputFile = filepath.Join(tempDir, "existing.txt")
+	err = processFile(config)
+	if err != nil {
+		t.Errorf("processFile failed: existing output file should not be an error in dry-run mode: %v", err)
+	}
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Errorf("processFile failed: unable to read output file: %v", err)
+	}
+	if string(outputContent) != "original" {
+		t.Errorf("processFile failed: output file should not be overwritten in dry-run mode, got %s", outputContent)
+	}
+}
+
+func TestProcessFileStrict(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "input.txt", "[[file1]] [[missing]] [[gone|Gone]]")
+
+	config := Config{
+		inputFile:  filepath.Join(tempDir, "input.txt"),
+		outputFile: filepath.Join(tempDir, "output.txt"),
+		prefix:     "/",
+		strict:     true,
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+
+	err := processFile(config)
+	var unresolved *unresolvedLinksError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("processFile failed: expected unresolved links error, got %v", err)
+	}
+	expectedLinks := []string{"[[missing]]", "[[gone|Gone]]"}
+	if !reflect.DeepEqual(unresolved.links, expectedLinks) {
+		t.Errorf("processFile failed: incorrect unresolved links, got %v, want %v", unresolved.links, expectedLinks)
+	}
+	if unresolved.inputFile != config.inputFile {
+		t.Errorf("processFile failed: incorrect input file, got %s, want %s", unresolved.inputFile, config.inputFile)
+	}
+
+	expectedOutput := "[file1](/file1.txt) [[missing]] [[gone|Gone]]"
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Errorf("processFile failed: output should still be written in strict mode: %v", err)
+	}
+	if string(outputContent) != expectedOutput {
+		t.Errorf("processFile failed: incorrect output content, got %s, want %s", outputContent, expectedOutput)
+	}
+}
+
+func TestProcessFileCheck(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "valid.txt", "[[file1]]")
+	createTestFile(tempDir, "broken.txt", "[[file1]] [[missing]]")
+	createTestFile(tempDir, "existing.txt", "")
+
+	config := Config{
+		prefix: "/",
+		check:  true,
+		index: newTestIndex(linklore.FileInfo{
+			Name:     "file1.txt",
+			Basename: "file1",
+			Ext:      ".txt",
+			Path:     "file1.txt",
+		}),
+	}
+
+	config.inputFile = filepath.Join(tempDir, "valid.txt")
+	config.outputFile = filepath.Join(tempDir, "existing.txt")
+	if err := processFile(config); err != nil {
+		t.Errorf("processFile failed: unexpected error in check mode: %v", err)
+	}
+
+	config.inputFile = filepath.Join(tempDir, "broken.txt")
+	config.outputFile = filepath.Join(tempDir, "broken.out.txt")
+	err := processFile(config)
+	var unresolved *unresolvedLinksError
+	if !errors.As(err, &unresolved) || !reflect.DeepEqual(unresolved.links, []string{"[[missing]]"}) {
+		t.Errorf("processFile failed: expected [[missing]] to be unresolved, got %v", err)
+	}
+	if _, err := os.Stat(config.outputFile); !os.IsNotExist(err) {
+		t.Errorf("processFile failed: output file written in check mode")
+	}
+	if content, _ := os.ReadFile(filepath.Join(tempDir, "existing.txt")); len(content) != 0 {
+		t.Errorf("processFile failed: existing file overwritten in check mode: %q", content)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		command  string
+		expected []string
+	}{
+		{args: nil, command: "", expected: nil},
+		{args: []string{"-i", "note.md"}, command: "", expected: []string{"-i", "note.md"}},
+		{args: []string{"check", "-i", "note.md"}, command: "check", expected: []string{"-i", "note.md"}},
+		{args: []string{"-i", "check"}, command: "", expected: []string{"-i", "check"}},
+	}
+	for _, test := range tests {
+		command, args := splitCommand(test.args)
+		if command != test.command || !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("splitCommand failed for %v: got %q %v, want %q %v", test.args, command, args, test.command, test.expected)
+		}
+	}
+}
+
+func TestProcessFileQuiet(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "input.txt", "[[file1]] [[missing]]")
+	stderr, err := os.Create(filepath.Join(tempDir, "stderr.txt"))
+	if err != nil {
+		t.Fatalf("unable to create stderr file: %v", err)
+	}
+	defer stderr.Close()
+
+	oldStderr := os.Stderr
+	os.Stderr = stderr
+	defer func() { os.Stderr = oldStderr }()
+
+	config := Config{
+		inputFile:  filepath.Join(tempDir, "input.txt"),
+		outputFile: filepath.Join(tempDir, "output.txt"),
+		prefix:     "/",
+		quiet:      true,
+		strict:     true,
+		index: newTestIndex(
+			linklore.FileInfo{
+				Name:     "file1.txt",
+				Basename: "file1",
+				Ext:      ".txt",
+				Path:     "file1.txt",
+			},
+		),
+	}
+
+	err = processFile(config)
+	var unresolved *unresolvedLinksError
+	if !errors.As(err, &unresolved) {
+		t.Errorf("processFile failed: expected unresolved links error in quiet strict mode, got %v", err)
+	}
+
+	outputContent, err := os.ReadFile(config.outputFile)
+	if err != nil {
+		t.Errorf("processFile failed: unable to read output file: %v", err)
+	}
+	if expected := "[file1](/file1.txt) [[missing]]"; string(outputContent) != expected {
+		t.Errorf("processFile failed: incorrect output content, got %s, want %s", outputContent, expected)
+	}
+
+	stderrContent, err := os.ReadFile(stderr.Name())
+	if err != nil {
+		t.Errorf("unable to read stderr file: %v", err)
+	}
+	if len(stderrContent) != 0 {
+		t.Errorf("processFile failed: expected no messages in quiet mode, got %s", stderrContent)
+	}
+}
+
+func TestProcessDir(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	ignoredDir := filepath.Join(tempDir, "drafts")
+	os.Mkdir(subDir, 0755)
+	os.Mkdir(ignoredDir, 0755)
+	createTestFile(tempDir, "a.md", "[[b]]")
+	createTestFile(subDir, "b.md", "[[a]]")
+	createTestFile(ignoredDir, "c.md", "[[a]]")
+	createTestFile(tempDir, "d.txt", "[[a]]")
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		prefix:         "/",
+		recursive:      true,
+		ignorePatterns: []string{"drafts", "*.out.md"},
+	}
+
+	if !isDirectoryMode(config) {
+		t.Fatalf("isDirectoryMode failed: expected directory mode for %s", tempDir)
+	}
+
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processDir(context.Background(), config)
+	if err != nil {
+		t.Fatalf("processDir failed: %v", err)
+	}
+
+	expectedOutputs := map[string]string{
+		filepath.Join(tempDir, "a.out.md"): "[b](/sub/b)",
+		filepath.Join(subDir, "b.out.md"):  "[a](/a)",
+	}
+	for path, expected := range expectedOutputs {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processDir failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processDir failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+
+	for _, path := range []string{
+		filepath.Join(ignoredDir, "c.out.md"),
+		filepath.Join(tempDir, "d.out.md"),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("processDir failed: unexpected output file %s", path)
+		}
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[b]] [[missing]]")
+	createTestFile(tempDir, "b.md", "[[a]] [[a|A]]")
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		prefix:         "/",
+		recursive:      true,
+		quiet:          true,
+		ignorePatterns: []string{"*.out.md"},
+		stats:          &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processDir(context.Background(), config)
+	if err != nil {
+		t.Fatalf("processDir failed: %v", err)
+	}
+
+	expected := "processed 2 file(s), 3 link(s) rewritten, 1 unresolved, 1.50s"
+	if summary := config.stats.summary(1500 * time.Millisecond); summary != expected {
+		t.Errorf("runStats failed: got %s, want %s", summary, expected)
+	}
+}
+
+func TestRunStatsSort(t *testing.T) {
+	stats := &runStats{
+		issues: []linkIssue{
+			{File: "b.md", Line: 1, Column: 1, Link: "[[x]]"},
+			{File: "a.md", Line: 2, Column: 1, Link: "[[y]]"},
+			{File: "a.md", Line: 1, Column: 7, Link: "[[z]]"},
+			{File: "a.md", Line: 1, Column: 1, Link: "[[w]]"},
+		},
+		records: []linklore.LinkRecord{
+			{Source: "b.md", Line: 3, Column: 1, Text: "[[x]]"},
+			{Source: "a.md", Line: 1, Column: 9, Text: "[[y]]"},
+			{Source: "a.md", Line: 1, Column: 2, Text: "[[z]]"},
+		},
+	}
+	stats.sort()
+
+	var links []string
+	for _, issue := range stats.issues {
+		links = append(links, issue.Link)
+	}
+	if expected := []string{"[[w]]", "[[z]]", "[[y]]", "[[x]]"}; !reflect.DeepEqual(links, expected) {
+		t.Errorf("runStats.sort failed: got issues %v, want %v", links, expected)
+	}
+	links = nil
+	for _, record := range stats.records {
+		links = append(links, record.Text)
+	}
+	if expected := []string{"[[z]]", "[[y]]", "[[x]]"}; !reflect.DeepEqual(links, expected) {
+		t.Errorf("runStats.sort failed: got records %v, want %v", links, expected)
+	}
+
+	var nilStats *runStats
+	nilStats.sort()
+}
+
+func TestProcessDirOutDir(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	outDir := filepath.Join(tempDir, "out")
+	os.Mkdir(subDir, 0755)
+	createTestFile(tempDir, "a.md", "[[b]]")
+	createTestFile(subDir, "b.md", "[[a]]")
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		outDir:         outDir,
+		prefix:         "/",
+		recursive:      true,
+		ignorePatterns: []string{"*.out.md"},
+	}
+	if err := validateInput(config); err != nil {
+		t.Fatalf("validateInput failed: %v", err)
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	// The second run must not process the outputs of the first.
+	config.force = true
+	for run := 0; run < 2; run++ {
+		if err := processDir(context.Background(), config); err != nil {
+			t.Fatalf("processDir failed: %v", err)
+		}
+	}
+
+	expectedOutputs := map[string]string{
+		filepath.Join(outDir, "a.md"):        "[b](/sub/b)",
+		filepath.Join(outDir, "sub", "b.md"): "[a](/a)",
+	}
+	for path, expected := range expectedOutputs {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processDir failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processDir failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+	for _, path := range []string{
+		filepath.Join(tempDir, "a.out.md"),
+		filepath.Join(outDir, "out"),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("processDir failed: unexpected output %s", path)
+		}
+	}
+
+	for _, invalid := range []Config{
+		{inputFile: filepath.Join(tempDir, "a.md"), outDir: outDir},
+		{inputFile: tempDir, recursive: true, outDir: outDir, inPlace: true},
+		{inputFile: tempDir, recursive: true, outDir: outDir, outputFile: "x.md"},
+	} {
+		if err := validateInput(invalid); err == nil {
+			t.Errorf("validateInput failed: expected error for %+v", invalid)
+		}
+	}
+
+	outside := createTempDir(t)
+	defer os.RemoveAll(outside)
+	createTestFile(outside, "c.md", "")
+	config.inputFile = ""
+	err = processFiles(context.Background(), config, []string{filepath.Join(outside, "c.md")})
+	if err == nil || !strings.Contains(err.Error(), "not under a base directory") {
+		t.Errorf("processFiles failed: expected error for a file outside the base directory, got %v", err)
+	}
+}
+
+func TestProcessDirConcurrency(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	const files = 20
+	for i := 0; i < files; i++ {
+		createTestFile(tempDir, fmt.Sprintf("note%d.md", i), fmt.Sprintf("[[note%d]] [[missing]]", (i+1)%files))
+	}
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		prefix:         "/",
+		recursive:      true,
+		concurrency:    4,
+		ignorePatterns: []string{"*.out.md"},
+		stats:          &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	if err := processDir(context.Background(), config); err != nil {
+		t.Fatalf("processDir failed: %v", err)
+	}
+
+	for i := 0; i < files; i++ {
+		path := filepath.Join(tempDir, fmt.Sprintf("note%d.out.md", i))
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processDir failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		expected := fmt.Sprintf("[note%d](/note%d) [[missing]]", (i+1)%files, (i+1)%files)
+		if string(outputContent) != expected {
+			t.Errorf("processDir failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+
+	if config.stats.files != files || config.stats.rewritten != files || config.stats.unresolved != files {
+		t.Errorf("processDir failed: got stats %+v", *config.stats)
+	}
+	// The issues are in the order of the walk, whichever file finished first.
+	var issueFiles []string
+	for _, issue := range config.stats.issues {
+		issueFiles = append(issueFiles, issue.File)
+	}
+	if !slices.IsSorted(issueFiles) || len(issueFiles) != files {
+		t.Errorf("processDir failed: issues not in walk order: %v", issueFiles)
+	}
+}
+
+func TestProcessFilesFrom(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[b]]")
+	createTestFile(tempDir, "b.md", "[[a]]")
+	createTestFile(tempDir, "c.md", "[[a]]")
+	createTestFile(tempDir, "list.txt", "# notes to publish\n"+
+		filepath.Join(tempDir, "a.md")+"\n\n  "+filepath.Join(tempDir, "b.md")+"  \n")
+
+	config := Config{
+		filesFrom:      filepath.Join(tempDir, "list.txt"),
+		baseDir:        tempDir,
+		prefix:         "/",
+		ignorePatterns: []string{"*.out.md"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processFilesFrom(context.Background(), config)
+	if err != nil {
+		t.Fatalf("processFilesFrom failed: %v", err)
+	}
+
+	expectedOutputs := map[string]string{
+		filepath.Join(tempDir, "a.out.md"): "[b](/b)",
+		filepath.Join(tempDir, "b.out.md"): "[a](/a)",
+	}
+	for path, expected := range expectedOutputs {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processFilesFrom failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processFilesFrom failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "c.out.md")); !os.IsNotExist(err) {
+		t.Errorf("processFilesFrom failed: unlisted file c.md was processed")
+	}
+
+	config.inputFile = filepath.Join(tempDir, "a.md")
+	if err := validateInput(config); err == nil {
+		t.Errorf("validateInput failed: expected error for input file with --files-from")
+	}
+}
+
+func TestProcessFilesFrom0(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a b.md", "[[c]]")
+	createTestFile(tempDir, " c.md", "[[a b]]")
+	createTestFile(tempDir, "c.md", "[[a b]]")
+	createTestFile(tempDir, "list", filepath.Join(tempDir, "a b.md")+"\x00"+filepath.Join(tempDir, " c.md")+"\x00")
+
+	config := Config{
+		filesFrom0:     filepath.Join(tempDir, "list"),
+		baseDir:        tempDir,
+		prefix:         "/",
+		ignorePatterns: []string{"*.out.md"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processFilesFrom(context.Background(), config)
+	if err != nil {
+		t.Fatalf("processFilesFrom failed: %v", err)
+	}
+
+	expectedOutputs := map[string]string{
+		filepath.Join(tempDir, "a b.out.md"): "[c](/c)",
+		filepath.Join(tempDir, " c.out.md"):  "[a b](/a-b)",
+	}
+	for path, expected := range expectedOutputs {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processFilesFrom failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processFilesFrom failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "c.out.md")); !os.IsNotExist(err) {
+		t.Errorf("processFilesFrom failed: unlisted file c.md was processed")
+	}
+
+	config.filesFrom = filepath.Join(tempDir, "list")
+	if err := validateInput(config); err == nil {
+		t.Errorf("validateInput failed: expected error for --files-from with --files-from0")
+	}
+}
+
+func TestBuildIndexCache(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+	cacheDir := createTempDir(t)
+	defer os.RemoveAll(cacheDir)
+
+	createTestFile(tempDir, "note.md", "")
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(tempDir, "note.md"), past, past)
+	os.Chtimes(tempDir, past, past)
+
+	config := Config{
+		baseDir:        tempDir,
+		ignorePatterns: []string{"*.out.md"},
+		indexCache:     filepath.Join(cacheDir, "index.json"),
+	}
+	cacheModTime := func() time.Time {
+		info, err := os.Stat(config.indexCache)
+		if err != nil {
+			t.Fatalf("buildIndex failed: cache not written: %v", err)
+		}
+		return info.ModTime()
+	}
+
+	idx, err := buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if _, exists := idx.Lookup("note"); !exists {
+		t.Errorf("buildIndex failed: note not indexed")
+	}
+	os.Chtimes(config.indexCache, past, past)
+
+	idx, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if _, exists := idx.Lookup("note"); !exists {
+		t.Errorf("buildIndex failed: note not loaded from the cache")
+	}
+	if !cacheModTime().Equal(past) {
+		t.Errorf("buildIndex failed: an up to date cache was rewritten")
+	}
+
+	config.noCache = true
+	if _, err := buildIndex(context.Background(), config); err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if cacheModTime().Equal(past) {
+		t.Errorf("buildIndex failed: cache not rebuilt with --no-cache")
+	}
+}
+
+func TestExpandInputGlobs(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "b.md", "")
+	createTestFile(tempDir, "c.txt", "")
+	createTestFile(tempDir, "[literal].md", "")
+
+	tests := []struct {
+		inputFile  string
+		inputFiles []string
+		expected   []string
+	}{
+		{inputFile: filepath.Join(tempDir, "*.md"), expected: []string{filepath.Join(tempDir, "[literal].md"), filepath.Join(tempDir, "a.md"), filepath.Join(tempDir, "b.md")}},
+		{inputFile: filepath.Join(tempDir, "?.txt"), expected: []string{filepath.Join(tempDir, "c.txt")}},
+		{inputFile: filepath.Join(tempDir, "[literal].md"), expected: []string{filepath.Join(tempDir, "[literal].md")}},
+		{
+			inputFiles: []string{filepath.Join(tempDir, "c.txt"), filepath.Join(tempDir, "[ab].md")},
+			expected:   []string{filepath.Join(tempDir, "c.txt"), filepath.Join(tempDir, "a.md"), filepath.Join(tempDir, "b.md")},
+		},
+		{inputFile: stdio, expected: []string{stdio}},
+	}
+	for _, test := range tests {
+		config := Config{inputFile: test.inputFile, inputFiles: test.inputFiles}
+		if len(test.inputFiles) > 0 {
+			config.inputFile = test.inputFiles[0]
+		}
+		if err := expandInputGlobs(&config); err != nil {
+			t.Errorf("expandInputGlobs failed for %s: %v", config.inputFile, err)
+			continue
+		}
+		var output []string
+		if len(config.inputFiles) > 0 {
+			output = config.inputFiles
+		} else {
+			output = []string{config.inputFile}
+		}
+		if !reflect.DeepEqual(output, test.expected) || config.inputFile != test.expected[0] {
+			t.Errorf("expandInputGlobs failed for %s: got %v, want %v", test.inputFile, output, test.expected)
+		}
+	}
+
+	config := Config{inputFile: filepath.Join(tempDir, "*.html")}
+	err := expandInputGlobs(&config)
+	if err == nil || !strings.Contains(err.Error(), "no input file matches") {
+		t.Errorf("expandInputGlobs failed: expected error for a pattern matching nothing, got %v", err)
+	}
+}
+
+func TestProcessFilesRepeatedInput(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[b]]")
+	createTestFile(tempDir, "b.md", "[[a]]")
+	createTestFile(tempDir, "c.md", "[[a]]")
+
+	config := Config{
+		inputFile:      filepath.Join(tempDir, "a.md"),
+		inputFiles:     []string{filepath.Join(tempDir, "a.md"), filepath.Join(tempDir, "c.md")},
+		baseDir:        tempDir,
+		prefix:         "/",
+		ignorePatterns: []string{"*.out.md"},
+	}
+	if err := validateInput(config); err != nil {
+		t.Fatalf("validateInput failed: %v", err)
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processFiles(context.Background(), config, config.inputFiles)
+	if err != nil {
+		t.Fatalf("processFiles failed: %v", err)
+	}
+	expectedOutputs := map[string]string{
+		filepath.Join(tempDir, "a.out.md"): "[b](/b)",
+		filepath.Join(tempDir, "c.out.md"): "[a](/a)",
+	}
+	for path, expected := range expectedOutputs {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processFiles failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processFiles failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "b.out.md")); !os.IsNotExist(err) {
+		t.Errorf("processFiles failed: unlisted file b.md was processed")
+	}
+
+	invalid := []Config{
+		{inputFiles: []string{"a.md", "b.md"}, outputFile: "out.md"},
+		{inputFiles: []string{"a.md", stdio}},
+		{inputFiles: []string{"a.md", tempDir}},
+	}
+	for _, config := range invalid {
+		config.inputFile = config.inputFiles[0]
+		if err := validateInput(config); err == nil {
+			t.Errorf("validateInput failed: expected error for input files %v, output file %q", config.inputFiles, config.outputFile)
+		}
+	}
+}
+
+func TestProcessDirKeepGoing(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[c]]")
+	createTestFile(tempDir, "b.md", "[[a]]")
+	createTestFile(tempDir, "c.md", "[[b]]")
+	// b.md fails, since its output exists and -f is not set.
+	createTestFile(tempDir, "b.out.md", "kept")
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		prefix:         "/",
+		recursive:      true,
+		concurrency:    1,
+		ignorePatterns: []string{"*.out.md"},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	err = processDir(context.Background(), config)
+	if err == nil {
+		t.Fatalf("processDir failed: expected error for b.md")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "c.out.md")); err == nil {
+		t.Errorf("processDir failed: c.md processed after b.md failed without --keep-going")
+	}
+
+	os.Remove(filepath.Join(tempDir, "a.out.md"))
+	config.keepGoing = true
+	err = processDir(context.Background(), config)
+	expected := filepath.Join(tempDir, "b.md") + ": output file already exists"
+	if err == nil || err.Error() != expected {
+		t.Errorf("processDir failed: got error %v, want %s", err, expected)
+	}
+	for path, expected := range map[string]string{
+		filepath.Join(tempDir, "a.out.md"): "[c](/c)",
+		filepath.Join(tempDir, "b.out.md"): "kept",
+		filepath.Join(tempDir, "c.out.md"): "[b](/b)",
+	} {
+		outputContent, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("processDir failed: unable to read output file %s: %v", path, err)
+			continue
+		}
+		if string(outputContent) != expected {
+			t.Errorf("processDir failed: incorrect output content for %s, got %s, want %s", path, outputContent, expected)
+		}
+	}
+}
+
+func TestProcessDirCanceled(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "[[a]]")
+
+	config := Config{
+		inputFile:      tempDir,
+		baseDir:        tempDir,
+		prefix:         "/",
+		recursive:      true,
+		ignorePatterns: []string{"*.out.md"},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := processDir(ctx, config)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("processDir failed: expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "a.out.md")); !os.IsNotExist(err) {
+		t.Errorf("processDir failed: file processed after cancellation")
+	}
+}
+
+func TestProcessFileAmbiguous(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	subDir := filepath.Join(tempDir, "sub")
+	os.Mkdir(subDir, 0755)
+	createTestFile(tempDir, "note.md", "")
+	createTestFile(subDir, "note.md", "")
+	createTestFile(tempDir, "qualified.txt", "[[sub/note]]")
+	createTestFile(tempDir, "ambiguous.txt", "[[note]]")
+
+	config := Config{
+		baseDir:        tempDir,
+		prefix:         "/",
+		ignorePatterns: []string{"*.txt"},
+	}
+	var err error
+	if config.index, err = buildIndex(context.Background(), config); err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+
+	config.inputFile = filepath.Join(tempDir, "qualified.txt")
+	config.outputFile = filepath.Join(tempDir, "qualified.out.txt")
+	if err := processFile(config); err != nil {
+		t.Errorf("processFile failed: unexpected error for qualified link: %v", err)
+	}
+
+	config.inputFile = filepath.Join(tempDir, "ambiguous.txt")
+	config.outputFile = filepath.Join(tempDir, "ambiguous.out.txt")
+	if err := processFile(config); err == nil {
+		t.Errorf("processFile failed: expected error for ambiguous link")
+	}
+	if _, err := os.Stat(config.outputFile); err == nil {
+		t.Errorf("processFile failed: output file should not be written for ambiguous link")
+	}
+}
+
+func TestParseExtMap(t *testing.T) {
+	extensions, err := parseExtMap(".md:.html,.markdown:.html,.txt:")
+	if err != nil {
+		t.Fatalf("parseExtMap failed: %v", err)
+	}
+	expected := map[string]string{".md": ".html", ".markdown": ".html", ".txt": ""}
+	if !reflect.DeepEqual(extensions, expected) {
+		t.Errorf("parseExtMap failed: got %v, want %v", extensions, expected)
+	}
+
+	for _, invalid := range []string{".md", "md:.html", ".md:html"} {
+		if _, err := parseExtMap(invalid); err == nil {
+			t.Errorf("parseExtMap failed: expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseImageExts(t *testing.T) {
+	extensions, err := parseImageExts(".png,.PDF")
+	if err != nil || !reflect.DeepEqual(extensions, []string{".png", ".PDF"}) {
+		t.Errorf("parseImageExts failed: got %v, %v", extensions, err)
+	}
+	if extensions, err := parseImageExts(""); err != nil || extensions != nil {
+		t.Errorf("parseImageExts failed for the default: got %v, %v", extensions, err)
+	}
+	if _, err := parseImageExts(".png,jpg"); err == nil {
+		t.Errorf("parseImageExts failed: expected error for an extension without .")
+	}
+}
+
+func TestParsePrefixMap(t *testing.T) {
+	prefixes, err := parsePrefixMap("blog/:/posts/,docs:https://example.com/guide/,/notes/sub:")
+	if err != nil {
+		t.Fatalf("parsePrefixMap failed: %v", err)
+	}
+	expected := map[string]string{"blog": "/posts/", "docs": "https://example.com/guide/", "notes/sub": ""}
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("parsePrefixMap failed: got %v, want %v", prefixes, expected)
+	}
+
+	for _, invalid := range []string{"blog", ":/posts/", "/:/posts/"} {
+		if _, err := parsePrefixMap(invalid); err == nil {
+			t.Errorf("parsePrefixMap failed: expected error for %q", invalid)
+		}
+	}
+}
+
+func TestSetDefaultValuesIgnorePatterns(t *testing.T) {
+	tests := []struct {
+		name            string
+		ignorePatterns  []string
+		noDefaultIgnore bool
+		expected        []string
+	}{
+		{name: "defaults only", ignorePatterns: []string{}, expected: defaultIgnorePatterns},
+		{
+			name:           "defaults and mine",
+			ignorePatterns: []string{"drafts", ".git"},
+			expected:       []string{".github", ".vscode", ".idea", ".env", "node_modules", ".obsidian", "*.out.md", "drafts", ".git"},
+		},
+		{name: "mine only", ignorePatterns: []string{"drafts"}, noDefaultIgnore: true, expected: []string{"drafts"}},
+		{name: "nothing", ignorePatterns: []string{}, noDefaultIgnore: true, expected: []string{}},
+	}
+	for _, test := range tests {
+		config := Config{inputFile: stdio, ignorePatterns: test.ignorePatterns, noDefaultIgnore: test.noDefaultIgnore}
+		setDefaultValues(&config)
+		if !reflect.DeepEqual(config.ignorePatterns, test.expected) {
+			t.Errorf("setDefaultValues failed for %s: got %v, want %v", test.name, config.ignorePatterns, test.expected)
+		}
+		if err := validateConfig(config); err != nil {
+			t.Errorf("validateConfig failed for %s: %v", test.name, err)
+		}
+	}
+}
+
+func TestOutSuffix(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "note.md", "[[a]]")
+	inputFile := filepath.Join(tempDir, "note.md")
+
+	config := Config{inputFile: inputFile, outSuffix: ".processed.md", ignorePatterns: []string{}}
+	setDefaultValues(&config)
+	if expected := filepath.Join(tempDir, "note.processed.md"); config.outputFile != expected {
+		t.Errorf("setDefaultValues failed: got output file %s, want %s", config.outputFile, expected)
+	}
+	if !slices.Contains(config.ignorePatterns, "*.processed.md") || slices.Contains(config.ignorePatterns, "*.out.md") {
+		t.Errorf("setDefaultValues failed: ignore patterns not in sync with the suffix: %v", config.ignorePatterns)
+	}
+
+	// A bare extension names the output as the input, which is not ignored.
+	config = Config{inputFile: inputFile, outSuffix: ".md", ignorePatterns: []string{}}
+	setDefaultValues(&config)
+	if config.outputFile != inputFile || slices.Contains(config.ignorePatterns, "*.md") {
+		t.Errorf("setDefaultValues failed: got output file %s and ignore patterns %v", config.outputFile, config.ignorePatterns)
+	}
+	config.index, _ = buildIndex(context.Background(), Config{baseDir: tempDir, ignorePatterns: []string{}})
+	config.prefix = "/"
+	if err := processFile(config); err == nil {
+		t.Errorf("processFile failed: expected error when the output file is the input file")
+	}
+
+	// With --in-place, an empty suffix is left to its default and unused.
+	t.Setenv("LINKLORE_OUT_SUFFIX", "")
+	config = Config{inputFile: inputFile, prefix: "/", inPlace: true, ignorePatterns: []string{}, index: config.index}
+	if err := loadEnvVariables(&config); err != nil {
+		t.Fatalf("loadEnvVariables failed: %v", err)
+	}
+	setDefaultValues(&config)
+	if config.outputFile != inputFile {
+		t.Errorf("setDefaultValues failed: got output file %s with --in-place, want %s", config.outputFile, inputFile)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if content, _ := os.ReadFile(inputFile); string(content) != "[a](/a)" {
+		t.Errorf("processFile failed: got %s, want [a](/a)", content)
+	}
+
+	config.outSuffix = "/out.md"
+	if err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "out suffix") {
+		t.Errorf("validateConfig failed: expected error for suffix with a path separator, got %v", err)
+	}
+}
+
+func TestApplyEnvBaseURL(t *testing.T) {
+	tests := []struct {
+		prefix     string
+		envBaseURL string
+		wantPrefix string
+		wantURL    string
+	}{
+		{prefix: "/wiki/", envBaseURL: "https://example.com", wantPrefix: "/wiki/", wantURL: "https://example.com"},
+		{envBaseURL: "https://example.com/wiki/", wantPrefix: "https://example.com/wiki/"},
+		{envBaseURL: "/docs/", wantPrefix: "/docs/"},
+		{prefix: "/wiki/", envBaseURL: "/docs/", wantPrefix: "/docs/"},
+		{prefix: "/wiki/", wantPrefix: "/wiki/"},
+	}
+	for _, test := range tests {
+		config := Config{prefix: test.prefix, envBaseURL: test.envBaseURL}
+		applyEnvBaseURL(&config, nil)
+		if config.prefix != test.wantPrefix || config.baseURL != test.wantURL {
+			t.Errorf("applyEnvBaseURL failed for prefix %q and LINKLORE_BASE_URL %q: got prefix %q and base URL %q", test.prefix, test.envBaseURL, config.prefix, config.baseURL)
+		}
+	}
+
+	// Set alone, LINKLORE_BASE_URL is still the prefix.
+	t.Setenv("LINKLORE_PREFIX", "")
+	t.Setenv("LINKLORE_BASE_URL", "/docs/")
+	config := Config{inputFile: "note.md", ignorePatterns: []string{}}
+	if err := loadEnvVariables(&config); err != nil {
+		t.Fatalf("loadEnvVariables failed: %v", err)
+	}
+	applyEnvBaseURL(&config, nil)
+	setDefaultValues(&config)
+	if err := validateConfig(config); err != nil {
+		t.Errorf("validateConfig failed with LINKLORE_BASE_URL=/docs/: %v", err)
+	}
+	if config.prefix != "/docs/" || config.baseURL != "" {
+		t.Errorf("loadEnvVariables failed: got prefix %q and base URL %q, want prefix /docs/", config.prefix, config.baseURL)
+	}
+
+	// A prefix given with -p counts, and the flags win over the variable.
+	flagTests := []struct {
+		envBaseURL string
+		args       []string
+		wantPrefix string
+		wantURL    string
+	}{
+		{envBaseURL: "https://site.com", args: []string{"-p", "/wiki/"}, wantPrefix: "/wiki/", wantURL: "https://site.com"},
+		{envBaseURL: "/docs/", args: []string{"-p", "/wiki/"}, wantPrefix: "/wiki/"},
+		{envBaseURL: "https://site.com", args: []string{"-p", "/wiki/", "--base-url", "https://example.com"}, wantPrefix: "/wiki/", wantURL: "https://example.com"},
+	}
+	defer func(commandLine *flag.FlagSet) { flag.CommandLine = commandLine }(flag.CommandLine)
+	for _, test := range flagTests {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		t.Setenv("LINKLORE_BASE_URL", test.envBaseURL)
+		config := Config{inputFile: "note.md", ignorePatterns: []string{}}
+		if err := loadEnvVariables(&config); err != nil {
+			t.Fatalf("loadEnvVariables failed: %v", err)
+		}
+		parseCommandLineFlags(&config, test.args)
+		applyEnvBaseURL(&config, explicitFlags())
+		if config.prefix != test.wantPrefix || config.baseURL != test.wantURL {
+			t.Errorf("applyEnvBaseURL failed for LINKLORE_BASE_URL %q and flags %v: got prefix %q and base URL %q", test.envBaseURL, test.args, config.prefix, config.baseURL)
+		}
+	}
+}
+
+func TestLoadIgnoreFiles(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	notesDir := filepath.Join(tempDir, "notes")
+	os.Mkdir(notesDir, 0755)
+	createTestFile(notesDir, ignoreFileName, "# drafts are not published\ndrafts\n\n*.tmp\n")
+
+	config := Config{
+		baseDir:        notesDir + "," + tempDir,
+		ignorePatterns: []string{".git"},
+	}
+	err := loadIgnoreFiles(&config)
+	if err != nil {
+		t.Fatalf("loadIgnoreFiles failed: %v", err)
+	}
+
+	expected := []string{".git", ignoreFileName, "drafts", "*.tmp"}
+	if !reflect.DeepEqual(config.ignorePatterns, expected) {
+		t.Errorf("loadIgnoreFiles failed: got %v, want %v", config.ignorePatterns, expected)
+	}
+}
+
+func TestLoadDotEnvVariables(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, ".env.base", "LINKLORE_PREFIX=/base/\nLINKLORE_BASE_DIR=notes\n")
+	createTestFile(tempDir, ".env.production", "# overrides the prefix only\nLINKLORE_PREFIX=https://example.com/\n")
+	createTestFile(tempDir, ".env.invalid", "LINKLORE_MAX_FILES=many\n")
+	createTestFile(tempDir, ".env.quoted", "LINKLORE_BASE_DIR=\"My Notes #1\" # the vault\nLINKLORE_PREFIX = '/notes/' \n")
+
+	var config Config
+	err := loadDotEnvVariables(&config, []string{filepath.Join(tempDir, ".env.base"), filepath.Join(tempDir, ".env.production")})
+	if err != nil {
+		t.Fatalf("loadDotEnvVariables failed: %v", err)
+	}
+	if config.prefix != "https://example.com/" || config.baseDir != "notes" {
+		t.Errorf("loadDotEnvVariables failed: got prefix %q and base dir %q", config.prefix, config.baseDir)
+	}
+
+	err = loadDotEnvVariables(&config, []string{filepath.Join(tempDir, ".env.quoted")})
+	if err != nil {
+		t.Fatalf("loadDotEnvVariables failed: %v", err)
+	}
+	if config.prefix != "/notes/" || config.baseDir != "My Notes #1" {
+		t.Errorf("loadDotEnvVariables failed with quoted values: got prefix %q and base dir %q", config.prefix, config.baseDir)
+	}
+
+	invalid := filepath.Join(tempDir, ".env.invalid")
+	if err := loadDotEnvVariables(&config, []string{invalid}); err == nil || !strings.Contains(err.Error(), invalid) {
+		t.Errorf("loadDotEnvVariables failed: expected error naming %s, got %v", invalid, err)
+	}
+	if err := loadDotEnvVariables(&config, []string{filepath.Join(tempDir, ".env.missing")}); err == nil {
+		t.Errorf("loadDotEnvVariables failed: expected error for a missing env file")
+	}
+}
+
+func TestParseDotEnvValue(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{raw: "notes", expected: "notes"},
+		{raw: " notes  # the vault", expected: "notes"},
+		{raw: "a#b", expected: "a#b"},
+		{raw: " # only a comment", expected: ""},
+		{raw: `"My Notes #1" # quoted`, expected: "My Notes #1"},
+		{raw: `'C:\My Notes\#drafts'`, expected: `C:\My Notes\#drafts`},
+		{raw: `"say \"hi\"\tthen\nleave \\ \d"`, expected: "say \"hi\"\tthen\nleave \\ \\d"},
+		{raw: `"unterminated`, expected: `"unterminated`},
+		{raw: `"a # b`, expected: `"a # b`},
+		{raw: ` 'a # b  `, expected: `'a # b`},
+		{raw: `""`, expected: ""},
+	}
+
+	for _, test := range tests {
+		output := parseDotEnvValue(test.raw)
+		if output != test.expected {
+			t.Errorf("Raw: %s, Expected: %q, Got: %q", test.raw, test.expected, output)
+		}
+	}
+}
+
+func TestFindEnvFiles(t *testing.T) {
+	tests := []struct {
+		args     []string
+		env      string
+		expected []string
+	}{
+		{args: []string{"-i", "note.md"}, expected: nil},
+		{args: []string{"--env-file", ".env.production"}, expected: []string{".env.production"}},
+		{args: []string{"--env-file=.env", "--env-file", ".env.local"}, env: ".env.ci", expected: []string{".env", ".env.local"}},
+		{args: []string{"-i", "note.md"}, env: ".env,.env.ci", expected: []string{".env", ".env.ci"}},
+		{args: []string{"--", "--env-file", ".env.production"}, expected: nil},
+	}
+
+	for _, test := range tests {
+		t.Setenv("LINKLORE_ENV_FILE", test.env)
+		output := findEnvFiles(test.args)
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("Args: %v, Env: %q, Expected: %v, Got: %v", test.args, test.env, test.expected, output)
+		}
+	}
+}
+
+func TestFindVaultRoot(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+	tempDir, _ = filepath.EvalSymlinks(tempDir)
+
+	vault := filepath.Join(tempDir, "vault")
+	nested := filepath.Join(vault, "notes", "daily")
+	os.MkdirAll(filepath.Join(vault, ".obsidian"), 0755)
+	os.MkdirAll(nested, 0755)
+	other := filepath.Join(tempDir, "other", "sub")
+	os.MkdirAll(other, 0755)
+	createTestFile(filepath.Join(tempDir, "other"), ".linklore-root", "")
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{dir: nested, expected: vault},
+		{dir: vault, expected: vault},
+		{dir: other, expected: filepath.Join(tempDir, "other")},
+	}
+	for _, test := range tests {
+		root, err := findVaultRoot(test.dir)
+		if err != nil {
+			t.Errorf("findVaultRoot failed for %s: %v", test.dir, err)
+		}
+		if root != test.expected {
+			t.Errorf("findVaultRoot failed for %s: got %q, want %q", test.dir, root, test.expected)
+		}
+	}
+
+	config := Config{inputFile: filepath.Join(nested, "today.md")}
+	if start := autoBaseStart(config); start != nested {
+		t.Errorf("autoBaseStart failed: got %q, want %q", start, nested)
+	}
+	config.inputFile = stdio
+	if start := autoBaseStart(config); start != "." {
+		t.Errorf("autoBaseStart failed for stdin: got %q", start)
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	tests := []struct {
+		baseDir   string
+		inputFile string
+		expected  string
+	}{
+		{baseDir: "vault", inputFile: filepath.Join("vault", "sub", "a.md"), expected: filepath.Join("sub", "a.md")},
+		{baseDir: "notes,vault", inputFile: filepath.Join("vault", "a.md"), expected: "a.md"},
+		{baseDir: "vault", inputFile: filepath.Join("other", "a.md"), expected: ""},
+		{baseDir: "vault", inputFile: stdio, expected: ""},
+		{baseDir: "vault", inputFile: absPath(t, filepath.Join("vault", "a.md")), expected: "a.md"},
+	}
+	for _, test := range tests {
+		source := sourcePath(Config{baseDir: test.baseDir, inputFile: test.inputFile})
+		if source != test.expected {
+			t.Errorf("sourcePath failed for %s in %s: got %q, want %q", test.inputFile, test.baseDir, source, test.expected)
+		}
+	}
+}
+
+func absPath(t *testing.T, path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatalf("filepath.Abs failed: %v", err)
+	}
+	return absPath
+}
+
+func TestCheckVolume(t *testing.T) {
+	config := Config{baseDir: "vault", relativeLinks: true}
+	if err := checkVolume(config, absPath(t, filepath.Join("other", "a.md"))); err != nil {
+		t.Errorf("checkVolume failed: unexpected error on the same volume: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		// Only Windows paths have volumes.
+		return
+	}
+
+	config.baseDir = `C:\vault`
+	err := checkVolume(config, `D:\notes\a.md`)
+	expected := `input file D:\notes\a.md is on volume D:, but no base directory is (base directories: C:\vault)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("checkVolume failed: got %v, want %s", err, expected)
+	}
+	if err := checkVolume(config, `c:\vault\a.md`); err != nil {
+		t.Errorf("checkVolume failed: unexpected error for a volume in another case: %v", err)
+	}
+	config.relativeLinks = false
+	if err := checkVolume(config, `D:\notes\a.md`); err != nil {
+		t.Errorf("checkVolume failed: unexpected error when links are not relative to the input: %v", err)
+	}
+	config.relativeLinks = true
+	config.inputFile = `D:\notes\a.md`
+	if _, err := buildIndex(context.Background(), config); err == nil || err.Error() != expected {
+		t.Errorf("buildIndex failed: got %v, want %s", err, expected)
+	}
+}
+
+func TestValidateConfigPrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		baseURL string
+		valid   bool
+	}{
+		{prefix: "/docs/", valid: true},
+		{prefix: "https://example.com/wiki/", valid: true},
+		{prefix: "https://", valid: false},
+		{prefix: "https://exa mple.com/", valid: false},
+		{prefix: "/wiki/", baseURL: "https://example.com", valid: true},
+		{prefix: "/wiki/", baseURL: "example.com", valid: false},
+		{prefix: "https://example.com/wiki/", baseURL: "https://example.com", valid: false},
+	}
+
+	for _, test := range tests {
+		config := Config{
+			inputFile:       "note.md",
+			outputFile:      "note.out.md",
+			baseDir:         ".",
+			prefix:          test.prefix,
+			baseURL:         test.baseURL,
+			embedMode:       linklore.EmbedModeLink,
+			anchorStyle:     linklore.AnchorStyleGitHub,
+			blockMode:       linklore.BlockModeKeep,
+			linkFormat:      linklore.LinkFormatShortest,
+			unresolvedMode:  linklore.UnresolvedModeKeep,
+			frontmatterMode: linklore.FrontmatterModeProcess,
+			selfLinkMode:    linklore.SelfLinkModeKeep,
+			pathTransform:   linklore.PathTransformNone,
+			reportFormat:    reportFormatText,
+			ignorePatterns:  []string{},
+		}
+		err := validateConfig(config)
+		if (err == nil) != test.valid {
+			t.Errorf("validateConfig failed for prefix %q and base URL %q: got error %v", test.prefix, test.baseURL, err)
+		}
+	}
+}
+
+func TestValidateConfigPathRule(t *testing.T) {
+	tests := []struct {
+		pathRule string
+		valid    bool
+	}{
+		{pathRule: "", valid: true},
+		{pathRule: "date", valid: true},
+		{pathRule: "flat", valid: true},
+		{pathRule: "hugo", valid: false},
+	}
+
+	for _, test := range tests {
+		config := Config{
+			inputFile:       "note.md",
+			outputFile:      "note.out.md",
+			baseDir:         ".",
+			prefix:          "/",
+			embedMode:       linklore.EmbedModeLink,
+			anchorStyle:     linklore.AnchorStyleGitHub,
+			blockMode:       linklore.BlockModeKeep,
+			linkFormat:      linklore.LinkFormatShortest,
+			unresolvedMode:  linklore.UnresolvedModeKeep,
+			frontmatterMode: linklore.FrontmatterModeProcess,
+			selfLinkMode:    linklore.SelfLinkModeKeep,
+			pathTransform:   linklore.PathTransformNone,
+			reportFormat:    reportFormatText,
+			pathRule:        test.pathRule,
+			ignorePatterns:  []string{},
+		}
+		err := validateConfig(config)
+		if (err == nil) != test.valid {
+			t.Errorf("validateConfig failed for path rule %q: got error %v", test.pathRule, err)
+		}
+		if opts := rewriteOptions(config); (opts.PathRewriter != nil) != (test.valid && test.pathRule != "") {
+			t.Errorf("rewriteOptions failed for path rule %q: unexpected path rewriter", test.pathRule)
+		}
+		config.relativeLinks = true
+		if err := validateConfig(config); err == nil && test.pathRule != "" {
+			t.Errorf("validateConfig failed for path rule %q: expected an error with --relative-links", test.pathRule)
+		}
+	}
+}
+
+func TestValidateConfigLinkTitles(t *testing.T) {
+	tests := []struct {
+		refStyle bool
+		template string
+		valid    bool
+	}{
+		{valid: true},
+		{refStyle: true, valid: false},
+		{template: `<a href="{{.Link}}">{{.Alias}}</a>`, valid: false},
+	}
+
+	for _, test := range tests {
+		config := Config{
+			inputFile:      "note.md",
+			baseDir:        ".",
+			linkTitles:     true,
+			refStyle:       test.refStyle,
+			template:       test.template,
+			ignorePatterns: []string{},
+		}
+		setDefaultValues(&config)
+		err := validateConfig(config)
+		if (err == nil) != test.valid {
+			t.Errorf("validateConfig failed for --link-titles with ref style %v and template %q: got error %v", test.refStyle, test.template, err)
+		}
+		if test.valid && config.template != linklore.TitleTemplate {
+			t.Errorf("setDefaultValues failed: got template %q with --link-titles", config.template)
+		}
+	}
+}
+
+func TestValidateConfigMaxFiles(t *testing.T) {
+	config := Config{
+		inputFile:       stdio,
+		outputFile:      stdio,
+		baseDir:         ".",
+		embedMode:       linklore.EmbedModeLink,
+		anchorStyle:     linklore.AnchorStyleGitHub,
+		blockMode:       linklore.BlockModeKeep,
+		linkFormat:      linklore.LinkFormatShortest,
+		unresolvedMode:  linklore.UnresolvedModeKeep,
+		frontmatterMode: linklore.FrontmatterModeProcess,
+		selfLinkMode:    linklore.SelfLinkModeKeep,
+		pathTransform:   linklore.PathTransformNone,
+		reportFormat:    reportFormatText,
+		ignorePatterns:  []string{},
+	}
+
+	for _, maxFiles := range []int{0, linklore.DefaultMaxFiles} {
+		config.maxFiles = maxFiles
+		if err := validateConfig(config); err != nil {
+			t.Errorf("validateConfig failed for max files %d: %v", maxFiles, err)
+		}
+	}
+
+	config.maxFiles = -1
+	if err := validateConfig(config); err == nil {
+		t.Errorf("validateConfig failed: expected error for negative max files")
+	}
+}
+
+func TestValidateConfigInclude(t *testing.T) {
+	config := Config{
+		inputFile:       stdio,
+		outputFile:      stdio,
+		baseDir:         ".",
+		embedMode:       linklore.EmbedModeLink,
+		anchorStyle:     linklore.AnchorStyleGitHub,
+		blockMode:       linklore.BlockModeKeep,
+		linkFormat:      linklore.LinkFormatShortest,
+		unresolvedMode:  linklore.UnresolvedModeKeep,
+		frontmatterMode: linklore.FrontmatterModeProcess,
+		selfLinkMode:    linklore.SelfLinkModeKeep,
+		pathTransform:   linklore.PathTransformNone,
+		reportFormat:    reportFormatText,
+		ignorePatterns:  []string{},
+		includePatterns: []string{"*.md"},
+	}
+	if err := validateConfig(config); err != nil {
+		t.Errorf("validateConfig failed: %v", err)
+	}
+
+	for _, pattern := range []string{"[", "", " *.md"} {
+		config.includePatterns = []string{pattern}
+		if err := validateConfig(config); err == nil {
+			t.Errorf("validateConfig failed: expected error for include pattern %q", pattern)
+		}
+	}
+}
+
+func TestDumpIndex(t *testing.T) {
+	index := newTestIndex(
+		linklore.FileInfo{
+			Name:     "note.md",
+			Basename: "note",
+			Ext:      ".md",
+			Path:     "note.md",
+		},
+		linklore.FileInfo{
+			Name:     "note.md",
+			Basename: "note",
+			Ext:      ".md",
+			Path:     "sub/note.md",
+		},
+	)
+
+	var output bytes.Buffer
+	if err := dumpIndex(&output, index); err != nil {
+		t.Fatalf("dumpIndex failed: %v", err)
+	}
+
+	var dump indexDump
+	if err := json.Unmarshal(output.Bytes(), &dump); err != nil {
+		t.Fatalf("dumpIndex failed: invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(dump.Files, index.Files()) {
+		t.Errorf("dumpIndex failed: incorrect files, got %+v, want %+v", dump.Files, index.Files())
+	}
+	expectedDuplicates := map[string][]string{"note": {"note.md", "sub/note.md"}}
+	if !reflect.DeepEqual(dump.Duplicates, expectedDuplicates) {
+		t.Errorf("dumpIndex failed: incorrect duplicates, got %v, want %v", dump.Duplicates, expectedDuplicates)
+	}
+}
+
+func TestDumpIndexOrder(t *testing.T) {
+	files := []linklore.FileInfo{
+		{Name: "zeta.md", Basename: "zeta", Ext: ".md", Path: "a/zeta.md"},
+		{Name: "alpha.md", Basename: "alpha", Ext: ".md", Path: "b/alpha.md"},
+		{Name: "beta.md", Basename: "beta", Ext: ".md", Path: "beta.md"},
+		{Name: "alpha.md", Basename: "alpha", Ext: ".md", Path: "a/alpha.md"},
+	}
+	reversed := slices.Clone(files)
+	slices.Reverse(reversed)
+
+	var first, second bytes.Buffer
+	if err := dumpIndex(&first, newTestIndex(files...)); err != nil {
+		t.Fatalf("dumpIndex failed: %v", err)
+	}
+	if err := dumpIndex(&second, newTestIndex(reversed...)); err != nil {
+		t.Fatalf("dumpIndex failed: %v", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("dumpIndex failed: output depends on the order files were added:\n%s\n%s", first.String(), second.String())
+	}
+
+	var dump indexDump
+	if err := json.Unmarshal(first.Bytes(), &dump); err != nil {
+		t.Fatalf("dumpIndex failed: invalid JSON: %v", err)
+	}
+	var paths []string
+	for _, file := range dump.Files {
+		paths = append(paths, file.Path)
+	}
+	if expected := []string{"a/alpha.md", "b/alpha.md", "beta.md", "a/zeta.md"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("dumpIndex failed: got files %v, want %v", paths, expected)
+	}
+}
+
+func newTestIndex(files ...linklore.FileInfo) linklore.Index {
+	index := linklore.NewIndex(".", linklore.IndexOptions{})
+	for _, file := range files {
+		index.Add(file)
+	}
+	return index
+}
+
+func createTempDir(t *testing.T) string {
+	tempDir, err := os.MkdirTemp("", "linklore_test")
+	if err != nil {
+		t.Fatalf("createTempDir failed: %v", err)
+	}
+	return tempDir
+}
+
+func createTestFile(dir, filename, content string) {
+	filePath := filepath.Join(dir, filename)
+	err := os.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestVersionInfo(t *testing.T) {
+	tests := []struct {
+		info      *debug.BuildInfo
+		buildDate string
+		expected  string
+	}{
+		{info: nil, expected: "linklore dev\ngo: unknown\ncommit: unknown\ndate: unknown\n"},
+		{
+			info: &debug.BuildInfo{GoVersion: "go1.21.4", Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.time", Value: "2024-01-02T03:04:05Z"},
+				{Key: "vcs.modified", Value: "false"},
+			}},
+			expected: "linklore dev\ngo: go1.21.4\ncommit: abc123\ndate: 2024-01-02T03:04:05Z\n",
+		},
+		{
+			info: &debug.BuildInfo{GoVersion: "go1.21.4", Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.time", Value: "2024-01-02T03:04:05Z"},
+				{Key: "vcs.modified", Value: "true"},
+			}},
+			buildDate: "2024-02-03T00:00:00Z",
+			expected:  "linklore dev\ngo: go1.21.4\ncommit: abc123 (modified)\ndate: 2024-02-03T00:00:00Z\n",
+		},
+	}
+
+	defer func(buildDate string) { BuildDate = buildDate }(BuildDate)
+	for _, test := range tests {
+		BuildDate = test.buildDate
+		if got := versionInfo(test.info); got != test.expected {
+			t.Errorf("versionInfo failed: got %q, want %q", got, test.expected)
+		}
 	}
 }
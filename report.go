@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pluveto/linklore/linklore"
+)
+
+// Report formats select how the links that could not be rewritten are
+// reported at the end of a run.
+const (
+	reportFormatText = "text"
+	reportFormatJSON = "json"
+)
+
+// Issue reasons, in the order they are reported.
+const (
+	reasonNotFound  = "not found"
+	reasonAmbiguous = "ambiguous"
+	reasonAnchor    = "bad anchor"
+	reasonSelfLink  = "self link"
+	reasonError     = "error"
+)
+
+var issueReasons = []string{reasonNotFound, reasonAmbiguous, reasonAnchor, reasonSelfLink, reasonError}
+
+// linkIssue is a link of an input file that could not be rewritten, or whose
+// anchor was not found.
+type linkIssue struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Link   string `json:"link"`
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+}
+
+func newLinkIssue(inputFile string, change linkChange) linkIssue {
+	// The link of a *linklore.LinkError is shortened if it is too long.
+	link := change.match
+	var linkErr *linklore.LinkError
+	if errors.As(change.err, &linkErr) {
+		link = linkErr.Link
+	}
+	return linkIssue{
+		File:   inputFile,
+		Line:   change.line,
+		Column: change.column,
+		Link:   link,
+		Reason: issueReason(change.err),
+		Error:  change.err.Error(),
+	}
+}
+
+func issueReason(err error) string {
+	switch {
+	case errors.Is(err, linklore.ErrLinkNotFound):
+		return reasonNotFound
+	case errors.Is(err, linklore.ErrAmbiguousLink):
+		return reasonAmbiguous
+	case errors.Is(err, linklore.ErrAnchorNotFound):
+		return reasonAnchor
+	case errors.Is(err, linklore.ErrSelfLink):
+		return reasonSelfLink
+	default:
+		return reasonError
+	}
+}
+
+// detail returns what the error of issue tells beyond its reason, such as
+// the candidates of an ambiguous link, or "" if nothing.
+func (issue linkIssue) detail() string {
+	switch issue.Reason {
+	case reasonNotFound, reasonAnchor, reasonSelfLink:
+		return ""
+	}
+	// The error of a *linklore.LinkError ends with the link itself.
+	return strings.TrimSuffix(issue.Error, ": "+issue.Link)
+}
+
+// writeIssues writes issues grouped by input file, in the order the files
+// were processed, then by reason. Each link is located as
+// "file:line:column" so that editors can jump to it. With color, file names
+// are bold, errors red and warnings yellow.
+func writeIssues(w io.Writer, issues []linkIssue, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return "\x1b[" + code + "m" + s + "\x1b[0m"
+	}
+
+	var files []string
+	byFile := make(map[string][]linkIssue)
+	for _, issue := range issues {
+		if _, exists := byFile[issue.File]; !exists {
+			files = append(files, issue.File)
+		}
+		byFile[issue.File] = append(byFile[issue.File], issue)
+	}
+
+	for _, file := range files {
+		fmt.Fprintf(w, "%s: %d issue(s)\n", paint("1", file), len(byFile[file]))
+		for _, reason := range issueReasons {
+			var group []linkIssue
+			for _, issue := range byFile[file] {
+				if issue.Reason == reason {
+					group = append(group, issue)
+				}
+			}
+			if len(group) == 0 {
+				continue
+			}
+			code := "31"
+			if reason == reasonAnchor || reason == reasonSelfLink {
+				code = "33"
+			}
+			fmt.Fprintf(w, "  %s (%d):\n", paint(code, reason), len(group))
+			for _, issue := range group {
+				fmt.Fprintf(w, "    %s:%d:%d: %s", issue.File, issue.Line, issue.Column, issue.Link)
+				if detail := issue.detail(); detail != "" {
+					fmt.Fprintf(w, ": %s", detail)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	}
+}
+
+// jsonReport is the report written with --report-format json.
+type jsonReport struct {
+	Files      int            `json:"files"`
+	Rewritten  int            `json:"rewritten"`
+	Unresolved int            `json:"unresolved"`
+	Seconds    float64        `json:"seconds"`
+	Issues     []linkIssue    `json:"issues"`
+	Duplicates []duplicateKey `json:"duplicates"`
+}
+
+type duplicateKey struct {
+	Key   string   `json:"key"`
+	Paths []string `json:"paths"`
+}
+
+// writeJSONReport writes the outcome of a run, including the duplicate keys
+// of the index, as one JSON object.
+func writeJSONReport(w io.Writer, config Config, seconds float64) error {
+	report := jsonReport{
+		Files:      config.stats.files,
+		Rewritten:  config.stats.rewritten,
+		Unresolved: config.stats.unresolved,
+		Seconds:    seconds,
+		Issues:     config.stats.issues,
+		Duplicates: []duplicateKey{},
+	}
+	if report.Issues == nil {
+		report.Issues = []linkIssue{}
+	}
+	for _, key := range config.index.DuplicateKeys() {
+		report.Duplicates = append(report.Duplicates, duplicateKey{Key: key, Paths: config.index.Duplicates(key)})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// linkRecord returns the record of change for the --report file.
+func linkRecord(config Config, opts linklore.Options, change linkChange) linklore.LinkRecord {
+	record := linklore.DescribeLink(change.match, config.index, opts)
+	record.Source = config.inputFile
+	record.Line, record.Column = change.line, change.column
+	record.Replacement = change.replacement
+	if change.err != nil {
+		record.Error = change.err.Error()
+		// As processFile, which only replaces these links.
+		if !errors.Is(change.err, linklore.ErrLinkNotFound) && !linklore.IsWarning(change.err) {
+			record.Replacement = change.match
+		}
+	}
+	return record
+}
+
+// extractedLink is a link printed by --extract.
+type extractedLink struct {
+	linklore.LinkRecord
+	// Status is "ok" if the link was rewritten, or the reason it was
+	// reported otherwise.
+	Status string `json:"status"`
+}
+
+// linkStatus returns the status of a link rewritten with err.
+func linkStatus(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return issueReason(err)
+}
+
+// writeExtract writes links in format: in text, one tab-separated line per
+// link with its location as "file:line:column", its status, the link as
+// written and the path it resolved to, if any; in json, one JSON object per
+// line, so that the links of each file can be written as it is processed.
+func writeExtract(w io.Writer, links []extractedLink, format string) error {
+	if format == reportFormatJSON {
+		encoder := json.NewEncoder(w)
+		for _, link := range links {
+			if err := encoder.Encode(link); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, link := range links {
+		path := ""
+		if link.Path != nil {
+			path = *link.Path
+		}
+		_, err := fmt.Fprintf(w, "%s:%d:%d\t%s\t%s\t%s\n", link.Source, link.Line, link.Column, link.Status, link.Text, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReportFile writes records to path as a JSON array.
+func writeReportFile(path string, records []linklore.LinkRecord) error {
+	if records == nil {
+		records = []linklore.LinkRecord{}
+	}
+	content, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, append(content, '\n'), 0644)
+}
+
+// linkCount is how many times a target or a link occurs.
+type linkCount struct {
+	key   string
+	count int
+}
+
+// countLinks counts the values of key over records, skipping "", most
+// frequent first and then by key.
+func countLinks(records []linklore.LinkRecord, key func(linklore.LinkRecord) string) []linkCount {
+	counts := make(map[string]int)
+	for _, record := range records {
+		if k := key(record); k != "" {
+			counts[k]++
+		}
+	}
+	var result []linkCount
+	for k, count := range counts {
+		result = append(result, linkCount{key: k, count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].key < result[j].key
+	})
+	return result
+}
+
+// writeLinkStats writes the number of links in records, how often each
+// target was linked, and the links written verbatim more than once.
+func writeLinkStats(w io.Writer, records []linklore.LinkRecord) {
+	texts := countLinks(records, func(record linklore.LinkRecord) string { return record.Text })
+	fmt.Fprintf(w, "links: %d total, %d unique\n", len(records), len(texts))
+
+	targets := countLinks(records, func(record linklore.LinkRecord) string {
+		if record.Path == nil {
+			return ""
+		}
+		return *record.Path
+	})
+	fmt.Fprintf(w, "targets (%d):\n", len(targets))
+	for _, target := range targets {
+		fmt.Fprintf(w, "%6d  %s\n", target.count, target.key)
+	}
+
+	var repeated []linkCount
+	for _, text := range texts {
+		if text.count > 1 {
+			repeated = append(repeated, text)
+		}
+	}
+	fmt.Fprintf(w, "repeated links (%d):\n", len(repeated))
+	for _, text := range repeated {
+		fmt.Fprintf(w, "%6d  %s\n", text.count, text.key)
+	}
+}
+
+// writeLinkStatsTo writes the link stats of records to path, or to stderr
+// if path is "".
+func writeLinkStatsTo(path string, records []linklore.LinkRecord) error {
+	if path == "" {
+		writeLinkStats(os.Stderr, records)
+		return nil
+	}
+	var buf bytes.Buffer
+	writeLinkStats(&buf, records)
+	return writeOutput(path, buf.Bytes(), 0644)
+}
+
+// useColor reports whether to colorize the output written to f: only when
+// it is a terminal and NO_COLOR is not set, see https://no-color.org.
+func useColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pluveto/linklore/linklore"
+)
+
+func TestWriteIssues(t *testing.T) {
+	changes := []linkChange{
+		{match: "[[a]]", replacement: "[a](/a)", line: 1, column: 1},
+		{match: "[[missing]]", err: &linklore.LinkError{Link: "[[missing]]", Err: linklore.ErrLinkNotFound}, line: 1, column: 7},
+		{match: "[[a#Nope]]", replacement: "[a](/a#nope)", err: &linklore.LinkError{Link: "[[a#Nope]]", Err: linklore.ErrAnchorNotFound}, line: 2, column: 1},
+		{match: "[[note]]", err: &linklore.LinkError{Link: "[[note]]", Err: fmt.Errorf("%w (candidates: x.md, y.md)", linklore.ErrAmbiguousLink)}, line: 3, column: 5},
+		{match: "[[gone]]", err: &linklore.LinkError{Link: "[[gone]]", Err: linklore.ErrLinkNotFound}, line: 4, column: 2},
+	}
+	stats := &runStats{}
+	stats.record("a.md", changes)
+	stats.record("b.md", changes[:1])
+	stats.record("c.md", changes[1:2])
+
+	var output bytes.Buffer
+	writeIssues(&output, stats.issues, false)
+	expected := "a.md: 4 issue(s)\n" +
+		"  not found (2):\n" +
+		"    a.md:1:7: [[missing]]\n" +
+		"    a.md:4:2: [[gone]]\n" +
+		"  ambiguous (1):\n" +
+		"    a.md:3:5: [[note]]: ambiguous link (candidates: x.md, y.md)\n" +
+		"  bad anchor (1):\n" +
+		"    a.md:2:1: [[a#Nope]]\n" +
+		"c.md: 1 issue(s)\n" +
+		"  not found (1):\n" +
+		"    c.md:1:7: [[missing]]\n"
+	if output.String() != expected {
+		t.Errorf("writeIssues failed: got %q, want %q", output.String(), expected)
+	}
+
+	output.Reset()
+	writeIssues(&output, stats.issues[4:], true)
+	expected = "\x1b[1mc.md\x1b[0m: 1 issue(s)\n" +
+		"  \x1b[31mnot found\x1b[0m (1):\n" +
+		"    c.md:1:7: [[missing]]\n"
+	if output.String() != expected {
+		t.Errorf("writeIssues failed with color: got %q, want %q", output.String(), expected)
+	}
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	config := Config{
+		stats: &runStats{},
+		index: newTestIndex(
+			linklore.FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "note.md"},
+			linklore.FileInfo{Name: "note.md", Basename: "note", Ext: ".md", Path: "sub/note.md"},
+		),
+	}
+	config.stats.record("a.md", []linkChange{
+		{match: "[[a]]", replacement: "[a](/a)", line: 1, column: 1},
+		{match: "[[missing]]", err: &linklore.LinkError{Link: "[[missing]]", Err: linklore.ErrLinkNotFound}, line: 1, column: 7},
+	})
+
+	var output bytes.Buffer
+	if err := writeJSONReport(&output, config, 0.5); err != nil {
+		t.Fatalf("writeJSONReport failed: %v", err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(output.Bytes(), &report); err != nil {
+		t.Fatalf("writeJSONReport failed: invalid JSON: %v", err)
+	}
+	expected := jsonReport{
+		Files:      1,
+		Rewritten:  1,
+		Unresolved: 1,
+		Seconds:    0.5,
+		Issues: []linkIssue{{
+			File:   "a.md",
+			Line:   1,
+			Column: 7,
+			Link:   "[[missing]]",
+			Reason: reasonNotFound,
+			Error:  "file not found for link: [[missing]]",
+		}},
+		Duplicates: []duplicateKey{{Key: "note", Paths: []string{"note.md", "sub/note.md"}}},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("writeJSONReport failed: got %+v, want %+v", report, expected)
+	}
+}
+
+func TestProcessFileReport(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "input.txt", "[[a|A]]\n [[missing]]")
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "input.txt"),
+		outputFile:     filepath.Join(tempDir, "output.txt"),
+		prefix:         "/",
+		dryRun:         true,
+		reportFile:     filepath.Join(tempDir, "report.json"),
+		ignorePatterns: []string{"*.txt", "*.json"},
+		stats:          &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+	if err := writeReportFile(config.reportFile, config.stats.records); err != nil {
+		t.Fatalf("writeReportFile failed: %v", err)
+	}
+
+	content, err := os.ReadFile(config.reportFile)
+	if err != nil {
+		t.Fatalf("unable to read report: %v", err)
+	}
+	var records []linklore.LinkRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		t.Fatalf("writeReportFile failed: invalid JSON: %v", err)
+	}
+	path := "a.md"
+	expected := []linklore.LinkRecord{
+		{Source: config.inputFile, Line: 1, Column: 1, Text: "[[a|A]]", Base: "a", Alias: "A", Path: &path, Replacement: "[A](/a)"},
+		{Source: config.inputFile, Line: 2, Column: 2, Text: "[[missing]]", Base: "missing", Replacement: "[[missing]]", Error: "file not found for link: [[missing]]"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("writeReportFile failed: got %+v, want %+v", records, expected)
+	}
+	if _, err := os.Stat(config.outputFile); err == nil {
+		t.Errorf("processFile failed: dry run wrote an output file")
+	}
+}
+
+func TestWriteLinkStats(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "b.md", "")
+	createTestFile(tempDir, "input.txt", "[[a]] [[b]] [[a|A]]\n[[a]] [[missing]] [[b]] [[a]]")
+
+	config := Config{
+		baseDir:        tempDir,
+		inputFile:      filepath.Join(tempDir, "input.txt"),
+		prefix:         "/",
+		dryRun:         true,
+		linkStats:      true,
+		ignorePatterns: []string{"*.txt"},
+		stats:          &runStats{},
+	}
+	var err error
+	config.index, err = buildIndex(context.Background(), config)
+	if err != nil {
+		t.Fatalf("buildIndex failed: %v", err)
+	}
+	if err := processFile(config); err != nil {
+		t.Fatalf("processFile failed: %v", err)
+	}
+
+	var output bytes.Buffer
+	writeLinkStats(&output, config.stats.records)
+	expected := "links: 7 total, 4 unique\n" +
+		"targets (2):\n" +
+		"     4  a.md\n" +
+		"     2  b.md\n" +
+		"repeated links (2):\n" +
+		"     3  [[a]]\n" +
+		"     2  [[b]]\n"
+	if output.String() != expected {
+		t.Errorf("writeLinkStats failed: got %q, want %q", output.String(), expected)
+	}
+}
+
+func TestProcessFileExtract(t *testing.T) {
+	tempDir := createTempDir(t)
+	defer os.RemoveAll(tempDir)
+
+	createTestFile(tempDir, "a.md", "")
+	createTestFile(tempDir, "input.txt", "[[a#H]] [[missing]]\n")
+
+	for _, format := range []string{reportFormatText, reportFormatJSON} {
+		stdout, err := os.Create(filepath.Join(tempDir, "stdout"))
+		if err != nil {
+			t.Fatalf("unable to create stdout file: %v", err)
+		}
+		oldStdout := os.Stdout
+		os.Stdout = stdout
+
+		config := Config{
+			baseDir:        tempDir,
+			inputFile:      filepath.Join(tempDir, "input.txt"),
+			outputFile:     filepath.Join(tempDir, "output.txt"),
+			prefix:         "/",
+			extract:        true,
+			extractFormat:  format,
+			ignorePatterns: []string{"*.txt", "stdout"},
+		}
+		setDefaultValues(&config)
+		if !config.dryRun {
+			t.Errorf("setDefaultValues failed: --extract should imply -n")
+		}
+		config.index, err = buildIndex(context.Background(), config)
+		if err != nil {
+			t.Fatalf("buildIndex failed: %v", err)
+		}
+		err = processFile(config)
+		os.Stdout = oldStdout
+		stdout.Close()
+		if err != nil {
+			t.Fatalf("processFile failed: %v", err)
+		}
+
+		output, err := os.ReadFile(stdout.Name())
+		if err != nil {
+			t.Fatalf("unable to read stdout: %v", err)
+		}
+		switch format {
+		case reportFormatText:
+			expected := config.inputFile + ":1:1\tok\t[[a#H]]\ta.md\n" +
+				config.inputFile + ":1:9\tnot found\t[[missing]]\t\n"
+			if string(output) != expected {
+				t.Errorf("processFile failed: got %q, want %q", output, expected)
+			}
+		case reportFormatJSON:
+			var statuses, paths []string
+			decoder := json.NewDecoder(bytes.NewReader(output))
+			for decoder.More() {
+				var link extractedLink
+				if err := decoder.Decode(&link); err != nil {
+					t.Fatalf("unable to decode extracted link: %v", err)
+				}
+				statuses = append(statuses, link.Status)
+				path := ""
+				if link.Path != nil {
+					path = *link.Path
+				}
+				paths = append(paths, path)
+			}
+			if !reflect.DeepEqual(statuses, []string{"ok", reasonNotFound}) || !reflect.DeepEqual(paths, []string{"a.md", ""}) {
+				t.Errorf("processFile failed: got statuses %v and paths %v", statuses, paths)
+			}
+		}
+		if _, err := os.Stat(config.outputFile); err == nil {
+			t.Errorf("processFile failed: --extract wrote an output file")
+		}
+	}
+}